@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// OpRead allows get, info and subscriptions
+	OpRead = "read"
+
+	// OpWrite allows put and inc
+	OpWrite = "write"
+
+	// OpAdmin allows all operations including open, edit, drop, alerts,
+	// backups and restores. Server wide operations (metrics, replication)
+	// need admin access to "*".
+	OpAdmin = "admin"
+
+	// AllDatabases is used to check access to server wide operations
+	AllDatabases = "*"
+)
+
+var (
+	// ErrUnauthorized is returned when the token is missing or unknown
+	ErrUnauthorized = errors.New("unauthorized: invalid token")
+
+	// ErrForbidden is returned when the token does not allow the operation
+	ErrForbidden = errors.New("forbidden: operation is not allowed")
+)
+
+// ACL grants operations on databases to clients with a token or to
+// clients with a TLS certificate for the principal (common name).
+type ACL struct {
+	Token     string     `json:"token"`
+	Principal string     `json:"principal"`
+	Rules     []*ACLRule `json:"rules"`
+}
+
+// ACLRule grants operations on a database. A database name ending with
+// "*" is a prefix and "*" matches all databases.
+type ACLRule struct {
+	Database string   `json:"database"`
+	Ops      []string `json:"ops"`
+}
+
+func (r *ACLRule) matches(database string) (ok bool) {
+	return matchDatabase(r.Database, database)
+}
+
+// matchDatabase checks a database name against a name or a prefix
+func matchDatabase(pattern, database string) (ok bool) {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(database, strings.TrimSuffix(pattern, "*"))
+	}
+
+	return pattern == database
+}
+
+func (r *ACLRule) allows(op string) (ok bool) {
+	for _, o := range r.Ops {
+		if o == op || o == OpAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// acls checks tokens against ACLs. A nil *acls allows everything so
+// authentication is only enabled when ACLs are configured.
+type acls struct {
+	tokens map[string][]*ACLRule
+}
+
+func newACLs(list []*ACL) (a *acls) {
+	if len(list) == 0 {
+		return nil
+	}
+
+	a = &acls{tokens: make(map[string][]*ACLRule)}
+	for _, acl := range list {
+		if acl.Token != "" {
+			a.tokens[acl.Token] = append(a.tokens[acl.Token], acl.Rules...)
+		}
+
+		if acl.Principal != "" {
+			token := principalToken(acl.Principal)
+			a.tokens[token] = append(a.tokens[token], acl.Rules...)
+		}
+	}
+
+	return a
+}
+
+// valid checks whether the token is known
+func (a *acls) valid(token string) (ok bool) {
+	_, ok = a.tokens[token]
+	return ok && token != ""
+}
+
+// allow returns an error unless the token can run op on the database
+func (a *acls) allow(token, database, op string) (err error) {
+	if a == nil {
+		return nil
+	}
+
+	if !a.valid(token) {
+		return goerr.Wrap(ErrUnauthorized, 0)
+	}
+
+	for _, rule := range a.tokens[token] {
+		if rule.matches(database) && rule.allows(op) {
+			return nil
+		}
+	}
+
+	return goerr.Wrap(ErrForbidden, 0)
+}
+
+// authorize checks a request token and clears it so that it's not
+// stored in logs (wal, replication) or returned in responses.
+func (s *server) authorize(token *string, database, op string) (err error) {
+	err = s.acls.allow(*token, database, op)
+	*token = ""
+	return err
+}
+
+// authorizeRequest checks the token of a request inside a batch. Requests
+// without a token use the token of the batch.
+func (s *server) authorizeRequest(req *Request, token string) (err error) {
+	setToken(req, token)
+
+	switch {
+	case req.OpenReq != nil:
+		return s.authorize(&req.OpenReq.Token, req.OpenReq.Database, OpAdmin)
+	case req.EditReq != nil:
+		return s.authorize(&req.EditReq.Token, req.EditReq.Database, OpAdmin)
+	case req.PutReq != nil:
+		return s.authorize(&req.PutReq.Token, req.PutReq.Database, OpWrite)
+	case req.IncReq != nil:
+		return s.authorize(&req.IncReq.Token, req.IncReq.Database, OpWrite)
+	case req.GetReq != nil:
+		return s.authorize(&req.GetReq.Token, req.GetReq.Database, OpRead)
+	}
+
+	// info requests are checked when databases are filtered
+	return nil
+}
+
+// filterInfo removes databases which the token cannot read
+func (s *server) filterInfo(res *InfoRes, token string) (err error) {
+	if s.acls == nil {
+		return nil
+	}
+
+	if !s.acls.valid(token) {
+		return goerr.Wrap(ErrUnauthorized, 0)
+	}
+
+	dbs := res.Databases[:0]
+	for _, dbi := range res.Databases {
+		if s.acls.allow(token, dbi.Database, OpRead) == nil {
+			dbs = append(dbs, dbi)
+		}
+	}
+
+	res.Databases = dbs
+	return nil
+}
+
+// filterAlerts removes rules and states of databases which the token
+// cannot read
+func (s *server) filterAlerts(res *ListAlertsRes, token string) (err error) {
+	if s.acls == nil {
+		return nil
+	}
+
+	if !s.acls.valid(token) {
+		return goerr.Wrap(ErrUnauthorized, 0)
+	}
+
+	allowed := make(map[string]bool)
+	rules := res.Rules[:0]
+	for _, rule := range res.Rules {
+		if s.acls.allow(token, rule.Query.Database, OpRead) == nil {
+			allowed[rule.Name] = true
+			rules = append(rules, rule)
+		}
+	}
+
+	states := res.States[:0]
+	for _, st := range res.States {
+		if allowed[st.Rule] {
+			states = append(states, st)
+		}
+	}
+
+	res.Rules = rules
+	res.States = states
+	return nil
+}
+
+// httpToken reads the token from the Authorization header ("Bearer" or
+// "Token" schemes) or the token query parameter.
+func httpToken(r *http.Request) (token string) {
+	auth := r.Header.Get("Authorization")
+	for _, scheme := range []string{"Bearer ", "Token "} {
+		if strings.HasPrefix(auth, scheme) {
+			return strings.TrimPrefix(auth, scheme)
+		}
+	}
+
+	return r.URL.Query().Get("token")
+}
+
+// authorizeHTTP checks the token of an http request for all databases
+// and writes an error response if it's not allowed.
+func (s *server) authorizeHTTP(w http.ResponseWriter, r *http.Request, databases []string, op string) (ok bool) {
+	token := httpToken(r)
+	for _, database := range databases {
+		if err := s.acls.allow(token, database, op); err != nil {
+			status := http.StatusForbidden
+			if goerr.Is(err, ErrUnauthorized) {
+				status = http.StatusUnauthorized
+			}
+
+			http.Error(w, err.Error(), status)
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+func TestACL(t *testing.T) {
+	dir := "/tmp/d-acl"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{
+		Path: dir,
+		ACLs: []*ACL{
+			{Token: "admin", Rules: []*ACLRule{{Database: "*", Ops: []string{OpAdmin}}}},
+			{Token: "app", Rules: []*ACLRule{
+				{Database: "app-*", Ops: []string{OpRead, OpWrite}},
+				{Database: "shared", Ops: []string{OpRead}},
+			}},
+			{Token: "tenant", Rules: []*ACLRule{{Database: "app-*", Ops: []string{OpAdmin}}}},
+		},
+		InfluxMappings: []*InfluxMapping{{Measurement: "*", Database: "app-1", Fields: []string{"measurement"}}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	call := func(fn func([]byte) ([]byte, error), req, res proto.Message) error {
+		reqData, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resData, err := fn(reqData)
+		if err != nil {
+			return err
+		}
+
+		return proto.Unmarshal(resData, res)
+	}
+
+	for _, name := range []string{"app-1", "shared"} {
+		req := &OpenReq{
+			Database:    name,
+			Resolution:  60,
+			Retention:   36000,
+			EpochTime:   3600,
+			MaxROEpochs: 2,
+			MaxRWEpochs: 2,
+		}
+
+		req.Token = "app"
+		if err := call(s.Open, req, &OpenRes{}); !goerr.Is(err, ErrForbidden) {
+			t.Fatal("only admins can open databases", err)
+		}
+
+		req.Token = "admin"
+		if err := call(s.Open, req, &OpenRes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := uint32(time.Now().Unix())
+	put := &PutReq{Database: "app-1", Fields: []string{"a"}, Timestamp: now, Value: 1, Count: 1}
+	if err := call(s.Put, put, &PutRes{}); !goerr.Is(err, ErrUnauthorized) {
+		t.Fatal("requests without a token should fail", err)
+	}
+
+	put.Token = "app"
+	if err := call(s.Put, put, &PutRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	put.Database = "shared"
+	if err := call(s.Put, put, &PutRes{}); !goerr.Is(err, ErrForbidden) {
+		t.Fatal("shared database should be read only", err)
+	}
+
+	// each request inside a batch is checked
+	batch := &ReqBatch{
+		Token: "app",
+		Batch: []*Request{
+			{GetReq: &GetReq{Database: "shared", Fields: []string{"a"}, GroupBy: []bool{true}, StartTime: now, EndTime: now + 60}},
+			{PutReq: &PutReq{Database: "shared", Fields: []string{"a"}, Timestamp: now, Value: 1, Count: 1}},
+		},
+	}
+
+	if err := call(s.Batch, batch, &ResBatch{}); !goerr.Is(err, ErrForbidden) {
+		t.Fatal("batch should check each request", err)
+	}
+
+	batch.Batch = batch.Batch[:1]
+	if err := call(s.Batch, batch, &ResBatch{}); err != nil {
+		t.Fatal(err)
+	}
+
+	info := &InfoRes{}
+	if err := call(s.Info, &InfoReq{Token: "app"}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.Databases) != 2 {
+		t.Fatal("incorrect databases", info.Databases)
+	}
+
+	if err := call(s.Metrics, &MetricsReq{Token: "app"}, &MetricsRes{}); !goerr.Is(err, ErrForbidden) {
+		t.Fatal("metrics should need admin access", err)
+	}
+
+	// alert rules are replaced by name so tenants can not replace rules
+	// of other databases
+	rule := &AlertRule{
+		Name:      "errors",
+		Query:     &GetReq{Database: "shared", Fields: []string{"a"}, GroupBy: []bool{true}},
+		Window:    300,
+		Operator:  ">",
+		Threshold: 10,
+	}
+
+	if err := call(s.SetAlert, &SetAlertReq{Rule: rule, Token: "admin"}, &SetAlertRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rule.Query.Database = "app-1"
+	if err := call(s.SetAlert, &SetAlertReq{Rule: rule, Token: "tenant"}, &SetAlertRes{}); !goerr.Is(err, ErrForbidden) {
+		t.Fatal("tenants should not replace rules of other databases", err)
+	}
+
+	if r, _ := s.alerts.get("errors"); r.Query.Database != "shared" {
+		t.Fatal("rule should not be replaced")
+	}
+
+	// backups use server paths so they need access to all databases
+	if err := call(s.Backup, &BackupReq{Database: "app-1", Path: "x", Token: "tenant"}, &BackupRes{}); !goerr.Is(err, ErrForbidden) {
+		t.Fatal("tenants should not write backups to server paths", err)
+	}
+
+	if err := call(s.Restore, &RestoreReq{Database: "app-1", Path: "x", Token: "tenant"}, &RestoreRes{}); !goerr.Is(err, ErrForbidden) {
+		t.Fatal("tenants should not read backups from server paths", err)
+	}
+
+	// names which escape the data path are rejected before acls match them
+	for _, name := range []string{"../evil", "app-1/../../evil"} {
+		open := testOpenReq(name)
+		open.Token = "tenant"
+		if err := call(s.Open, open, &OpenRes{}); !goerr.Is(err, ErrDatabaseName) {
+			t.Fatal("invalid names should be rejected", name, err)
+		}
+
+		batch := &ReqBatch{Batch: []*Request{{OpenReq: testOpenReq(name)}}, Token: "admin"}
+		if err := call(s.Batch, batch, &ResBatch{}); !goerr.Is(err, ErrDatabaseName) {
+			t.Fatal("invalid names should be rejected in batches", name, err)
+		}
+	}
+
+	if _, err := os.Stat("/tmp/evil"); !os.IsNotExist(err) {
+		t.Fatal("databases should not be created outside the data path", err)
+	}
+
+	ix := newInflux(s, s.options.InfluxMappings)
+	w := httptest.NewRecorder()
+	ix.ServeHTTP(w, httptest.NewRequest("POST", "/write", strings.NewReader("cpu value=1")))
+	if w.Code != 401 {
+		t.Fatal("http writes without a token should fail", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/write", strings.NewReader("cpu value=1"))
+	r.Header.Set("Authorization", "Token app")
+	ix.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatal("incorrect status", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// DefaultAlertInterval is the default interval between rule evaluations
+	DefaultAlertInterval = time.Minute
+
+	// WebhookTimeout is the maximum time to wait for a webhook request
+	WebhookTimeout = 10 * time.Second
+
+	// AlertPending is the state of a group which matches the condition
+	// but not for the duration required by the rule yet.
+	AlertPending = "pending"
+
+	// AlertFiring is the state of a group which matched the condition
+	// for the duration required by the rule.
+	AlertFiring = "firing"
+
+	// AlertResolved is the state of a firing group which no longer
+	// matches the condition. It's removed on the next evaluation.
+	AlertResolved = "resolved"
+)
+
+var (
+	// ErrAlertRule is returned when an alert rule is not valid
+	ErrAlertRule = errors.New("alert rule is not valid")
+
+	// ErrAlertNotFound is returned when an alert rule is not found
+	ErrAlertNotFound = errors.New("alert rule not found")
+)
+
+// AlertNotification is posted to the webhook as json on state changes
+type AlertNotification struct {
+	Rule      string   `json:"rule"`
+	Group     []string `json:"group"`
+	State     string   `json:"state"`
+	Value     float64  `json:"value"`
+	Threshold float64  `json:"threshold"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+type alerts struct {
+	server  *server
+	webhook string
+	client  *http.Client
+	mutex   sync.Mutex
+	rules   map[string]*AlertRule
+	states  map[string]map[string]*AlertState
+}
+
+func newAlerts(s *server, webhook string) (a *alerts) {
+	return &alerts{
+		server:  s,
+		webhook: webhook,
+		client:  &http.Client{Timeout: WebhookTimeout},
+		rules:   make(map[string]*AlertRule),
+		states:  make(map[string]map[string]*AlertState),
+	}
+}
+
+// set adds a rule or replaces an existing rule with the same name
+func (a *alerts) set(rule *AlertRule) (err error) {
+	if err := validateAlertRule(rule); err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.rules[rule.Name] = rule
+	delete(a.states, rule.Name)
+
+	return nil
+}
+
+func (a *alerts) get(name string) (rule *AlertRule, ok bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	rule, ok = a.rules[name]
+	return rule, ok
+}
+
+func (a *alerts) del(name string) (err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.rules[name]; !ok {
+		return goerr.Wrap(ErrAlertNotFound, 0)
+	}
+
+	delete(a.rules, name)
+	delete(a.states, name)
+
+	return nil
+}
+
+// list returns all rules and states sorted by rule name
+func (a *alerts) list() (rules []*AlertRule, states []*AlertState) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	names := make([]string, 0, len(a.rules))
+	for name := range a.rules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		rules = append(rules, a.rules[name])
+
+		keys := make([]string, 0, len(a.states[name]))
+		for key := range a.states[name] {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		for _, key := range keys {
+			states = append(states, a.states[name][key])
+		}
+	}
+
+	return rules, states
+}
+
+// evaluateEvery evaluates all rules on every tick
+func (a *alerts) evaluateEvery(d time.Duration) {
+	for now := range time.Tick(d) {
+		if a.server.closing() {
+			return
+		}
+
+		a.evaluate(now)
+	}
+}
+
+// evaluate runs all rule queries and updates the state of each group
+func (a *alerts) evaluate(now time.Time) {
+	defer Logger.Time(time.Now(), 10*time.Second, "alerts.evaluate")
+
+	a.mutex.Lock()
+	rules := make([]*AlertRule, 0, len(a.rules))
+	for _, rule := range a.rules {
+		rules = append(rules, rule)
+	}
+	a.mutex.Unlock()
+
+	for _, rule := range rules {
+		values, err := a.query(rule, now)
+		if err != nil {
+			Logger.Error(err, rule.Name)
+			continue
+		}
+
+		notifications := a.update(rule, values, now)
+		for _, n := range notifications {
+			a.notify(rule, n)
+		}
+	}
+}
+
+// query returns the metric value of each group over the rule window
+func (a *alerts) query(rule *AlertRule, now time.Time) (values map[string]*alertValue, err error) {
+	req := *rule.Query
+	req.EndTime = uint32(now.Unix())
+	req.StartTime = req.EndTime - rule.Window
+
+	res, err := a.server.get(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	values = make(map[string]*alertValue, len(res.Groups))
+	for _, grp := range res.Groups {
+		var sum float64
+		var num uint32
+		for _, p := range grp.Points {
+			sum += p.Value
+			num += p.Count
+		}
+
+		val := &alertValue{group: grp.Fields}
+		switch rule.Metric {
+		case "count":
+			val.value = float64(num)
+		case "average":
+			if num > 0 {
+				val.value = sum / float64(num)
+			}
+		default:
+			val.value = sum
+		}
+
+		values[strings.Join(grp.Fields, "\x00")] = val
+	}
+
+	return values, nil
+}
+
+type alertValue struct {
+	group []string
+	value float64
+}
+
+// update moves groups between states and returns the notifications to send
+func (a *alerts) update(rule *AlertRule, values map[string]*alertValue, now time.Time) (ns []*AlertNotification) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// the rule may have been removed or replaced while querying
+	if a.rules[rule.Name] != rule {
+		return nil
+	}
+
+	states, ok := a.states[rule.Name]
+	if !ok {
+		states = make(map[string]*AlertState)
+		a.states[rule.Name] = states
+	}
+
+	ts := uint32(now.Unix())
+	notification := func(st *AlertState) *AlertNotification {
+		return &AlertNotification{
+			Rule:      rule.Name,
+			Group:     st.Group,
+			State:     st.State,
+			Value:     st.Value,
+			Threshold: rule.Threshold,
+			Timestamp: now.Unix(),
+		}
+	}
+
+	for key, val := range values {
+		if !compareAlert(val.value, rule.Operator, rule.Threshold) {
+			continue
+		}
+
+		st, ok := states[key]
+		if !ok || st.State == AlertResolved {
+			st = &AlertState{Rule: rule.Name, Group: val.group, State: AlertPending, Since: ts}
+			states[key] = st
+		}
+
+		st.Value = val.value
+		if st.State == AlertPending && ts-st.Since >= rule.Duration {
+			st.State = AlertFiring
+			st.Since = ts
+			ns = append(ns, notification(st))
+		}
+	}
+
+	for key, st := range states {
+		val, ok := values[key]
+		if ok && compareAlert(val.value, rule.Operator, rule.Threshold) {
+			continue
+		}
+
+		switch st.State {
+		case AlertFiring:
+			st.State = AlertResolved
+			st.Since = ts
+			if ok {
+				st.Value = val.value
+			}
+
+			ns = append(ns, notification(st))
+		default:
+			delete(states, key)
+		}
+	}
+
+	return ns
+}
+
+// notify posts a notification to the webhook of the rule or the default
+func (a *alerts) notify(rule *AlertRule, n *AlertNotification) {
+	url := rule.Webhook
+	if url == "" {
+		url = a.webhook
+	}
+
+	if url == "" {
+		Logger.Info("alert", n.Rule, n.State, n.Group)
+		return
+	}
+
+	data, err := json.Marshal(n)
+	if err != nil {
+		Logger.Error(err)
+		return
+	}
+
+	res, err := a.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		Logger.Error(err)
+		return
+	}
+
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		Logger.Error("webhook failed", url, res.Status)
+	}
+}
+
+func compareAlert(value float64, op string, threshold float64) (ok bool) {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+
+	return false
+}
+
+func validateAlertRule(rule *AlertRule) (err error) {
+	if rule == nil || rule.Name == "" || rule.Query == nil || rule.Window == 0 {
+		return goerr.Wrap(ErrAlertRule, 0)
+	}
+
+	switch rule.Metric {
+	case "", "value", "count", "average":
+	default:
+		return goerr.Wrap(ErrAlertRule, 0)
+	}
+
+	switch rule.Operator {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return goerr.Wrap(ErrAlertRule, 0)
+	}
+
+	return nil
+}
+
+func (s *server) setAlert(req *SetAlertReq) (res *SetAlertRes, err error) {
+	res = &SetAlertRes{}
+
+	if err := s.alerts.set(req.Rule); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *server) delAlert(req *DelAlertReq) (res *DelAlertRes, err error) {
+	res = &DelAlertRes{}
+
+	if err := s.alerts.del(req.Name); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *server) listAlerts(req *ListAlertsReq) (res *ListAlertsRes, err error) {
+	res = &ListAlertsRes{}
+	res.Rules, res.States = s.alerts.list()
+	return res, nil
+}
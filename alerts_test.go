@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAlerts(t *testing.T) {
+	dir := "/tmp/d-alerts"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	notifications := make(chan *AlertNotification, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := &AlertNotification{}
+		if err := json.NewDecoder(r.Body).Decode(n); err != nil {
+			t.Error(err)
+		}
+
+		notifications <- n
+	}))
+
+	defer hook.Close()
+
+	srv, err := NewServer(&Options{Path: dir, AlertWebhook: hook.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	_, err = s.open(&OpenReq{
+		Database:    "alerts",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := &AlertRule{
+		Name: "errors",
+		Query: &GetReq{
+			Database: "alerts",
+			Fields:   []string{"errors", ""},
+			GroupBy:  []bool{true, true},
+		},
+		Window:    300,
+		Operator:  ">",
+		Threshold: 100,
+		Duration:  60,
+	}
+
+	if _, err := s.setAlert(&SetAlertReq{Rule: rule}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.setAlert(&SetAlertReq{Rule: &AlertRule{Name: "bad"}}); err == nil {
+		t.Fatal("should reject invalid rules")
+	}
+
+	now := time.Now()
+	put := func(host string, value float64) {
+		req := &PutReq{
+			Database:  "alerts",
+			Fields:    []string{"errors", host},
+			Timestamp: uint32(now.Unix()) - 120,
+			Value:     value,
+			Count:     1,
+		}
+
+		if _, err := s.put(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	put("h1", 150)
+	put("h2", 50)
+
+	s.alerts.evaluate(now)
+	_, states := s.alerts.list()
+	if len(states) != 1 || states[0].State != AlertPending || states[0].Group[1] != "h1" {
+		t.Fatal("h1 should be pending", states)
+	}
+
+	s.alerts.evaluate(now.Add(time.Minute))
+	n := <-notifications
+	if n.Rule != "errors" || n.State != AlertFiring || n.Group[1] != "h1" || n.Value != 150 {
+		t.Fatal("h1 should be firing", n)
+	}
+
+	put("h1", 10)
+	s.alerts.evaluate(now.Add(2 * time.Minute))
+	n = <-notifications
+	if n.State != AlertResolved || n.Group[1] != "h1" {
+		t.Fatal("h1 should be resolved", n)
+	}
+
+	if _, err := s.delAlert(&DelAlertReq{Name: "errors"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.listAlerts(&ListAlertsReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Rules) != 0 || len(res.States) != 0 {
+		t.Fatal("rule should be removed")
+	}
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// ManifestFile is the name of the manifest file in a backup
+	ManifestFile = "manifest.json"
+)
+
+var (
+	// ErrBackupPath is returned when the backup path is missing or not empty
+	ErrBackupPath = errors.New("backup path must be a new or empty directory")
+
+	// ErrBackupRoot is returned for backup paths outside of the backup root
+	ErrBackupRoot = errors.New("backup path must be inside the backup root")
+)
+
+// BackupManifest describes the databases and files in a backup
+type BackupManifest struct {
+	Created   int64             `json:"created"`
+	Databases []*BackupDatabase `json:"databases"`
+
+	// ReplOffset is the end of the replication log when the backup was
+	// started. A follower seeded with the backup can start from here.
+	ReplOffset uint64 `json:"replOffset,omitempty"`
+}
+
+// BackupDatabase has database options, epoch directories and a list of
+// files with checksums. File paths are relative to the backup root.
+type BackupDatabase struct {
+	Name    string        `json:"name"`
+	Options *OpenReq      `json:"options"`
+	Epochs  []string      `json:"epochs"`
+	Files   []*BackupFile `json:"files"`
+}
+
+// BackupFile has the size and sha256 checksum of a file in a backup
+type BackupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func (s *server) backup(req *BackupReq) (res *BackupRes, err error) {
+	defer Logger.Time(time.Now(), time.Minute, "server.backup")
+	res = &BackupRes{}
+
+	if req.Path == "" {
+		return nil, goerr.Wrap(ErrBackupPath, 0)
+	}
+
+	dir, err := s.backupPath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := s.backupNames(req.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.backupTo(dir, names); err != nil {
+		return nil, err
+	}
+
+	res.Databases = names
+	return res, nil
+}
+
+// backupPath resolves a path given by a client. Relative paths are in
+// the backup root and other paths must be inside it. Clients can not use
+// paths when the server has no backup root.
+func (s *server) backupPath(p string) (dir string, err error) {
+	if s.options.BackupRoot == "" {
+		return "", goerr.Wrap(ErrBackupRoot, 0)
+	}
+
+	root := filepath.Clean(s.options.BackupRoot)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+
+	dir = filepath.Clean(p)
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", goerr.Wrap(ErrBackupRoot, 0)
+	}
+
+	return dir, nil
+}
+
+// serveBackup streams a backup of one (or all) databases as a tar archive.
+// Databases are copied to a temporary directory before streaming so slow
+// clients do not block writes.
+func (s *server) serveBackup(w http.ResponseWriter, r *http.Request) {
+	defer Logger.Time(time.Now(), time.Minute, "server.serveBackup")
+
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	database := r.URL.Query().Get("database")
+	if database == "" {
+		database = AllDatabases
+	}
+
+	if !s.authorizeHTTP(w, r, []string{database}, OpAdmin) {
+		return
+	}
+
+	names, err := s.backupNames(r.URL.Query().Get("database"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	tmp, err := ioutil.TempDir("", "kadiradb-backup-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer os.RemoveAll(tmp)
+
+	if _, err := s.backupTo(tmp, names); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	if err := writeTar(w, tmp); err != nil {
+		Logger.Error(err)
+	}
+}
+
+// backupNames returns the database name or all names if it's empty
+func (s *server) backupNames(database string) (names []string, err error) {
+	s.dbsMutex.RLock()
+	defer s.dbsMutex.RUnlock()
+
+	if database != "" {
+		if _, ok := s.databases[database]; !ok {
+			return nil, goerr.Wrap(ErrDatabase, 0)
+		}
+
+		return []string{database}, nil
+	}
+
+	for name := range s.databases {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// backupTo copies databases to a new directory and writes the manifest
+func (s *server) backupTo(dir string, names []string) (m *BackupManifest, err error) {
+	if files, err := ioutil.ReadDir(dir); err == nil && len(files) > 0 {
+		return nil, goerr.Wrap(ErrBackupPath, 0)
+	}
+
+	if err := os.MkdirAll(dir, DataPerm); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	m = &BackupManifest{Created: time.Now().Unix()}
+	if s.repl != nil {
+		m.ReplOffset = s.repl.end()
+	}
+
+	for _, name := range names {
+		bdb, err := s.snapshot(name, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Databases = append(m.Databases, bdb)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	mpath := path.Join(dir, ManifestFile)
+	if err := ioutil.WriteFile(mpath, data, 0644); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return m, nil
+}
+
+// snapshot syncs a database and copies its files into dir/<name>.
+// Writes to the database wait only while it's synced and the sizes of
+// its files are read. Files are copied up to these sizes afterwards so
+// writes made during the copy may be in the backup. They are after the
+// ReplOffset of the backup and followers apply them again.
+func (s *server) snapshot(name, dir string) (bdb *BackupDatabase, err error) {
+	if err := s.flushIncs(); err != nil {
+		return nil, err
+	}
+
+	s.readers.RLock()
+	defer s.readers.RUnlock()
+
+	bdb, err = s.snapshotFiles(name)
+	if err != nil {
+		return nil, err
+	}
+
+	src := path.Join(s.options.Path, name)
+	for _, epoch := range append([]string{"."}, bdb.Epochs...) {
+		if err := os.MkdirAll(path.Join(dir, name, epoch), DataPerm); err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+	}
+
+	for _, f := range bdb.Files {
+		rel := filepath.FromSlash(strings.TrimPrefix(f.Path, name+"/"))
+		dst := path.Join(dir, name, rel)
+		if err := os.MkdirAll(path.Dir(dst), DataPerm); err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+
+		f.SHA256, err = copyFileSize(path.Join(src, rel), dst, f.Size)
+		if err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+	}
+
+	return bdb, nil
+}
+
+// snapshotFiles syncs a database and lists its epochs and files (with
+// their sizes) holding the write lock of the database
+func (s *server) snapshotFiles(name string) (bdb *BackupDatabase, err error) {
+	lock := s.writeLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	db, ok := s.database(name)
+	if !ok {
+		return nil, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	if err := db.Sync(); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	metadata, err := db.Info()
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	bdb = &BackupDatabase{
+		Name: name,
+		Options: &OpenReq{
+			Database:    name,
+			Resolution:  uint32(metadata.Resolution / 1e9),
+			Retention:   uint32(metadata.Retention / 1e9),
+			EpochTime:   uint32(metadata.Duration / 1e9),
+			MaxROEpochs: metadata.MaxROEpochs,
+			MaxRWEpochs: metadata.MaxRWEpochs,
+		},
+	}
+
+	src := path.Join(s.options.Path, name)
+	err = filepath.Walk(src, func(fpath string, finfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, fpath)
+		if err != nil {
+			return err
+		}
+
+		if finfo.IsDir() {
+			// kadiyadb keeps each epoch in a directory
+			if rel != "." && !strings.Contains(rel, string(filepath.Separator)) {
+				bdb.Epochs = append(bdb.Epochs, rel)
+			}
+
+			return nil
+		}
+
+		bdb.Files = append(bdb.Files, &BackupFile{
+			Path: path.Join(name, filepath.ToSlash(rel)),
+			Size: finfo.Size(),
+		})
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return bdb, nil
+}
+
+// copyFile copies a file and returns the sha256 checksum of its content
+func copyFile(src, dst string) (sum string, err error) {
+	return copyFileSize(src, dst, -1)
+}
+
+// copyFileSize copies the first size bytes of a file (all of it when
+// size is negative) and returns the sha256 checksum of the copy
+func copyFileSize(src, dst string, size int64) (sum string, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	w := io.MultiWriter(out, hash)
+	if size < 0 {
+		_, err = io.Copy(w, in)
+	} else {
+		_, err = io.CopyN(w, in, size)
+	}
+
+	if err != nil {
+		out.Close()
+		return "", err
+	}
+
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeTar writes all files in dir as a tar archive with the manifest last
+func writeTar(w io.Writer, dir string) (err error) {
+	tw := tar.NewWriter(w)
+
+	err = filepath.Walk(dir, func(fpath string, finfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil || rel == "." || rel == ManifestFile {
+			return err
+		}
+
+		return writeTarEntry(tw, fpath, filepath.ToSlash(rel), finfo)
+	})
+
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	mpath := path.Join(dir, ManifestFile)
+	finfo, err := os.Stat(mpath)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if err := writeTarEntry(tw, mpath, ManifestFile, finfo); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if err := tw.Close(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+func writeTarEntry(tw *tar.Writer, fpath, name string, finfo os.FileInfo) (err error) {
+	hdr, err := tar.FileInfoHeader(finfo, "")
+	if err != nil {
+		return err
+	}
+
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if finfo.IsDir() {
+		return nil
+	}
+
+	file, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// newHTTPRequest creates a request to the http listener of a server.
+// The token is sent in the Authorization header so it's not logged
+// with the url.
+func newHTTPRequest(method, rawurl, token string, body io.Reader) (req *http.Request, err error) {
+	req, err = http.NewRequest(method, rawurl, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req, nil
+}
+
+// backupCommand creates a backup with a running server. With -path the
+// server writes the backup to a directory on its own filesystem. With
+// -http the backup is streamed as a tar archive to -out.
+func backupCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	addr := fs.String("addr", DefaultAddr, "server address")
+	token := fs.String("token", "", "authentication token")
+	secure := newTLSFlags(fs)
+	httpAddr := fs.String("http", "", "server http address to stream a tar archive")
+	database := fs.String("database", "", "database name (default: all databases)")
+	dir := fs.String("path", "", "backup directory on the server")
+	out := fs.String("out", "-", "tar archive file when using -http")
+	fs.Parse(args)
+
+	if *dir != "" {
+		req := &BackupReq{Database: *database, Path: *dir}
+		res := &BackupRes{}
+		conn, err := secure.dial(*addr, *token)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+		call := conn.call
+
+		if err := call("backup", req, res); err != nil {
+			return err
+		}
+
+		fmt.Println("backup created:", strings.Join(res.Databases, ", "))
+		return nil
+	}
+
+	if *httpAddr == "" {
+		return goerr.Wrap(ErrUsage, 0)
+	}
+
+	query := url.Values{"database": {*database}}
+	req, err := newHTTPRequest("GET", "http://"+*httpAddr+"/backup?"+query.Encode(), *token, nil)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return goerr.New(strings.TrimSpace(string(msg)))
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		defer file.Close()
+		w = file
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestBackup(t *testing.T) {
+	dir := "/tmp/d-backup"
+	out := "/tmp/d-backup-out"
+	for _, p := range []string{dir, out} {
+		if err := os.RemoveAll(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv, err := NewServer(&Options{Path: dir, BackupRoot: "/tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	_, err = s.open(&OpenReq{
+		Database:    "backup",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := uint32(time.Now().Unix())
+	if _, err := s.put(&PutReq{Database: "backup", Fields: []string{"a"}, Timestamp: now, Value: 5, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.backup(&BackupReq{Path: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Databases) != 1 || res.Databases[0] != "backup" {
+		t.Fatal("incorrect databases", res.Databases)
+	}
+
+	if _, err := s.backup(&BackupReq{Path: out}); err == nil {
+		t.Fatal("should not overwrite an existing backup")
+	}
+
+	for _, p := range []string{"/var/tmp/d-backup", "../d-backup", "/tmp"} {
+		if _, err := s.backup(&BackupReq{Path: p}); err == nil {
+			t.Fatal("should not write backups outside of the backup root", p)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path.Join(out, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &BackupManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Databases) != 1 || m.Databases[0].Options.Resolution != 60 {
+		t.Fatal("incorrect manifest", string(data))
+	}
+
+	if len(m.Databases[0].Files) == 0 {
+		t.Fatal("backup should have files")
+	}
+
+	for _, f := range m.Databases[0].Files {
+		fdata, err := ioutil.ReadFile(path.Join(out, f.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sum := sha256.Sum256(fdata)
+		if hex.EncodeToString(sum[:]) != f.SHA256 || int64(len(fdata)) != f.Size {
+			t.Fatal("checksum mismatch", f.Path)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.serveBackup(w, httptest.NewRequest("GET", "/backup?database=backup", nil))
+	if w.Code != 200 {
+		t.Fatal("incorrect status", w.Code, w.Body.String())
+	}
+
+	var last string
+	tr := tar.NewReader(w.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		last = hdr.Name
+	}
+
+	if last != ManifestFile {
+		t.Fatal("manifest should be the last entry", last)
+	}
+}
+
+func TestHTTPRequestToken(t *testing.T) {
+	req, err := newHTTPRequest("GET", "http://localhost:19001/backup?database=a", "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if httpToken(req) != "secret" || req.URL.Query().Get("token") != "" {
+		t.Fatal("token should be sent in the Authorization header", req.URL)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// SeriesIndexFile has a json line for each series of a database. It's
+	// kept in the database directory so it's included in backups.
+	SeriesIndexFile = "series.index"
+
+	// SeriesLimitFile stores the series limit of a database
+	SeriesLimitFile = "series.json"
+
+	// SeriesIndexSlack is the number of lines the index file can have
+	// over twice the number of series before it's compacted
+	SeriesIndexSlack = 1024
+)
+
+var (
+	// ErrMaxSeries is returned when a write creates a new series in a
+	// database which already has the maximum number of series
+	ErrMaxSeries = errors.New("series limit reached: new series are not accepted")
+)
+
+// seriesEntry is a line of the series index
+type seriesEntry struct {
+	Time   int64    `json:"time"`
+	Fields []string `json:"fields"`
+}
+
+// seriesLimit is the content of the series limit file
+type seriesLimit struct {
+	MaxSeries uint32 `json:"maxSeries"`
+}
+
+// seriesIndex keeps track of series written to a database to count them
+// and to reject new series over the limit. Entries have the time a series
+// was last written. They are written again when a series is written
+// after refresh so entries of active series do not expire. Series which
+// were not written within retention are removed when the index is loaded.
+type seriesIndex struct {
+	dir     string
+	mutex   sync.Mutex
+	file    *os.File
+	series  map[string]*seriesEntry
+	pending map[string]int
+	lines   int
+	refresh int64
+	max     uint32
+}
+
+func openSeriesIndex(dir string, retention int64) (x *seriesIndex, err error) {
+	x = &seriesIndex{
+		dir:     dir,
+		series:  make(map[string]*seriesEntry),
+		pending: make(map[string]int),
+		refresh: retention / 4,
+	}
+
+	if data, err := ioutil.ReadFile(path.Join(dir, SeriesLimitFile)); err == nil {
+		limit := &seriesLimit{}
+		if err := json.Unmarshal(data, limit); err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+
+		x.max = limit.MaxSeries
+	}
+
+	fpath := path.Join(dir, SeriesIndexFile)
+	min := seriesExpiry(time.Now().UnixNano(), retention)
+
+	var lines int
+	if file, err := os.Open(fpath); err == nil {
+		sc := bufio.NewScanner(file)
+		for sc.Scan() {
+			lines++
+
+			// a partially written line at the end of the file is skipped
+			entry := &seriesEntry{}
+			if err := json.Unmarshal(sc.Bytes(), entry); err != nil {
+				continue
+			}
+
+			key := seriesKey(entry.Fields)
+			if prev, ok := x.series[key]; !ok || prev.Time < entry.Time {
+				x.series[key] = entry
+			}
+		}
+
+		file.Close()
+		if err := sc.Err(); err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+	}
+
+	for key, entry := range x.series {
+		if entry.Time < min {
+			delete(x.series, key)
+		}
+	}
+
+	if lines > len(x.series) {
+		if err := x.compact(); err != nil {
+			return nil, err
+		}
+	} else if err := x.openFile(); err != nil {
+		return nil, err
+	}
+
+	return x, nil
+}
+
+// seriesExpiry returns the time before which entries are expired. Entries
+// can be older than the last write by up to a quarter of retention.
+func seriesExpiry(now, retention int64) (min int64) {
+	return now - retention - retention/4
+}
+
+func (x *seriesIndex) openFile() (err error) {
+	fpath := path.Join(x.dir, SeriesIndexFile)
+	x.file, err = os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	x.lines = len(x.series)
+	return nil
+}
+
+// compact writes the index file with one entry for each series. The
+// mutex must be held when the index is used.
+func (x *seriesIndex) compact() (err error) {
+	if x.file != nil {
+		if err := x.file.Close(); err != nil {
+			return goerr.Wrap(err, 0)
+		}
+	}
+
+	entries := make([]*seriesEntry, 0, len(x.series))
+	for _, entry := range x.series {
+		entries = append(entries, entry)
+	}
+
+	if err := writeSeriesIndex(path.Join(x.dir, SeriesIndexFile), entries); err != nil {
+		return err
+	}
+
+	return x.openFile()
+}
+
+// writeSeriesIndex replaces the index file with entries
+func writeSeriesIndex(fpath string, entries []*seriesEntry) (err error) {
+	tmp := fpath + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			file.Close()
+			return goerr.Wrap(err, 0)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return goerr.Wrap(err, 0)
+	}
+
+	if err := file.Close(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if err := os.Rename(tmp, fpath); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+func seriesKey(fields []string) (key string) {
+	return strings.Join(fields, "\x00")
+}
+
+// reserve checks if a series can be written. A new series is accepted
+// if the database has less than the maximum number of series or if exists
+// reports that it's already in the database (it may not be in the index
+// after it was loaded). New series count towards the limit until they
+// are added or released. exists reads the database so it's called
+// without the mutex and the index is checked again afterwards.
+func (x *seriesIndex) reserve(fields []string, exists func() bool) (reserved bool, err error) {
+	key := seriesKey(fields)
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if _, ok := x.series[key]; ok {
+		return false, nil
+	}
+
+	if x.full(key) {
+		x.mutex.Unlock()
+		found := exists()
+		x.mutex.Lock()
+
+		if _, ok := x.series[key]; ok {
+			return false, nil
+		}
+
+		if !found && x.full(key) {
+			return false, goerr.Wrap(ErrMaxSeries, 0)
+		}
+	}
+
+	x.pending[key]++
+	return true, nil
+}
+
+// full reports if a new series would be over the limit.
+// mutex must be held when it's called.
+func (x *seriesIndex) full(key string) (full bool) {
+	return x.pending[key] == 0 && x.max > 0 && len(x.series)+len(x.pending) >= int(x.max)
+}
+
+// release removes a reservation of a series which was not written
+func (x *seriesIndex) release(fields []string) {
+	key := seriesKey(fields)
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if n, ok := x.pending[key]; ok && n > 1 {
+		x.pending[key] = n - 1
+	} else {
+		delete(x.pending, key)
+	}
+}
+
+// add records a write to a series
+func (x *seriesIndex) add(fields []string) (err error) {
+	key := seriesKey(fields)
+	now := time.Now().UnixNano()
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if entry, ok := x.series[key]; ok && now-entry.Time < x.refresh {
+		return nil
+	}
+
+	entry := &seriesEntry{Time: now, Fields: fields}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if _, err := x.file.Write(append(data, '\n')); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	x.series[key] = entry
+	delete(x.pending, key)
+
+	x.lines++
+	if x.lines > 2*len(x.series)+SeriesIndexSlack {
+		return x.compact()
+	}
+
+	return nil
+}
+
+// count returns the number of series and the series limit
+func (x *seriesIndex) count() (n uint64, max uint32) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return uint64(len(x.series)), x.max
+}
+
+// countMatching counts series which match a filter and may have points
+// after since. Counting stops when more than max series match.
+func (x *seriesIndex) countMatching(filter []string, since int64, max int) (n int) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	for _, entry := range x.series {
+		if entry.Time+x.refresh < since || !matchFields(filter, entry.Fields) {
+			continue
+		}
+
+		if n++; n > max {
+			break
+		}
+	}
+
+	return n
+}
+
+// setMax changes the series limit, zero removes the limit
+func (x *seriesIndex) setMax(max uint32) (err error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if max == x.max {
+		return nil
+	}
+
+	data, err := json.Marshal(&seriesLimit{MaxSeries: max})
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if err := ioutil.WriteFile(path.Join(x.dir, SeriesLimitFile), data, 0644); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	x.max = max
+	return nil
+}
+
+func (x *seriesIndex) close() (err error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if err := x.file.Close(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+// reserveSeries checks the series limit of a database before a series is
+// written. The returned function must be called after the write.
+func (s *server) reserveSeries(database string, fields []string) (release func(), err error) {
+	s.dbsMutex.RLock()
+	db, ok := s.databases[database]
+	x := s.indexes[database]
+	s.dbsMutex.RUnlock()
+
+	if !ok || x == nil {
+		return func() {}, nil
+	}
+
+	exists := func() bool {
+		metadata, err := db.Info()
+		if err != nil {
+			Logger.Error(err)
+			return false
+		}
+
+		end := time.Now().UnixNano()
+		data, err := db.Get(end-metadata.Retention, end, fields)
+		if err != nil {
+			Logger.Error(err)
+			return false
+		}
+
+		return len(data) > 0
+	}
+
+	reserved, err := x.reserve(fields, exists)
+	if err != nil || !reserved {
+		return func() {}, err
+	}
+
+	return func() { x.release(fields) }, nil
+}
+
+// addSeries records a write to a series in the index of a database
+func (s *server) addSeries(database string, fields []string) (err error) {
+	s.dbsMutex.RLock()
+	x := s.indexes[database]
+	s.dbsMutex.RUnlock()
+
+	if x == nil {
+		return nil
+	}
+
+	return x.add(fields)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+func TestSeriesLimit(t *testing.T) {
+	options := &Options{Path: "/tmp/d-cardinality"}
+	s := newTestServer(t, options)
+
+	info := func(s *server) *DBInfo {
+		res := &InfoRes{}
+		if err := testCall(t, s.Info, &InfoReq{}, res); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, dbi := range res.Databases {
+			if dbi.Database == "limited" {
+				return dbi
+			}
+		}
+
+		t.Fatal("database should be in info")
+		return nil
+	}
+
+	open := testOpenReq("limited")
+	open.MaxSeries = 2
+	if err := testCall(t, s.Open, open, &OpenRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := uint32(time.Now().Unix())
+	put := func(s *server, field string) error {
+		req := &PutReq{Database: "limited", Fields: []string{field}, Timestamp: now, Value: 1, Count: 1}
+		return testCall(t, s.Put, req, &PutRes{})
+	}
+
+	for _, field := range []string{"a", "b"} {
+		if err := put(s, field); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := put(s, "c"); !goerr.Is(err, ErrMaxSeries) {
+		t.Fatal("new series over the limit should be rejected", err)
+	}
+
+	if err := put(s, "a"); err != nil {
+		t.Fatal("existing series should accept writes", err)
+	}
+
+	inc := &IncReq{Database: "limited", Fields: []string{"d"}, Timestamp: now, Value: 1, Count: 1}
+	if err := testCall(t, s.Inc, inc, &IncRes{}); !goerr.Is(err, ErrMaxSeries) {
+		t.Fatal("increments should be limited", err)
+	}
+
+	if dbi := info(s); dbi.Series != 2 || dbi.MaxSeries != 2 {
+		t.Fatal("info should report cardinality", dbi)
+	}
+
+	// requests without a series limit do not change it
+	if err := testCall(t, s.Open, testOpenReq("limited"), &OpenRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	edit := &EditReq{Database: "limited", MaxROEpochs: 2, MaxRWEpochs: 2}
+	if err := testCall(t, s.Edit, edit, &EditRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if dbi := info(s); dbi.MaxSeries != 2 {
+		t.Fatal("series limit should not be removed", dbi)
+	}
+
+	edit.MaxSeries = 3
+	if err := testCall(t, s.Edit, edit, &EditRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := put(s, "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	// entries of series which are still written are not expired
+	x := s.indexes["limited"]
+	x.series[seriesKey([]string{"a"})].Time = time.Now().UnixNano() - 72000e9
+	if err := put(s, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	closeTestServer(t, s)
+
+	// the index and the limit are loaded when the server starts
+	s = openTestServer(t, options)
+	if dbi := info(s); dbi.Series != 3 || dbi.MaxSeries != 3 {
+		t.Fatal("cardinality should be loaded", dbi)
+	}
+
+	if err := put(s, "e"); !goerr.Is(err, ErrMaxSeries) {
+		t.Fatal("limit should be loaded", err)
+	}
+
+	edit = &EditReq{Database: "limited", MaxROEpochs: 2, MaxRWEpochs: 2, ClearMaxSeries: true}
+	if err := testCall(t, s.Edit, edit, &EditRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := put(s, "e"); err != nil {
+		t.Fatal("series limit should be removed", err)
+	}
+
+	closeTestServer(t, s)
+}
+
+func TestSeriesReserve(t *testing.T) {
+	s := newTestServer(t, &Options{Path: "/tmp/d-cardinality-reserve"})
+	defer closeTestServer(t, s)
+
+	open := testOpenReq("limited")
+	open.MaxSeries = 1
+	if _, err := s.open(open); err != nil {
+		t.Fatal(err)
+	}
+
+	// series which are being written count towards the limit
+	release, err := s.reserveSeries("limited", []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.reserveSeries("limited", []string{"b"}); !goerr.Is(err, ErrMaxSeries) {
+		t.Fatal("reserved series should count towards the limit", err)
+	}
+
+	// series of failed writes are not added
+	release()
+	if n, _ := s.indexes["limited"].count(); n != 0 {
+		t.Fatal("released series should not be counted", n)
+	}
+
+	if _, err := s.reserveSeries("limited", []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the database is read without holding the index
+	x := s.indexes["limited"]
+	reserved, err := x.reserve([]string{"c"}, func() bool {
+		x.count()
+		return true
+	})
+
+	if err != nil || !reserved {
+		t.Fatal("series in the database should be reserved", err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/gogo/protobuf/proto"
+	"github.com/meteorhacks/simple-rpc-go/srpc"
+)
+
+var (
+	// ErrUsage is returned when a command is missing required flags
+	ErrUsage = errors.New("missing required flags, see -help")
+)
+
+// commands can be given as the first argument to run a command
+// against a running server instead of starting a server.
+var commands = map[string]func(args []string) (err error){
+	"backup":    backupCommand,
+	"restore":   restoreCommand,
+	"export":    exportCommand,
+	"import":    importCommand,
+	"reconcile": reconcileCommand,
+	"fsck":      fsckCommand,
+	"shell":     shellCommand,
+}
+
+// caller sends a request to a server and reads the response
+type caller func(method string, req, res proto.Message) (err error)
+
+// rpcClient sends requests with srpc over TCP or over TLS
+type rpcClient interface {
+	Call(method string, reqData []byte) (resData []byte, err error)
+	Close() (err error)
+}
+
+// rpcConn is a connection to a running server
+type rpcConn struct {
+	client rpcClient
+	token  string
+}
+
+// dial connects to a running server. The token is added to requests
+// which do not have one. TLS is used when config is not nil.
+func dial(addr, token string, config *tls.Config) (conn *rpcConn, err error) {
+	if config != nil {
+		client, err := dialTLS(addr, config)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rpcConn{client: client, token: token}, nil
+	}
+
+	client := srpc.NewClient(addr)
+	if err := client.Connect(); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return &rpcConn{client: client, token: token}, nil
+}
+
+// tlsFlags are flags of commands to connect to servers with TLS
+type tlsFlags struct {
+	ca   *string
+	cert *string
+	key  *string
+}
+
+func newTLSFlags(fs *flag.FlagSet) (f *tlsFlags) {
+	return &tlsFlags{
+		ca:   fs.String("tls-ca", "", "CA file to verify the server (enables tls)"),
+		cert: fs.String("tls-cert", "", "client certificate file"),
+		key:  fs.String("tls-key", "", "client private key file"),
+	}
+}
+
+// dial connects to a server with TLS when a CA file is set
+func (f *tlsFlags) dial(addr, token string) (conn *rpcConn, err error) {
+	if *f.ca == "" {
+		return dial(addr, token, nil)
+	}
+
+	config, err := clientTLSConfig(*f.ca, *f.cert, *f.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return dial(addr, token, config)
+}
+
+// call sends a request and reads the response
+func (c *rpcConn) call(method string, req, res proto.Message) (err error) {
+	if c.token != "" {
+		setRequestToken(req, c.token)
+	}
+
+	reqData, err := proto.Marshal(req)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	resData, err := c.client.Call(method, reqData)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if err := proto.Unmarshal(resData, res); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+// Close closes the connection
+func (c *rpcConn) Close() (err error) {
+	if err := c.client.Close(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+// setRequestToken sets the Token field of a request message if it's empty
+func setRequestToken(req proto.Message, token string) {
+	if p := messageToken(req); p != nil && *p == "" {
+		*p = token
+	}
+}
+
+// messageToken returns the Token field of a request message
+func messageToken(req proto.Message) (token *string) {
+	switch r := req.(type) {
+	case *ReqBatch:
+		return &r.Token
+	case *InfoReq:
+		return &r.Token
+	case *OpenReq:
+		return &r.Token
+	case *EditReq:
+		return &r.Token
+	case *PutReq:
+		return &r.Token
+	case *IncReq:
+		return &r.Token
+	case *GetReq:
+		return &r.Token
+	case *SubscribeReq:
+		return &r.Token
+	case *PollReq:
+		return &r.Token
+	case *UnsubscribeReq:
+		return &r.Token
+	case *SetAlertReq:
+		return &r.Token
+	case *DelAlertReq:
+		return &r.Token
+	case *ListAlertsReq:
+		return &r.Token
+	case *DropReq:
+		return &r.Token
+	case *ReplicateReq:
+		return &r.Token
+	case *BackupReq:
+		return &r.Token
+	case *RestoreReq:
+		return &r.Token
+	case *MetricsReq:
+		return &r.Token
+	case *ReconcileReq:
+		return &r.Token
+	case *RetryReq:
+		return &r.Token
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/kadirahq/kadiradb/protocol"
+)
+
+// Put writes a point. Puts are sent with other writes in a batch unless
+// batching is disabled or the request has its own token.
+func (c *Client) Put(ctx context.Context, req *protocol.PutReq) (res *protocol.PutRes, err error) {
+	if !c.batched(req.Token) {
+		res = &protocol.PutRes{}
+		if err := c.call(ctx, "put", req, res); err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	}
+
+	if err := c.batch.add(ctx, &protocol.Request{PutReq: req}); err != nil {
+		return nil, err
+	}
+
+	return &protocol.PutRes{}, nil
+}
+
+// Inc increments a point. Increments are batched like puts but they are
+// never retried because they would be counted twice.
+func (c *Client) Inc(ctx context.Context, req *protocol.IncReq) (res *protocol.IncRes, err error) {
+	if !c.batched(req.Token) {
+		res = &protocol.IncRes{}
+		if err := c.call(ctx, "inc", req, res); err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	}
+
+	if err := c.batch.add(ctx, &protocol.Request{IncReq: req}); err != nil {
+		return nil, err
+	}
+
+	return &protocol.IncRes{}, nil
+}
+
+// batched checks whether a write with a token can be batched
+func (c *Client) batched(token string) (ok bool) {
+	return c.batch.size > 1 && (token == "" || token == c.options.Token)
+}
+
+// pending is a write waiting for its batch to be sent
+type pending struct {
+	req  *protocol.Request
+	done chan error
+}
+
+// batcher collects writes and sends them with a single batch request when
+// it has enough writes or when the oldest write waited long enough. The
+// server stops at the first failed request so all writes of a batch get
+// the same error and writes before the failed one are applied.
+type batcher struct {
+	client *Client
+	size   int
+	delay  time.Duration
+	mutex  sync.Mutex
+	queue  []*pending
+	timer  *time.Timer
+}
+
+func newBatcher(c *Client, size int, delay time.Duration) (b *batcher) {
+	return &batcher{client: c, size: size, delay: delay}
+}
+
+// add queues a write and waits until its batch is sent. The write may
+// still be sent when the context is done before that.
+func (b *batcher) add(ctx context.Context, req *protocol.Request) (err error) {
+	b.client.closeMutex.RLock()
+	closed := b.client.closed
+	b.client.closeMutex.RUnlock()
+
+	if closed {
+		return goerr.Wrap(ErrClosed, 0)
+	}
+
+	p := &pending{req: req, done: make(chan error, 1)}
+
+	b.mutex.Lock()
+	b.queue = append(b.queue, p)
+
+	var full []*pending
+	if len(b.queue) >= b.size {
+		full = b.take()
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.delay, b.flush)
+	}
+
+	b.mutex.Unlock()
+
+	if full != nil {
+		go b.send(full)
+	}
+
+	select {
+	case err := <-p.done:
+		return err
+	case <-ctx.Done():
+		return goerr.Wrap(ctx.Err(), 0)
+	}
+}
+
+// take returns queued writes and stops the timer. The mutex must be held.
+func (b *batcher) take() (queue []*pending) {
+	queue, b.queue = b.queue, nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	return queue
+}
+
+// flush sends queued writes
+func (b *batcher) flush() {
+	b.mutex.Lock()
+	queue := b.take()
+	b.mutex.Unlock()
+
+	b.send(queue)
+}
+
+// send sends writes in a batch request. Batches with increments are not
+// retried.
+func (b *batcher) send(queue []*pending) {
+	if len(queue) == 0 {
+		return
+	}
+
+	retry := true
+	req := &protocol.ReqBatch{Batch: make([]*protocol.Request, len(queue))}
+	for i, p := range queue {
+		req.Batch[i] = p.req
+		if p.req.IncReq != nil {
+			retry = false
+		}
+	}
+
+	err := b.client.send(context.Background(), "batch", req, &protocol.ResBatch{}, retry)
+	for _, p := range queue {
+		p.done <- err
+	}
+}
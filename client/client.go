@@ -0,0 +1,306 @@
+// Package client is a Go client for kadiradb. It uses request and
+// response types of the protocol package like the server.
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/gogo/protobuf/proto"
+	"github.com/meteorhacks/simple-rpc-go/srpc"
+)
+
+const (
+	// DefaultConns is the default number of idle connections kept open
+	DefaultConns = 4
+
+	// DefaultRetries is the default number of retries for idempotent calls
+	DefaultRetries = 3
+
+	// DefaultBackoff is the time to wait before the first retry. It's
+	// doubled after each retry.
+	DefaultBackoff = 50 * time.Millisecond
+
+	// DefaultBatchSize is the default number of writes sent in a batch
+	DefaultBatchSize = 100
+
+	// DefaultBatchDelay is the default time writes wait for a batch
+	DefaultBatchDelay = 10 * time.Millisecond
+
+	// DefaultTimeout is used for batches of writes and for calls when the
+	// context does not have a deadline
+	DefaultTimeout = 10 * time.Second
+)
+
+var (
+	// ErrClosed is returned for calls after the client is closed
+	ErrClosed = errors.New("client is closed")
+)
+
+// idempotent has methods which can be sent again after an error. Writes
+// with put set values so they can be repeated but increments can not.
+var idempotent = map[string]bool{
+	"info":       true,
+	"open":       true,
+	"edit":       true,
+	"put":        true,
+	"get":        true,
+	"metrics":    true,
+	"listAlerts": true,
+	"setAlert":   true,
+	"replicate":  true,
+}
+
+// retryable has error messages of server errors which can succeed later
+var retryable = map[string]bool{
+	"rate limited: too many requests": true,
+}
+
+// Options has client options. Zero values use defaults.
+type Options struct {
+	Address string
+	Token   string
+
+	// Conns is the number of idle connections kept for later calls
+	Conns int
+
+	// Retries and Backoff are used for idempotent calls which fail with
+	// connection errors or rate limits. Retries is -1 to disable retries.
+	Retries int
+	Backoff time.Duration
+
+	// Put and Inc requests are sent in batches of BatchSize requests or
+	// after BatchDelay. BatchSize is -1 to send each write alone.
+	BatchSize  int
+	BatchDelay time.Duration
+
+	// Timeout is used when the context of a call has no deadline
+	Timeout time.Duration
+}
+
+// Client sends requests to a server using a pool of connections
+type Client struct {
+	options *Options
+	conns   chan *srpc.Client
+	batch   *batcher
+
+	closed     bool
+	closeMutex sync.RWMutex
+}
+
+// New creates a client and checks that the server is reachable
+func New(options *Options) (c *Client, err error) {
+	opts := *options
+	if opts.Conns <= 0 {
+		opts.Conns = DefaultConns
+	}
+
+	if opts.Retries == 0 {
+		opts.Retries = DefaultRetries
+	}
+
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+
+	if opts.BatchSize == 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	if opts.BatchDelay <= 0 {
+		opts.BatchDelay = DefaultBatchDelay
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	c = &Client{options: &opts, conns: make(chan *srpc.Client, opts.Conns)}
+	c.batch = newBatcher(c, opts.BatchSize, opts.BatchDelay)
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	c.release(conn)
+	return c, nil
+}
+
+// Close sends writes which are waiting for a batch and closes idle
+// connections. Calls made after Close return ErrClosed.
+func (c *Client) Close() (err error) {
+	c.closeMutex.Lock()
+	if c.closed {
+		c.closeMutex.Unlock()
+		return goerr.Wrap(ErrClosed, 0)
+	}
+
+	c.closed = true
+	c.closeMutex.Unlock()
+
+	c.batch.flush()
+
+	// connections released after closed is set are closed by release
+	for {
+		select {
+		case conn := <-c.conns:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) dial() (conn *srpc.Client, err error) {
+	conn = srpc.NewClient(c.options.Address)
+	if err := conn.Connect(); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return conn, nil
+}
+
+// acquire returns an idle connection or a new one
+func (c *Client) acquire() (conn *srpc.Client, err error) {
+	select {
+	case conn = <-c.conns:
+		return conn, nil
+	default:
+		return c.dial()
+	}
+}
+
+// release keeps a connection for later calls. It's closed when the pool
+// is full or the client is closed.
+func (c *Client) release(conn *srpc.Client) {
+	c.closeMutex.RLock()
+	defer c.closeMutex.RUnlock()
+
+	if !c.closed {
+		select {
+		case c.conns <- conn:
+			return
+		default:
+		}
+	}
+
+	conn.Close()
+}
+
+// call sends a request and retries idempotent calls with backoff
+func (c *Client) call(ctx context.Context, method string, req, res proto.Message) (err error) {
+	c.closeMutex.RLock()
+	closed := c.closed
+	c.closeMutex.RUnlock()
+
+	if closed {
+		return goerr.Wrap(ErrClosed, 0)
+	}
+
+	return c.send(ctx, method, req, res, idempotent[method])
+}
+
+// send sends a request without checking whether the client is closed
+func (c *Client) send(ctx context.Context, method string, req, res proto.Message, retry bool) (err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.Timeout)
+		defer cancel()
+	}
+
+	if c.options.Token != "" {
+		setToken(req, c.options.Token)
+	}
+
+	reqData, err := proto.Marshal(req)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	backoff := c.options.Backoff
+	for i := 0; ; i++ {
+		resData, err := c.exchange(ctx, method, reqData)
+		if err == nil {
+			if err := proto.Unmarshal(resData, res); err != nil {
+				return goerr.Wrap(err, 0)
+			}
+
+			return nil
+		}
+
+		if !retry || i >= c.options.Retries || !temporary(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return goerr.Wrap(ctx.Err(), 0)
+		}
+
+		backoff *= 2
+	}
+}
+
+// exchange sends a request using a connection from the pool. Connections
+// are closed after an error or when the context is done before the
+// response is received. Closing it stops the pending call.
+func (c *Client) exchange(ctx context.Context, method string, reqData []byte) (resData []byte, err error) {
+	conn, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		data, err := conn.Call(method, reqData)
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			conn.Close()
+			return nil, goerr.Wrap(r.err, 0)
+		}
+
+		c.release(conn)
+		return r.data, nil
+	case <-ctx.Done():
+		conn.Close()
+		return nil, goerr.Wrap(ctx.Err(), 0)
+	}
+}
+
+// temporary checks whether a call can succeed if it's sent again
+func temporary(err error) (ok bool) {
+	if e, ok := err.(*goerr.Error); ok {
+		err = e.Err
+	}
+
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	return err == io.EOF || err == io.ErrUnexpectedEOF || retryable[err.Error()]
+}
+
+// setToken sets the Token field of a request if it's empty
+func setToken(req proto.Message, token string) {
+	v := reflect.ValueOf(req).Elem().FieldByName("Token")
+	if v.IsValid() && v.Kind() == reflect.String && v.String() == "" {
+		v.SetString(token)
+	}
+}
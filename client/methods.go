@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+
+	"github.com/kadirahq/kadiradb/protocol"
+)
+
+// Info returns databases of the server
+func (c *Client) Info(ctx context.Context, req *protocol.InfoReq) (res *protocol.InfoRes, err error) {
+	res = &protocol.InfoRes{}
+	if err := c.call(ctx, "info", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Open creates a database or changes epoch limits of an existing one
+func (c *Client) Open(ctx context.Context, req *protocol.OpenReq) (res *protocol.OpenRes, err error) {
+	res = &protocol.OpenRes{}
+	if err := c.call(ctx, "open", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Edit changes options of a database
+func (c *Client) Edit(ctx context.Context, req *protocol.EditReq) (res *protocol.EditRes, err error) {
+	res = &protocol.EditRes{}
+	if err := c.call(ctx, "edit", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Get reads points of matching series
+func (c *Client) Get(ctx context.Context, req *protocol.GetReq) (res *protocol.GetRes, err error) {
+	res = &protocol.GetRes{}
+	if err := c.call(ctx, "get", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Batch sends requests in a single call. Batches are not retried.
+func (c *Client) Batch(ctx context.Context, req *protocol.ReqBatch) (res *protocol.ResBatch, err error) {
+	res = &protocol.ResBatch{}
+	if err := c.call(ctx, "batch", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Metrics returns server metrics
+func (c *Client) Metrics(ctx context.Context, req *protocol.MetricsReq) (res *protocol.MetricsRes, err error) {
+	res = &protocol.MetricsRes{}
+	if err := c.call(ctx, "metrics", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Subscribe starts a subscription to new points
+func (c *Client) Subscribe(ctx context.Context, req *protocol.SubscribeReq) (res *protocol.SubscribeRes, err error) {
+	res = &protocol.SubscribeRes{}
+	if err := c.call(ctx, "subscribe", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Poll returns points received by a subscription
+func (c *Client) Poll(ctx context.Context, req *protocol.PollReq) (res *protocol.PollRes, err error) {
+	res = &protocol.PollRes{}
+	if err := c.call(ctx, "poll", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Unsubscribe stops a subscription
+func (c *Client) Unsubscribe(ctx context.Context, req *protocol.UnsubscribeReq) (res *protocol.UnsubscribeRes, err error) {
+	res = &protocol.UnsubscribeRes{}
+	if err := c.call(ctx, "unsubscribe", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// SetAlert creates or replaces an alert rule
+func (c *Client) SetAlert(ctx context.Context, req *protocol.SetAlertReq) (res *protocol.SetAlertRes, err error) {
+	res = &protocol.SetAlertRes{}
+	if err := c.call(ctx, "setAlert", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// DelAlert removes an alert rule
+func (c *Client) DelAlert(ctx context.Context, req *protocol.DelAlertReq) (res *protocol.DelAlertRes, err error) {
+	res = &protocol.DelAlertRes{}
+	if err := c.call(ctx, "delAlert", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ListAlerts returns alert rules and their state
+func (c *Client) ListAlerts(ctx context.Context, req *protocol.ListAlertsReq) (res *protocol.ListAlertsRes, err error) {
+	res = &protocol.ListAlertsRes{}
+	if err := c.call(ctx, "listAlerts", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Backup writes a backup to a directory on the server
+func (c *Client) Backup(ctx context.Context, req *protocol.BackupReq) (res *protocol.BackupRes, err error) {
+	res = &protocol.BackupRes{}
+	if err := c.call(ctx, "backup", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Restore restores databases from a backup on the server
+func (c *Client) Restore(ctx context.Context, req *protocol.RestoreReq) (res *protocol.RestoreRes, err error) {
+	res = &protocol.RestoreRes{}
+	if err := c.call(ctx, "restore", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Drop removes a database and its files
+func (c *Client) Drop(ctx context.Context, req *protocol.DropReq) (res *protocol.DropRes, err error) {
+	res = &protocol.DropRes{}
+	if err := c.call(ctx, "drop", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Replicate reads operations from the replication log
+func (c *Client) Replicate(ctx context.Context, req *protocol.ReplicateReq) (res *protocol.ReplicateRes, err error) {
+	res = &protocol.ReplicateRes{}
+	if err := c.call(ctx, "replicate", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Reconcile applies database definitions
+func (c *Client) Reconcile(ctx context.Context, req *protocol.ReconcileReq) (res *protocol.ReconcileRes, err error) {
+	res = &protocol.ReconcileRes{}
+	if err := c.call(ctx, "reconcile", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Retry loads databases which failed to load
+func (c *Client) Retry(ctx context.Context, req *protocol.RetryReq) (res *protocol.RetryRes, err error) {
+	res = &protocol.RetryRes{}
+	if err := c.call(ctx, "retry", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
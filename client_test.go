@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/kadirahq/kadiradb/client"
+)
+
+func TestClient(t *testing.T) {
+	addr := "127.0.0.1:19341"
+	limits := []*RateLimit{{Database: "limited", Queries: 1}}
+	srv := newTestServer(t, &Options{Path: "/tmp/d-client", Address: addr, RateLimits: limits})
+	defer closeTestServer(t, srv)
+
+	go srv.Listen()
+
+	for i := 0; ; i++ {
+		if conn, err := dial(addr, "", nil); err == nil {
+			conn.Close()
+			break
+		} else if i == 100 {
+			t.Fatal(err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c, err := client.New(&client.Options{Address: addr, BatchSize: 3, BatchDelay: time.Second, Backoff: 400 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, name := range []string{"test", "limited"} {
+		open := &OpenReq{
+			Database:    name,
+			Resolution:  60,
+			Retention:   36000,
+			EpochTime:   3600,
+			MaxROEpochs: 2,
+			MaxRWEpochs: 2,
+		}
+
+		if _, err := c.Open(ctx, open); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := uint32(time.Now().Unix())
+	now -= now % 60
+
+	// a full batch is sent without waiting for the delay
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i, fields := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(i int, fields string) {
+			defer wg.Done()
+			req := &IncReq{Database: "test", Fields: []string{fields}, Timestamp: now, Value: 2, Count: 1}
+			_, errs[i] = c.Inc(ctx, req)
+		}(i, fields)
+	}
+
+	start := time.Now()
+	wg.Wait()
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("full batches should be sent immediately")
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := c.Get(ctx, &GetReq{Database: "test", Fields: []string{""}, GroupBy: []bool{false}, StartTime: now, EndTime: now + 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Groups) != 1 || res.Groups[0].Points[0].Value != 6 {
+		t.Fatal("batched writes should be applied", res.Groups)
+	}
+
+	// writes wait for the batch delay
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err = c.Put(short, &PutReq{Database: "test", Fields: []string{"d"}, Timestamp: now, Value: 1, Count: 1})
+	cancel()
+
+	if !goerr.Is(err, context.DeadlineExceeded) {
+		t.Fatal("calls should stop when the context is done", err)
+	}
+
+	// the second query is rate limited and retried after the backoff
+	get := &GetReq{Database: "limited", Fields: []string{"a"}, GroupBy: []bool{true}, StartTime: now, EndTime: now + 60}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, get); err != nil {
+			t.Fatal("rate limited calls should be retried", err)
+		}
+	}
+
+	info, err := c.Info(ctx, &InfoReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.Databases) != 2 {
+		t.Fatal("info should return databases", info.Databases)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Info(ctx, &InfoReq{}); !goerr.Is(err, client.ErrClosed) {
+		t.Fatal("calls after close should fail", err)
+	}
+}
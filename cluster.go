@@ -0,0 +1,482 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/gogo/protobuf/proto"
+	"github.com/meteorhacks/simple-rpc-go/srpc"
+)
+
+const (
+	// NodeConns is the maximum number of idle connections to each node
+	NodeConns = 8
+)
+
+var (
+	// ErrCluster is returned when a router is created without nodes
+	ErrCluster = errors.New("cluster must have at least one node")
+)
+
+// Router spreads series across kadiradb nodes by a hash of the database
+// name and field values. Writes go to the node which owns the series and
+// reads are sent to all nodes and merged.
+type Router interface {
+	Listen() (err error)
+	Info(reqData []byte) (resData []byte, err error)
+	Open(reqData []byte) (resData []byte, err error)
+	Edit(reqData []byte) (resData []byte, err error)
+	Drop(reqData []byte) (resData []byte, err error)
+	Put(reqData []byte) (resData []byte, err error)
+	Inc(reqData []byte) (resData []byte, err error)
+	Get(reqData []byte) (resData []byte, err error)
+	Batch(reqData []byte) (resData []byte, err error)
+}
+
+type router struct {
+	options *Options
+	nodes   []*node
+}
+
+// NewRouter creates a router for nodes in options.Cluster
+func NewRouter(options *Options) (r Router, err error) {
+	if len(options.Cluster) == 0 {
+		return nil, goerr.Wrap(ErrCluster, 0)
+	}
+
+	config, err := peerTLSConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	rtr := &router{options: options}
+	for _, addr := range options.Cluster {
+		rtr.nodes = append(rtr.nodes, newNode(addr, config))
+	}
+
+	return rtr, nil
+}
+
+func (r *router) Listen() (err error) {
+	srv := srpc.NewServer(r.options.Address)
+	srv.SetHandler("info", r.Info)
+	srv.SetHandler("open", r.Open)
+	srv.SetHandler("edit", r.Edit)
+	srv.SetHandler("drop", r.Drop)
+	srv.SetHandler("put", r.Put)
+	srv.SetHandler("inc", r.Inc)
+	srv.SetHandler("get", r.Get)
+	srv.SetHandler("batch", r.Batch)
+
+	log.Println("ROUTER: listening on", r.options.Address, "with", len(r.nodes), "nodes")
+	return srv.Listen()
+}
+
+func (r *router) Info(reqData []byte) (resData []byte, err error) {
+	req := &InfoReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := r.info(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (r *router) Open(reqData []byte) (resData []byte, err error) {
+	req := &OpenReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res := &OpenRes{}
+	if err := r.broadcast("open", req); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (r *router) Edit(reqData []byte) (resData []byte, err error) {
+	req := &EditReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res := &EditRes{}
+	if err := r.broadcast("edit", req); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (r *router) Drop(reqData []byte) (resData []byte, err error) {
+	req := &DropReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res := &DropRes{}
+	if err := r.broadcast("drop", req); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (r *router) Put(reqData []byte) (resData []byte, err error) {
+	req := &PutReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := r.put(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (r *router) Inc(reqData []byte) (resData []byte, err error) {
+	req := &IncReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := r.inc(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (r *router) Get(reqData []byte) (resData []byte, err error) {
+	req := &GetReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := r.get(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (r *router) Batch(reqData []byte) (resData []byte, err error) {
+	req := &ReqBatch{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	num := len(req.Batch)
+	res := &ResBatch{}
+	res.Batch = make([]*Response, num)
+	token := req.Token
+
+	for i, req := range req.Batch {
+		setToken(req, token)
+
+		response := &Response{}
+		var err error
+
+		switch {
+		case req.InfoReq != nil:
+			response.InfoRes, err = r.info(req.InfoReq)
+		case req.OpenReq != nil:
+			response.OpenRes = &OpenRes{}
+			err = r.broadcast("open", req.OpenReq)
+		case req.EditReq != nil:
+			response.EditRes = &EditRes{}
+			err = r.broadcast("edit", req.EditReq)
+		case req.PutReq != nil:
+			response.PutRes, err = r.put(req.PutReq)
+		case req.IncReq != nil:
+			response.IncRes, err = r.inc(req.IncReq)
+		case req.GetReq != nil:
+			response.GetRes, err = r.get(req.GetReq)
+		}
+
+		if err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+
+		res.Batch[i] = response
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+// info returns databases of all nodes
+func (r *router) info(req *InfoReq) (res *InfoRes, err error) {
+	defer Logger.Time(time.Now(), time.Second, "router.info")
+	res = &InfoRes{}
+
+	results := make([]*InfoRes, len(r.nodes))
+	err = r.scatter(r.nodes, func(i int, n *node) error {
+		results[i] = &InfoRes{}
+		return n.call("info", req, results[i])
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// nodes have different series so series counts are added
+	seen := make(map[string]*DBInfo)
+	for _, nres := range results {
+		for _, dbi := range nres.Databases {
+			if first, ok := seen[dbi.Database]; ok {
+				first.Series += dbi.Series
+
+				// databases which failed on any node are reported as failed
+				if first.Status == StatusOK && dbi.Status != StatusOK {
+					first.Status, first.Error = dbi.Status, dbi.Error
+				}
+
+				continue
+			}
+
+			seen[dbi.Database] = dbi
+			res.Databases = append(res.Databases, dbi)
+		}
+	}
+
+	return res, nil
+}
+
+func (r *router) put(req *PutReq) (res *PutRes, err error) {
+	defer Logger.Time(time.Now(), time.Second, "router.put")
+	res = &PutRes{}
+
+	n := r.owner(req.Database, req.Fields)
+	if err := n.call("put", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r *router) inc(req *IncReq) (res *IncRes, err error) {
+	defer Logger.Time(time.Now(), time.Second, "router.inc")
+	res = &IncRes{}
+
+	n := r.owner(req.Database, req.Fields)
+	if err := n.call("inc", req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// get sends the query to all nodes which can have matching series and
+// merges partial results. Queries without wildcards go to one node.
+func (r *router) get(req *GetReq) (res *GetRes, err error) {
+	defer Logger.Time(time.Now(), time.Second, "router.get")
+	res = &GetRes{}
+
+	nodes := r.nodes
+	if !hasWildcard(req.Fields) {
+		nodes = []*node{r.owner(req.Database, req.Fields)}
+	}
+
+	results := make([]*GetRes, len(nodes))
+	err = r.scatter(nodes, func(i int, n *node) error {
+		results[i] = &GetRes{}
+		return n.call("get", req, results[i])
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &seriesSet{[]*ResSeries{}, req.GroupBy}
+	for _, nres := range results {
+		for _, sr := range nres.Groups {
+			ss.add(sr)
+		}
+	}
+
+	res.Groups = ss.toResult()
+
+	return res, nil
+}
+
+// broadcast sends a request to all nodes. It's only used for open, edit
+// and drop requests which have responses without fields.
+func (r *router) broadcast(method string, req proto.Message) (err error) {
+	defer Logger.Time(time.Now(), 10*time.Second, "router."+method)
+
+	return r.scatter(r.nodes, func(i int, n *node) error {
+		return n.call(method, req, &OpenRes{})
+	})
+}
+
+// scatter calls fn for each node in parallel and returns the first error
+func (r *router) scatter(nodes []*node, fn func(i int, n *node) error) (err error) {
+	errs := make([]error, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func(i int, n *node) {
+			defer wg.Done()
+			errs[i] = fn(i, n)
+		}(i, n)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// owner returns the node which stores the series
+func (r *router) owner(database string, fields []string) (n *node) {
+	h := fnv.New32a()
+	h.Write([]byte(database))
+	for _, f := range fields {
+		h.Write([]byte{0})
+		h.Write([]byte(f))
+	}
+
+	return r.nodes[h.Sum32()%uint32(len(r.nodes))]
+}
+
+// setToken sets the token of a request inside a batch unless it has one.
+// Nodes check tokens so the router sends them with each request.
+func setToken(req *Request, token string) {
+	switch {
+	case req.InfoReq != nil && req.InfoReq.Token == "":
+		req.InfoReq.Token = token
+	case req.OpenReq != nil && req.OpenReq.Token == "":
+		req.OpenReq.Token = token
+	case req.EditReq != nil && req.EditReq.Token == "":
+		req.EditReq.Token = token
+	case req.PutReq != nil && req.PutReq.Token == "":
+		req.PutReq.Token = token
+	case req.IncReq != nil && req.IncReq.Token == "":
+		req.IncReq.Token = token
+	case req.GetReq != nil && req.GetReq.Token == "":
+		req.GetReq.Token = token
+	}
+}
+
+func hasWildcard(fields []string) (ok bool) {
+	for _, f := range fields {
+		if f == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// node keeps idle connections to a kadiradb node
+type node struct {
+	addr   string
+	config *tls.Config
+	conns  chan *rpcConn
+}
+
+func newNode(addr string, config *tls.Config) (n *node) {
+	return &node{addr: addr, config: config, conns: make(chan *rpcConn, NodeConns)}
+}
+
+// call sends a request using an idle connection or a new one. Connections
+// are closed after an error and when there are enough idle connections.
+func (n *node) call(method string, req, res proto.Message) (err error) {
+	var conn *rpcConn
+
+	select {
+	case conn = <-n.conns:
+	default:
+		conn, err = dial(n.addr, "", n.config)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := conn.call(method, req, res); err != nil {
+		if cerr := conn.Close(); cerr != nil {
+			Logger.Error(cerr)
+		}
+
+		return err
+	}
+
+	select {
+	case n.conns <- conn:
+	default:
+		if err := conn.Close(); err != nil {
+			Logger.Error(err)
+		}
+	}
+
+	return nil
+}
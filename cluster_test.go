@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+)
+
+func TestCluster(t *testing.T) {
+	var addrs []string
+	var nodes []*server
+
+	for i := 0; i < 3; i++ {
+		dir := fmt.Sprintf("/tmp/d-node%d", i)
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		addr := fmt.Sprintf("127.0.0.1:%d", 19311+i)
+		srv, err := NewServer(&Options{Path: dir, Address: addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go srv.Listen()
+		addrs = append(addrs, addr)
+		nodes = append(nodes, srv.(*server))
+	}
+
+	// wait for nodes to start listening
+	for _, addr := range addrs {
+		for i := 0; ; i++ {
+			if conn, err := dial(addr, "", nil); err == nil {
+				conn.Close()
+				break
+			} else if i == 100 {
+				t.Fatal(err)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	rtr, err := NewRouter(&Options{Cluster: addrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rtr.(*router)
+	call := func(fn func([]byte) ([]byte, error), req, res proto.Message) {
+		reqData, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resData, err := fn(reqData)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := proto.Unmarshal(resData, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	call(r.Open, &OpenReq{
+		Database:    "cluster",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	}, &OpenRes{})
+
+	info := &InfoRes{}
+	call(r.Info, &InfoReq{}, info)
+	if len(info.Databases) != 1 {
+		t.Fatal("incorrect databases", info.Databases)
+	}
+
+	now := uint32(time.Now().Unix())
+	for i := 0; i < 30; i++ {
+		req := &PutReq{
+			Database:  "cluster",
+			Fields:    []string{"host", fmt.Sprintf("h%d", i)},
+			Timestamp: now,
+			Value:     float64(i),
+			Count:     1,
+		}
+
+		call(r.Put, req, &PutRes{})
+	}
+
+	call(r.Inc, &IncReq{
+		Database:  "cluster",
+		Fields:    []string{"host", "h1"},
+		Timestamp: now,
+		Value:     100,
+		Count:     1,
+	}, &IncRes{})
+
+	// series should be spread across nodes
+	for i, n := range nodes {
+		res, err := n.get(&GetReq{
+			Database:  "cluster",
+			Fields:    []string{"host", ""},
+			GroupBy:   []bool{true, true},
+			StartTime: now,
+			EndTime:   now + 60,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Groups) == 0 {
+			t.Fatal("node has no series", i)
+		}
+	}
+
+	res := &GetRes{}
+	call(r.Get, &GetReq{
+		Database:  "cluster",
+		Fields:    []string{"host", ""},
+		GroupBy:   []bool{true, false},
+		StartTime: now,
+		EndTime:   now + 60,
+	}, res)
+
+	// 0 + 1 + ... + 29 and an increment of 100
+	if len(res.Groups) != 1 || res.Groups[0].Points[0].Value != 535 || res.Groups[0].Points[0].Count != 31 {
+		t.Fatal("incorrect merged result", res.Groups)
+	}
+
+	res = &GetRes{}
+	call(r.Get, &GetReq{
+		Database:  "cluster",
+		Fields:    []string{"host", "h1"},
+		GroupBy:   []bool{true, true},
+		StartTime: now,
+		EndTime:   now + 60,
+	}, res)
+
+	if len(res.Groups) != 1 || res.Groups[0].Points[0].Value != 101 {
+		t.Fatal("incorrect result from owner", res.Groups)
+	}
+}
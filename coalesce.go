@@ -0,0 +1,268 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/kadirahq/kadiyadb"
+)
+
+const (
+	// DefaultIncBufferSize is the default number of points kept in the
+	// increment buffer before it's flushed
+	DefaultIncBufferSize = 10000
+)
+
+// incKey identifies a point of a series
+type incKey struct {
+	database  string
+	series    string
+	timestamp uint32
+}
+
+// incBuffer merges increments of the same point in memory until they are
+// written to databases. Queries add buffered values to results.
+type incBuffer struct {
+	mutex  sync.Mutex
+	points map[incKey]*IncReq
+	max    int
+	full   chan struct{}
+
+	// flushing has points which were taken by a flush and are not written
+	// yet. Queries add them to results like buffered points.
+	flushing map[incKey]*IncReq
+
+	// flushMutex allows one flush at a time
+	flushMutex sync.Mutex
+
+	// applyMutex is held while a point is written and removed from
+	// flushing so that queries do not miss it or count it twice.
+	applyMutex sync.RWMutex
+}
+
+func newIncBuffer(max int) (b *incBuffer) {
+	if max <= 0 {
+		max = DefaultIncBufferSize
+	}
+
+	return &incBuffer{
+		points:   make(map[incKey]*IncReq),
+		flushing: make(map[incKey]*IncReq),
+		max:      max,
+		full:     make(chan struct{}, 1),
+	}
+}
+
+// add merges an increment with the buffered point. The timestamp must be
+// the start of the point.
+func (b *incBuffer) add(req *IncReq, timestamp uint32) {
+	key := incKey{req.Database, seriesKey(req.Fields), timestamp}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if p, ok := b.points[key]; ok {
+		p.Value += req.Value
+		p.Count += req.Count
+		return
+	}
+
+	b.points[key] = &IncReq{
+		Database:  req.Database,
+		Fields:    req.Fields,
+		Timestamp: timestamp,
+		Value:     req.Value,
+		Count:     req.Count,
+	}
+
+	if len(b.points) >= b.max {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// take returns all buffered points and keeps them in flushing until
+// they are applied
+func (b *incBuffer) take() (points []*IncReq) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	points = make([]*IncReq, 0, len(b.points))
+	for _, p := range b.points {
+		points = append(points, p)
+	}
+
+	b.flushing = b.points
+	b.points = make(map[incKey]*IncReq)
+	return points
+}
+
+// applied removes a point taken by a flush after it's written
+func (b *incBuffer) applied(p *IncReq) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.flushing, incKey{p.Database, seriesKey(p.Fields), p.Timestamp})
+}
+
+// discard removes buffered points of a database
+func (b *incBuffer) discard(database string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, points := range []map[incKey]*IncReq{b.points, b.flushing} {
+		for key := range points {
+			if key.database == database {
+				delete(points, key)
+			}
+		}
+	}
+}
+
+// merge adds buffered points and points which are being flushed of a
+// database which match fields to query results from start to end. Series
+// which only have these points are added to results. Queries must hold
+// applyMutex for reading while they read the database and merge.
+func (b *incBuffer) merge(database string, fields []string, dataMap map[*kadiyadb.Item][][]byte, start, end, resolution int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.points) == 0 && len(b.flushing) == 0 {
+		return
+	}
+
+	series := make(map[string]*kadiyadb.Item, len(dataMap))
+	for item := range dataMap {
+		series[seriesKey(item.Fields)] = item
+	}
+
+	for _, points := range []map[incKey]*IncReq{b.flushing, b.points} {
+		b.mergePoints(points, database, fields, dataMap, series, start, end, resolution)
+	}
+}
+
+// mergePoints adds points of one map to query results
+func (b *incBuffer) mergePoints(points map[incKey]*IncReq, database string, fields []string, dataMap map[*kadiyadb.Item][][]byte, series map[string]*kadiyadb.Item, start, end, resolution int64) {
+	for key, p := range points {
+		ts := int64(p.Timestamp) * 1e9
+		if key.database != database || ts < start || ts >= end || !matchFields(fields, p.Fields) {
+			continue
+		}
+
+		item, ok := series[key.series]
+		if !ok {
+			item = &kadiyadb.Item{Fields: p.Fields}
+			plds := make([][]byte, (end-start)/resolution)
+			for i := range plds {
+				plds[i] = valToPld(0, 0)
+			}
+
+			dataMap[item] = plds
+			series[key.series] = item
+		}
+
+		plds := dataMap[item]
+		i := (ts - start) / resolution
+		if i >= int64(len(plds)) {
+			continue
+		}
+
+		// payloads can be shared with the database so they are replaced
+		val, num := pldToVal(plds[i])
+		plds[i] = valToPld(val+p.Value, num+p.Count)
+	}
+}
+
+// matchFields checks whether fields match a filter where empty strings
+// match any value
+func matchFields(filter, fields []string) (ok bool) {
+	if len(filter) != len(fields) {
+		return false
+	}
+
+	for i, f := range filter {
+		if f != "" && f != fields[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bufferInc adds an increment to the increment buffer. It's checked like
+// a write so it's not accepted when it cannot be written later.
+func (s *server) bufferInc(req *IncReq) (err error) {
+	if err := s.checkWrite(req.Database, req.Timestamp); err != nil {
+		return err
+	}
+
+	db, ok := s.database(req.Database)
+	if !ok {
+		return goerr.Wrap(ErrDatabase, 0)
+	}
+
+	metadata, err := db.Info()
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	resolution := uint32(metadata.Resolution / 1e9)
+	timestamp := req.Timestamp - req.Timestamp%resolution
+	s.incs.add(req, timestamp)
+	s.invalidateCache(req.Database, req.Fields, timestamp)
+	return nil
+}
+
+// flushIncs writes buffered increments to databases. Increments are
+// checked when they are buffered so points only fail when their epoch
+// was closed or their database was removed since then. These are logged
+// and dropped. Queries wait for one point at a time.
+func (s *server) flushIncs() (err error) {
+	if s.incs == nil {
+		return nil
+	}
+
+	defer Logger.Time(time.Now(), time.Second, "server.flushIncs")
+
+	s.incs.flushMutex.Lock()
+	defer s.incs.flushMutex.Unlock()
+
+	for _, req := range s.incs.take() {
+		s.incs.applyMutex.Lock()
+		_, ierr := s.applyInc(req)
+		s.incs.applied(req)
+		s.incs.applyMutex.Unlock()
+
+		if ierr != nil {
+			Logger.Error(ierr, req.Database)
+			if err == nil {
+				err = ierr
+			}
+		}
+	}
+
+	return err
+}
+
+// flushIncsEvery flushes buffered increments every interval and when the
+// buffer is full
+func (s *server) flushIncsEvery(d time.Duration) {
+	tick := time.NewTicker(d)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+		case <-s.incs.full:
+		}
+
+		if s.closing() {
+			return
+		}
+
+		s.flushIncs()
+	}
+}
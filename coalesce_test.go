@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+func TestIncBuffer(t *testing.T) {
+	options := &Options{Path: "/tmp/d-coalesce", IncFlush: time.Hour, IncBufferSize: 3, Databases: []*OpenReq{testOpenReq("test")}}
+	s := newTestServer(t, options)
+	now := uint32(time.Now().Unix())
+	now -= now % 60
+
+	inc := func(field string, ts uint32) {
+		req := &IncReq{Database: "test", Fields: []string{field}, Timestamp: ts, Value: 2, Count: 1}
+		if _, err := s.inc(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored := func(field string) (val float64, num uint32) {
+		db, _ := s.database("test")
+		data, err := db.One(int64(now)*1e9, int64(now+60)*1e9, []string{field})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return pldToVal(data[0])
+	}
+
+	query := func() map[string]*ResPoint {
+		res, err := s.get(&GetReq{Database: "test", Fields: []string{""}, GroupBy: []bool{true}, StartTime: now, EndTime: now + 60})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		points := make(map[string]*ResPoint)
+		for _, sr := range res.Groups {
+			points[sr.Fields[0]] = sr.Points[0]
+		}
+
+		return points
+	}
+
+	for i := 0; i < 4; i++ {
+		inc("a", now+uint32(i))
+	}
+
+	inc("b", now)
+
+	if _, num := stored("a"); num != 0 {
+		t.Fatal("increments should be buffered", num)
+	}
+
+	points := query()
+	if p := points["a"]; p == nil || p.Value != 8 || p.Count != 4 {
+		t.Fatal("queries should include buffered increments", p)
+	}
+
+	if p := points["b"]; p == nil || p.Value != 2 || p.Count != 1 {
+		t.Fatal("queries should include buffered series", p)
+	}
+
+	// the buffer is flushed when it has IncBufferSize points
+	inc("c", now)
+	for i := 0; ; i++ {
+		if _, num := stored("a"); num == 4 {
+			break
+		} else if i == 100 {
+			t.Fatal("full buffer should be flushed")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	inc("a", now)
+	points = query()
+	if p := points["a"]; p == nil || p.Value != 10 || p.Count != 5 {
+		t.Fatal("buffered increments should be added to stored points", p)
+	}
+
+	// points taken by a flush are added to results until they are written
+	inc("d", now)
+	taken := s.incs.take()
+	if p := query()["d"]; p == nil || p.Count != 1 {
+		t.Fatal("points which are being flushed should be in results", p)
+	}
+
+	for _, req := range taken {
+		if _, err := s.applyInc(req); err != nil {
+			t.Fatal(err)
+		}
+
+		s.incs.applied(req)
+	}
+
+	if p := query()["d"]; p == nil || p.Count != 1 {
+		t.Fatal("flushed points should be counted once", p)
+	}
+
+	// increments are checked before they are buffered
+	old := &IncReq{Database: "test", Fields: []string{"a"}, Timestamp: now - 36000, Value: 1, Count: 1}
+	if _, err := s.inc(old); !goerr.Is(err, ErrWriteTime) {
+		t.Fatal("increments outside read-write epochs should be rejected", err)
+	}
+
+	closeTestServer(t, s)
+
+	s = openTestServer(t, &Options{Path: options.Path})
+	if val, num := stored("a"); val != 10 || num != 5 {
+		t.Fatal("buffered increments should be written on close", val, num)
+	}
+
+	closeTestServer(t, s)
+}
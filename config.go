@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/kadirahq/go-tools/logger"
+)
+
+const (
+	// LogInfo logs all messages
+	LogInfo = "info"
+
+	// LogError only logs errors and slow operations
+	LogError = "error"
+)
+
+var (
+	// ErrLogLevel is returned when the log level is unknown
+	ErrLogLevel = errors.New("invalid log level")
+)
+
+// Config has all server settings. It's read from the file given with
+// -config and flags which are set override values from the file. Rate
+// limits, logging and databases are applied again on SIGHUP.
+type Config struct {
+	Address      string   `json:"address"`
+	Data         string   `json:"data"`
+	Recovery     bool     `json:"recovery"`
+	Quarantine   bool     `json:"quarantine"`
+	BackupRoot   string   `json:"backupRoot"`
+	PPROFAddress string   `json:"pprofAddress"`
+	SegmentSize  uint32   `json:"segmentSize"`
+	Shutdown     Duration `json:"shutdownTimeout"`
+
+	StatsdAddress  string           `json:"statsdAddress"`
+	StatsdFlush    Duration         `json:"statsdFlush"`
+	StatsdMappings []*StatsdMapping `json:"statsdMappings"`
+
+	HTTPAddress    string           `json:"httpAddress"`
+	InfluxMappings []*InfluxMapping `json:"influxMappings"`
+	PromMappings   []*PromMapping   `json:"promMappings"`
+
+	AlertRules    []*AlertRule `json:"alertRules"`
+	AlertInterval Duration     `json:"alertInterval"`
+	AlertWebhook  string       `json:"alertWebhook"`
+
+	WALPolicy     string   `json:"wal"`
+	WALInterval   Duration `json:"walInterval"`
+	WALCheckpoint Duration `json:"walCheckpoint"`
+
+	IncFlush      Duration `json:"incFlush"`
+	IncBufferSize int      `json:"incBufferSize"`
+
+	QueryCacheSize int `json:"queryCache"`
+
+	// QueryLimit has default query limits and QueryLimits has limits of
+	// databases (see QueryLimit)
+	QueryLimit  QueryLimit    `json:"queryLimit"`
+	QueryLimits []*QueryLimit `json:"queryLimits"`
+
+	Replication bool     `json:"replication"`
+	Follow      string   `json:"follow"`
+	FollowerID  string   `json:"followerId"`
+	FollowToken string   `json:"followToken"`
+	Cluster     []string `json:"cluster"`
+
+	ACLs        []*ACL `json:"acls"`
+	TLSCert     string `json:"tlsCert"`
+	TLSKey      string `json:"tlsKey"`
+	TLSClientCA string `json:"tlsClientCA"`
+	PeerTLSCA   string `json:"peerTlsCA"`
+	PeerTLSCert string `json:"peerTlsCert"`
+	PeerTLSKey  string `json:"peerTlsKey"`
+
+	RateLimits []*RateLimit `json:"rateLimits"`
+	Databases  []*OpenReq   `json:"databases"`
+	Prune      bool         `json:"pruneDatabases"`
+	Log        *LogConfig   `json:"log"`
+}
+
+// LogConfig sets the log level and the log file. The file is opened
+// again on SIGHUP so it can be rotated.
+type LogConfig struct {
+	Level string `json:"level"`
+	File  string `json:"file"`
+}
+
+func defaultConfig() (c *Config) {
+	return &Config{
+		Address:       DefaultAddr,
+		Data:          DefaultData,
+		PPROFAddress:  PPROFAddr,
+		SegmentSize:   SegSize,
+		Shutdown:      Duration(DefaultShutdownTimeout),
+		StatsdFlush:   Duration(DefaultStatsdFlush),
+		AlertInterval: Duration(DefaultAlertInterval),
+		WALCheckpoint: Duration(DefaultWALCheckpoint),
+		Log:           &LogConfig{Level: LogInfo},
+	}
+}
+
+// configFiles has paths of files given with flags. Values in these files
+// replace values of the config file.
+type configFiles struct {
+	config string
+	statsd string
+	influx string
+	prom   string
+	alerts string
+	acl    string
+	limits string
+}
+
+// flagSet creates flags which set values of the config
+func (c *Config) flagSet() (fs *flag.FlagSet, files *configFiles) {
+	fs = flag.NewFlagSet("kadiradb", flag.ContinueOnError)
+	files = &configFiles{}
+
+	fs.StringVar(&files.config, "config", "", "config file")
+	fs.StringVar(&c.Address, "addr", c.Address, "server address")
+	fs.StringVar(&c.Data, "data", c.Data, "data to store data files")
+	fs.BoolVar(&c.Recovery, "recv", c.Recovery, "enable recovery")
+	fs.BoolVar(&c.Quarantine, "quarantine", c.Quarantine, "move databases which fail to load to the quarantine directory")
+	fs.StringVar(&c.BackupRoot, "backup-root", c.BackupRoot, "directory for backups written by the server (empty to disable)")
+	fs.StringVar(&c.PPROFAddress, "pprof", c.PPROFAddress, "pprof address (empty to disable)")
+	fs.Var(&c.Shutdown, "shutdown-timeout", "time to wait for requests when shutting down")
+	fs.StringVar(&c.StatsdAddress, "statsd", c.StatsdAddress, "statsd udp address")
+	fs.StringVar(&files.statsd, "statsd-conf", "", "statsd mappings file")
+	fs.Var(&c.StatsdFlush, "statsd-flush", "statsd flush interval")
+	fs.StringVar(&c.HTTPAddress, "http", c.HTTPAddress, "http ingestion address")
+	fs.StringVar(&files.influx, "influx-conf", "", "influx line protocol mappings file")
+	fs.StringVar(&files.prom, "prom-conf", "", "prometheus remote_write mappings file")
+	fs.StringVar(&files.alerts, "alerts", "", "alert rules file")
+	fs.StringVar(&c.AlertWebhook, "alert-webhook", c.AlertWebhook, "default alert webhook url")
+	fs.Var(&c.AlertInterval, "alert-interval", "alert evaluation interval")
+	fs.StringVar(&c.WALPolicy, "wal", c.WALPolicy, "write-ahead log sync policy (always, batch or interval)")
+	fs.Var(&c.WALInterval, "wal-interval", "write-ahead log sync interval")
+	fs.Var(&c.WALCheckpoint, "wal-checkpoint", "write-ahead log checkpoint interval")
+	fs.Var(&c.IncFlush, "inc-flush", "merge increments in memory and write them at this interval")
+	fs.IntVar(&c.IncBufferSize, "inc-buffer", c.IncBufferSize, "number of buffered increment points which triggers a write")
+	fs.IntVar(&c.QueryCacheSize, "query-cache", c.QueryCacheSize, "number of query results cached for read-only epochs")
+	fs.IntVar(&c.QueryLimit.MaxPoints, "query-max-points", c.QueryLimit.MaxPoints, "maximum points of each series in a query range")
+	fs.IntVar(&c.QueryLimit.MaxSeries, "query-max-series", c.QueryLimit.MaxSeries, "maximum series read by a query")
+	fs.IntVar(&c.QueryLimit.MaxGroups, "query-max-groups", c.QueryLimit.MaxGroups, "maximum series returned by a query")
+	fs.Var(&c.QueryLimit.Timeout, "query-timeout", "maximum time a query runs")
+	fs.BoolVar(&c.Replication, "repl", c.Replication, "keep a replication log for followers")
+	fs.StringVar(&c.Follow, "follow", c.Follow, "primary address to replicate from")
+	fs.StringVar(&c.FollowerID, "follower-id", c.FollowerID, "follower name reported to the primary")
+	fs.Var((*stringList)(&c.Cluster), "cluster", "comma separated node addresses to run as a router")
+	fs.StringVar(&files.acl, "acl", "", "access control list file")
+	fs.StringVar(&c.FollowToken, "follow-token", c.FollowToken, "token sent to the primary by followers")
+	fs.StringVar(&files.limits, "limits", "", "rate limits file")
+	fs.StringVar(&c.TLSCert, "tls-cert", c.TLSCert, "tls certificate file")
+	fs.StringVar(&c.TLSKey, "tls-key", c.TLSKey, "tls private key file")
+	fs.StringVar(&c.TLSClientCA, "tls-client-ca", c.TLSClientCA, "CA file to verify client certificates")
+	fs.StringVar(&c.PeerTLSCA, "peer-tls-ca", c.PeerTLSCA, "CA file to verify the primary and cluster nodes (enables tls)")
+	fs.StringVar(&c.PeerTLSCert, "peer-tls-cert", c.PeerTLSCert, "certificate file sent to the primary and cluster nodes")
+	fs.StringVar(&c.PeerTLSKey, "peer-tls-key", c.PeerTLSKey, "private key file sent to the primary and cluster nodes")
+	fs.BoolVar(&c.Prune, "prune", c.Prune, "drop databases which are not defined in the config or init file")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "log level (info or error)")
+	fs.StringVar(&c.Log.File, "log-file", c.Log.File, "log file (default: stderr)")
+
+	return fs, files
+}
+
+// loadConfig reads the config file and files given with args. Flags are
+// parsed again after reading the config file so that they override it.
+func loadConfig(args []string) (c *Config, err error) {
+	c = defaultConfig()
+	fs, files := c.flagSet()
+	if err := fs.Parse(args); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if files.config != "" {
+		c = defaultConfig()
+		if err := readJSON(files.config, c); err != nil {
+			return nil, err
+		}
+
+		if c.Log == nil {
+			c.Log = &LogConfig{Level: LogInfo}
+		}
+
+		fs, files = c.flagSet()
+		if err := fs.Parse(args); err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+	}
+
+	sources := []struct {
+		fpath string
+		value interface{}
+	}{
+		{files.statsd, &c.StatsdMappings},
+		{files.influx, &c.InfluxMappings},
+		{files.prom, &c.PromMappings},
+		{files.alerts, &c.AlertRules},
+		{files.acl, &c.ACLs},
+		{files.limits, &c.RateLimits},
+	}
+
+	for _, src := range sources {
+		if src.fpath == "" {
+			continue
+		}
+
+		if err := readJSON(src.fpath, src.value); err != nil {
+			return nil, err
+		}
+	}
+
+	// databases in the init file are opened with databases in the config.
+	// A file which cannot be read fails so databases are not pruned.
+	var dbs []*OpenReq
+	ipath := path.Join(c.Data, InitFile)
+	if _, err := os.Stat(ipath); err == nil {
+		if err := readJSON(ipath, &dbs); err != nil {
+			return nil, err
+		}
+
+		c.Databases = append(c.Databases, dbs...)
+	} else if !os.IsNotExist(err) {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return c, nil
+}
+
+// options returns server options for the config
+func (c *Config) options() (options *Options) {
+	return &Options{
+		Path:            c.Data,
+		Address:         c.Address,
+		Recovery:        c.Recovery,
+		Quarantine:      c.Quarantine,
+		BackupRoot:      c.BackupRoot,
+		SegmentSize:     c.SegmentSize,
+		ShutdownTimeout: time.Duration(c.Shutdown),
+		StatsdAddress:   c.StatsdAddress,
+		StatsdFlush:     time.Duration(c.StatsdFlush),
+		StatsdMappings:  c.StatsdMappings,
+		HTTPAddress:     c.HTTPAddress,
+		InfluxMappings:  c.InfluxMappings,
+		PromMappings:    c.PromMappings,
+		AlertRules:      c.AlertRules,
+		AlertInterval:   time.Duration(c.AlertInterval),
+		AlertWebhook:    c.AlertWebhook,
+		WALPolicy:       c.WALPolicy,
+		WALInterval:     time.Duration(c.WALInterval),
+		WALCheckpoint:   time.Duration(c.WALCheckpoint),
+		IncFlush:        time.Duration(c.IncFlush),
+		IncBufferSize:   c.IncBufferSize,
+		QueryCacheSize:  c.QueryCacheSize,
+		QueryLimits:     c.queryLimits(),
+		Replication:     c.Replication,
+		Follow:          c.Follow,
+		FollowerID:      c.FollowerID,
+		Cluster:         c.Cluster,
+		ACLs:            c.ACLs,
+		FollowToken:     c.FollowToken,
+		TLSCert:         c.TLSCert,
+		TLSKey:          c.TLSKey,
+		TLSClientCA:     c.TLSClientCA,
+		PeerTLSCA:       c.PeerTLSCA,
+		PeerTLSCert:     c.PeerTLSCert,
+		PeerTLSKey:      c.PeerTLSKey,
+		RateLimits:      c.RateLimits,
+		Databases:       c.Databases,
+		PruneDatabases:  c.Prune,
+	}
+}
+
+// queryLimits returns query limits with defaults set by flags
+func (c *Config) queryLimits() (limits []*QueryLimit) {
+	defaults := c.QueryLimit
+	defaults.Database = ""
+
+	limits = append(limits, c.QueryLimits...)
+	return append(limits, &defaults)
+}
+
+// readJSON reads a json file into v
+func readJSON(fpath string, v interface{}) (err error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return goerr.Errorf("%s: %s", fpath, err)
+	}
+
+	return nil
+}
+
+// Duration is a time.Duration which is written as a string ("10s") in
+// config files
+type Duration time.Duration
+
+// Set parses a duration flag
+func (d *Duration) Set(str string) (err error) {
+	v, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+func (d *Duration) String() (str string) {
+	return time.Duration(*d).String()
+}
+
+// UnmarshalJSON reads a duration string
+func (d *Duration) UnmarshalJSON(data []byte) (err error) {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+
+	return d.Set(str)
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() (data []byte, err error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// stringList is a comma separated list flag
+type stringList []string
+
+func (l *stringList) Set(str string) (err error) {
+	*l = strings.Split(str, ",")
+	return nil
+}
+
+func (l *stringList) String() (str string) {
+	return strings.Join(*l, ",")
+}
+
+// levelLogger skips info messages when the log level is LogError
+type levelLogger struct {
+	*logger.Logger
+	quiet int32
+}
+
+// Info logs a message unless the log level is LogError
+func (l *levelLogger) Info(args ...interface{}) {
+	if atomic.LoadInt32(&l.quiet) == 0 {
+		l.Logger.Info(args...)
+	}
+}
+
+// Print logs a message unless the log level is LogError
+func (l *levelLogger) Print(args ...interface{}) {
+	if atomic.LoadInt32(&l.quiet) == 0 {
+		l.Logger.Print(args...)
+	}
+}
+
+var (
+	logMutex sync.Mutex
+	logFile  *os.File
+)
+
+// configureLogging sets the log level and opens the log file
+func configureLogging(c *LogConfig) (err error) {
+	var quiet int32
+	switch c.Level {
+	case LogInfo, "":
+	case LogError:
+		quiet = 1
+	default:
+		return goerr.Wrap(ErrLogLevel, 0)
+	}
+
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	var file *os.File
+	if c.File != "" {
+		file, err = os.OpenFile(c.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		log.SetOutput(file)
+	} else {
+		log.SetOutput(os.Stderr)
+	}
+
+	if logFile != nil {
+		logFile.Close()
+	}
+
+	logFile = file
+	atomic.StoreInt32(&Logger.quiet, quiet)
+
+	return nil
+}
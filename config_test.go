@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := "/tmp/d-config"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := `{
+		"address": ":19100",
+		"data": "` + dir + `",
+		"pprofAddress": "",
+		"statsdFlush": "5s",
+		"rateLimits": [{"database": "*", "writes": 10}],
+		"databases": [{"database": "from-config", "resolution": 60}],
+		"log": {"level": "error"}
+	}`
+
+	fpath := path.Join(dir, "config.json")
+	if err := ioutil.WriteFile(fpath, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	initData := `[{"database": "from-init", "resolution": 60}]`
+	if err := ioutil.WriteFile(path.Join(dir, InitFile), []byte(initData), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadConfig([]string{"-config", fpath, "-addr", ":19200", "-wal-interval", "2s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Address != ":19200" {
+		t.Fatal("flags should override the config file", c.Address)
+	}
+
+	if c.Data != dir || c.PPROFAddress != "" || c.Log.Level != LogError {
+		t.Fatal("values should be read from the config file", c)
+	}
+
+	if time.Duration(c.StatsdFlush) != 5*time.Second || time.Duration(c.WALInterval) != 2*time.Second {
+		t.Fatal("durations should be parsed", c.StatsdFlush, c.WALInterval)
+	}
+
+	if time.Duration(c.AlertInterval) != DefaultAlertInterval || c.SegmentSize != SegSize {
+		t.Fatal("missing values should have defaults")
+	}
+
+	if len(c.RateLimits) != 1 || c.RateLimits[0].Writes != 10 {
+		t.Fatal("rate limits should be read", c.RateLimits)
+	}
+
+	if len(c.Databases) != 2 || c.Databases[0].Database != "from-config" || c.Databases[1].Database != "from-init" {
+		t.Fatal("databases should be read from the config and the init file", c.Databases)
+	}
+
+	if _, err := loadConfig([]string{"-config", path.Join(dir, "missing.json")}); err == nil {
+		t.Fatal("missing config files should fail")
+	}
+
+	// databases of an init file which cannot be parsed would be pruned
+	if err := ioutil.WriteFile(path.Join(dir, InitFile), []byte(`[{"database": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadConfig([]string{"-config", fpath}); err == nil {
+		t.Fatal("invalid init files should fail")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := "/tmp/d-reload"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	db := &OpenReq{
+		Database:    "reloaded",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	}
+
+	options := &Options{Path: dir, Databases: []*OpenReq{db}}
+	srv, err := NewServer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	if _, ok := s.database("reloaded"); !ok {
+		t.Fatal("databases should be created on start")
+	}
+
+	put := &PutReq{Database: "reloaded", Fields: []string{"a"}, Timestamp: uint32(time.Now().Unix()), Value: 1, Count: 1}
+	reqData, err := proto.Marshal(put)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Put(reqData); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	created := &OpenReq{
+		Database:    "reloaded-2",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	}
+
+	err = s.Reload(&Options{
+		Databases:  []*OpenReq{db, created},
+		RateLimits: []*RateLimit{{Database: "reloaded", Writes: 1}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.database("reloaded-2"); !ok {
+		t.Fatal("new databases should be created on reload")
+	}
+
+	if _, err := s.Put(reqData); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Put(reqData); !goerr.Is(err, ErrRateLimit) {
+		t.Fatal("rate limits should be applied on reload", err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// DefaultExportChunk is the default time range of each get request
+	// used when exporting a database (in seconds).
+	DefaultExportChunk = 3600
+)
+
+// exportRows writes all points of matching series from start to end.
+// The range is read in chunks to limit the size of each response.
+func exportRows(call caller, database string, fields []string, start, end, chunk uint32, w rowWriter) (n int, err error) {
+	info := &InfoRes{}
+	if err := call("info", &InfoReq{}, info); err != nil {
+		return 0, err
+	}
+
+	var resolution uint32
+	for _, dbi := range info.Databases {
+		if dbi.Database == database {
+			resolution = dbi.Resolution
+		}
+	}
+
+	if resolution == 0 {
+		return 0, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	start -= start % resolution
+	if chunk < resolution {
+		chunk = resolution
+	}
+
+	chunk -= chunk % resolution
+
+	groupBy := make([]bool, len(fields))
+	for i := range groupBy {
+		groupBy[i] = true
+	}
+
+	for from := start; from < end; from += chunk {
+		to := from + chunk
+		if to > end {
+			to = end
+		}
+
+		req := &GetReq{
+			Database:  database,
+			Fields:    fields,
+			GroupBy:   groupBy,
+			StartTime: from,
+			EndTime:   to,
+		}
+
+		res := &GetRes{}
+		if err := call("get", req, res); err != nil {
+			return n, err
+		}
+
+		// sort series to make the output stable
+		sort.Sort(seriesByFields(res.Groups))
+
+		for _, sr := range res.Groups {
+			for i, p := range sr.Points {
+				if p.Count == 0 {
+					continue
+				}
+
+				row := &Row{
+					Fields:    sr.Fields,
+					Timestamp: from + uint32(i)*resolution,
+					Value:     p.Value,
+					Count:     p.Count,
+				}
+
+				if err := w.write(row); err != nil {
+					return n, err
+				}
+
+				n++
+			}
+		}
+	}
+
+	return n, w.flush()
+}
+
+type seriesByFields []*ResSeries
+
+func (s seriesByFields) Len() int      { return len(s) }
+func (s seriesByFields) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s seriesByFields) Less(i, j int) bool {
+	return strings.Join(s[i].Fields, "\x00") < strings.Join(s[j].Fields, "\x00")
+}
+
+// parseFieldFilter splits a comma separated field filter. Empty values
+// and "*" match any value. The number of values must match the number
+// of fields the series were written with.
+func parseFieldFilter(filter string) (fields []string) {
+	fields = strings.Split(filter, ",")
+	for i, f := range fields {
+		if f == "*" {
+			fields[i] = ""
+		}
+	}
+
+	return fields
+}
+
+// exportCommand writes points of a database as csv or json lines
+func exportCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	addr := fs.String("addr", DefaultAddr, "server address")
+	token := fs.String("token", "", "authentication token")
+	secure := newTLSFlags(fs)
+	database := fs.String("database", "", "database name")
+	filter := fs.String("fields", "*", "comma separated fields, use * to match any value")
+	start := fs.Int64("start", 0, "start time in unix seconds (default: 24 hours ago)")
+	end := fs.Int64("end", 0, "end time in unix seconds (default: now)")
+	chunk := fs.Uint("chunk", DefaultExportChunk, "seconds of data to read with each request")
+	format := fs.String("format", FormatCSV, "output format (csv or jsonl)")
+	out := fs.String("out", "-", "output file")
+	fs.Parse(args)
+
+	if *database == "" {
+		return goerr.Wrap(ErrUsage, 0)
+	}
+
+	if *end == 0 {
+		*end = time.Now().Unix()
+	}
+
+	if *start == 0 {
+		*start = *end - 24*3600
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		defer file.Close()
+		w = file
+	}
+
+	rw, err := newRowWriter(*format, w)
+	if err != nil {
+		return err
+	}
+
+	conn, err := secure.dial(*addr, *token)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	call := conn.call
+
+	fields := parseFieldFilter(*filter)
+	n, err := exportRows(call, *database, fields, uint32(*start), uint32(*end), uint32(*chunk), rw)
+	if err != nil {
+		return err
+	}
+
+	Logger.Info("export: wrote", n, "rows")
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+)
+
+// localCaller calls server handlers without a network connection
+func localCaller(s Server) caller {
+	handlers := map[string]func([]byte) ([]byte, error){
+		"info":    s.Info,
+		"get":     s.Get,
+		"batch":   s.Batch,
+		"metrics": s.Metrics,
+	}
+
+	return func(method string, req, res proto.Message) error {
+		reqData, err := proto.Marshal(req)
+		if err != nil {
+			return err
+		}
+
+		resData, err := handlers[method](reqData)
+		if err != nil {
+			return err
+		}
+
+		return proto.Unmarshal(resData, res)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	dir := "/tmp/d-export"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	for _, name := range []string{"export", "import"} {
+		_, err = s.open(&OpenReq{
+			Database:    name,
+			Resolution:  60,
+			Retention:   36000,
+			EpochTime:   3600,
+			MaxROEpochs: 2,
+			MaxRWEpochs: 2,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := uint32(1000 * 3600)
+	rows := []*Row{
+		{Fields: []string{"a", "x"}, Timestamp: start, Value: 1.5, Count: 1},
+		{Fields: []string{"a", "x"}, Timestamp: start + 3600, Value: 2, Count: 2},
+		{Fields: []string{"b", "y"}, Timestamp: start + 60, Value: 3, Count: 1},
+	}
+
+	for _, row := range rows {
+		req := &PutReq{Database: "export", Fields: row.Fields, Timestamp: row.Timestamp, Value: row.Value, Count: row.Count}
+		if _, err := s.put(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	call := localCaller(srv)
+	export := func(database, format string) string {
+		buff := bytes.NewBuffer(nil)
+		w, err := newRowWriter(format, buff)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := exportRows(call, database, parseFieldFilter("*,*"), start, start+7200, 1800, w)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != len(rows) {
+			t.Fatal("incorrect number of rows", n)
+		}
+
+		return buff.String()
+	}
+
+	csv := export("export", FormatCSV)
+	expected := "field0,field1,timestamp,value,count\n" +
+		"a,x,3600000,1.5,1\n" +
+		"b,y,3600060,3,1\n" +
+		"a,x,3603600,2,2\n"
+
+	if csv != expected {
+		t.Fatal("incorrect csv", csv)
+	}
+
+	jsonl := export("export", FormatJSONL)
+
+	// fail after the first batch and resume from the saved progress
+	var saved int
+	failing := func(method string, req, res proto.Message) error {
+		if saved > 0 {
+			return errors.New("connection lost")
+		}
+
+		return call(method, req, res)
+	}
+
+	done := func(n int) error {
+		saved = n
+		return nil
+	}
+
+	r, _ := newRowReader(FormatJSONL, strings.NewReader(jsonl))
+	if _, err := importRows(failing, "import", "inc", r, 0, 10, done); err == nil {
+		t.Fatal("import should fail")
+	}
+
+	if saved != 1 {
+		t.Fatal("incorrect progress", saved)
+	}
+
+	r, _ = newRowReader(FormatJSONL, strings.NewReader(jsonl))
+	n, err := importRows(call, "import", "inc", r, saved, 10, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(rows) {
+		t.Fatal("incorrect number of rows", n)
+	}
+
+	if csv := export("import", FormatCSV); csv != expected {
+		t.Fatal("incorrect data after import", csv)
+	}
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/kadirahq/kadiyadb"
+)
+
+const (
+	// EpochIndexFile is the index file in kadiyadb epoch directories. All
+	// other files in an epoch directory are segment files.
+	EpochIndexFile = "index"
+
+	// MetadataFile is the file with kadiyadb database options
+	MetadataFile = "metadata"
+
+	// LostFoundDir has data which was removed by fsck -repair. It's hidden
+	// so it's not loaded as a database.
+	LostFoundDir = ".lost+found"
+)
+
+var (
+	// ErrFsck is returned when fsck finds problems which were not repaired
+	ErrFsck = errors.New("data directory has problems which were not repaired")
+)
+
+// fsckProblem is a problem found by fsck. Action is set when it's
+// repaired and describes what was changed or dropped.
+type fsckProblem struct {
+	Database string
+	Problem  string
+	Action   string
+}
+
+func (p *fsckProblem) String() (str string) {
+	str = p.Database + ": " + p.Problem
+	if p.Action != "" {
+		str += " (repaired: " + p.Action + ")"
+	}
+
+	return str
+}
+
+// fsck checks databases in a data directory while the server is not
+// running. With repair it fixes what it can without losing points which
+// are readable.
+type fsck struct {
+	dir      string
+	repair   bool
+	out      io.Writer
+	problems []*fsckProblem
+}
+
+// report records and prints a problem
+func (f *fsck) report(database, problem, action string) {
+	p := &fsckProblem{Database: database, Problem: problem, Action: action}
+	f.problems = append(f.problems, p)
+	fmt.Fprintln(f.out, p)
+}
+
+// unrepaired returns the number of problems which were not repaired
+func (f *fsck) unrepaired() (n int) {
+	for _, p := range f.problems {
+		if p.Action == "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// run checks all databases and the write-ahead log
+func (f *fsck) run() (err error) {
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	for _, finfo := range files {
+		fname := finfo.Name()
+		if fname == InitFile || !finfo.IsDir() || strings.HasPrefix(fname, ".") {
+			continue
+		}
+
+		f.checkDatabase(fname)
+	}
+
+	return f.checkWAL(path.Join(f.dir, WALFile))
+}
+
+// checkDatabase checks metadata, segment files, the series index and
+// read-write epochs of a database. Segments are checked before the
+// database is opened. Without repair a copy of the database is opened so
+// nothing in the data directory is changed.
+func (f *fsck) checkDatabase(name string) {
+	dbPath := path.Join(f.dir, name)
+
+	metadata, err := readMetadata(dbPath)
+	if err != nil {
+		f.report(name, "cannot read metadata: "+err.Error(), "")
+		return
+	}
+
+	if !f.checkMetadata(name, metadata) {
+		return
+	}
+
+	f.checkSegments(name, dbPath, metadata)
+
+	openPath := dbPath
+	if !f.repair {
+		tmp, err := ioutil.TempDir("", "kadiradb-fsck-")
+		if err != nil {
+			f.report(name, err.Error(), "")
+			return
+		}
+
+		defer os.RemoveAll(tmp)
+
+		openPath = path.Join(tmp, name)
+		if err := copyDir(dbPath, openPath); err != nil {
+			f.report(name, "cannot copy database: "+err.Error(), "")
+			return
+		}
+	}
+
+	db, err := kadiyadb.Open(openPath, false)
+	if err != nil {
+		if !f.repair {
+			f.report(name, "cannot open database: "+err.Error(), "")
+			return
+		}
+
+		db, err = kadiyadb.Open(openPath, true)
+		if err != nil {
+			f.report(name, "cannot open database: "+err.Error(), "")
+			return
+		}
+
+		f.report(name, "cannot open database without recovery", "opened with recovery")
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			Logger.Error(err)
+		}
+	}()
+
+	f.checkEpochs(name, db, metadata)
+	f.checkSeries(name, dbPath, db, metadata)
+}
+
+// readMetadata reads database options from a copy of the metadata file
+// so the database is not opened
+func readMetadata(dbPath string) (metadata *kadiyadb.Metadata, err error) {
+	tmp, err := ioutil.TempDir("", "kadiradb-fsck-")
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	if _, err := copyFile(path.Join(dbPath, MetadataFile), path.Join(tmp, MetadataFile)); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	db, err := kadiyadb.Open(tmp, false)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	defer db.Close()
+
+	metadata, err = db.Info()
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return metadata, nil
+}
+
+// copyDir copies all files in a directory
+func copyDir(src, dst string) (err error) {
+	err = filepath.Walk(src, func(fpath string, finfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, fpath)
+		if err != nil {
+			return err
+		}
+
+		if finfo.IsDir() {
+			return os.MkdirAll(path.Join(dst, rel), DataPerm)
+		}
+
+		_, err = copyFile(fpath, path.Join(dst, rel))
+		return err
+	})
+
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+// checkMetadata checks database options. Other checks depend on them so
+// they are skipped when metadata is invalid.
+func (f *fsck) checkMetadata(name string, metadata *kadiyadb.Metadata) (ok bool) {
+	switch {
+	case metadata.Resolution <= 0 || metadata.Duration <= 0:
+		f.report(name, "metadata: resolution and epoch time must be positive", "")
+	case metadata.Duration%metadata.Resolution != 0:
+		f.report(name, "metadata: epoch time is not a multiple of resolution", "")
+	case metadata.PayloadSize != PointSize:
+		f.report(name, fmt.Sprintf("metadata: payload size is %d, not %d", metadata.PayloadSize, PointSize), "")
+	case metadata.SegmentSize == 0:
+		f.report(name, "metadata: segment size is zero", "")
+	default:
+		return true
+	}
+
+	return false
+}
+
+// checkSegments finds segment files which are not the size of a segment.
+// Short files are padded with empty points and extra bytes are moved to
+// the lost+found directory.
+func (f *fsck) checkSegments(name, dbPath string, metadata *kadiyadb.Metadata) {
+	points := metadata.Duration / metadata.Resolution
+	segBytes := int64(metadata.SegmentSize) * points * int64(metadata.PayloadSize)
+
+	epochs, err := ioutil.ReadDir(dbPath)
+	if err != nil {
+		f.report(name, err.Error(), "")
+		return
+	}
+
+	for _, einfo := range epochs {
+		if !einfo.IsDir() {
+			continue
+		}
+
+		epochPath := path.Join(dbPath, einfo.Name())
+		files, err := ioutil.ReadDir(epochPath)
+		if err != nil {
+			f.report(name, err.Error(), "")
+			continue
+		}
+
+		for _, finfo := range files {
+			if finfo.IsDir() || finfo.Name() == EpochIndexFile {
+				continue
+			}
+
+			size := finfo.Size()
+			if size == segBytes {
+				continue
+			}
+
+			rel := path.Join(einfo.Name(), finfo.Name())
+			problem := fmt.Sprintf("segment %s is %d bytes, expected %d", rel, size, segBytes)
+			if !f.repair {
+				f.report(name, problem, "")
+				continue
+			}
+
+			action, err := f.resizeSegment(name, rel, size, segBytes)
+			if err != nil {
+				f.report(name, problem+": "+err.Error(), "")
+				continue
+			}
+
+			f.report(name, problem, action)
+		}
+	}
+}
+
+// resizeSegment pads or truncates a segment file to the segment size
+func (f *fsck) resizeSegment(name, rel string, size, segBytes int64) (action string, err error) {
+	fpath := path.Join(f.dir, name, rel)
+
+	if size > segBytes {
+		lost := path.Join(f.dir, LostFoundDir, name, rel)
+		if err := os.MkdirAll(path.Dir(lost), DataPerm); err != nil {
+			return "", goerr.Wrap(err, 0)
+		}
+
+		if _, err := copyFile(fpath, lost); err != nil {
+			return "", goerr.Wrap(err, 0)
+		}
+	}
+
+	if err := os.Truncate(fpath, segBytes); err != nil {
+		return "", goerr.Wrap(err, 0)
+	}
+
+	if size > segBytes {
+		return fmt.Sprintf("dropped %d bytes, original moved to %s", size-segBytes, LostFoundDir), nil
+	}
+
+	return fmt.Sprintf("padded %d bytes with empty points", segBytes-size), nil
+}
+
+// checkEpochs loads read-write epochs like the server does when it
+// starts. Corrupt epochs can only be reported.
+func (f *fsck) checkEpochs(name string, db kadiyadb.Database, metadata *kadiyadb.Metadata) {
+	now := time.Now().UnixNano()
+	fields := []string{`¯\_(ツ)_/¯`}
+
+	var i uint32
+	for i = 0; i < metadata.MaxRWEpochs; i++ {
+		start := now - int64(i)*metadata.Duration
+		start -= start % metadata.Duration
+
+		if _, err := db.One(start, start+metadata.Resolution, fields); err != nil {
+			epoch := time.Unix(0, start).UTC().Format(time.RFC3339)
+			f.report(name, "cannot load epoch "+epoch+": "+err.Error(), "")
+		}
+	}
+}
+
+// checkSeries finds series index entries which are corrupt or have no
+// points in the database. Series have an entry each time they are written
+// after a while and entries of series which were not written within
+// retention are expired like when the server loads the index. These are
+// not problems but they are removed when the index is rewritten.
+func (f *fsck) checkSeries(name, dbPath string, db kadiyadb.Database, metadata *kadiyadb.Metadata) {
+	if data, err := ioutil.ReadFile(path.Join(dbPath, SeriesLimitFile)); err == nil {
+		if err := json.Unmarshal(data, &seriesLimit{}); err != nil {
+			action := ""
+			if f.repair {
+				if err := os.Remove(path.Join(dbPath, SeriesLimitFile)); err != nil {
+					Logger.Error(err)
+				} else {
+					action = "removed the series limit"
+				}
+			}
+
+			f.report(name, "corrupt series limit file", action)
+		}
+	}
+
+	fpath := path.Join(dbPath, SeriesIndexFile)
+	file, err := os.Open(fpath)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		f.report(name, err.Error(), "")
+		return
+	}
+
+	now := time.Now().UnixNano()
+	start := now - metadata.Retention
+	start -= start % metadata.Resolution
+	end := now + metadata.Duration
+	min := seriesExpiry(now, metadata.Retention)
+
+	var corrupt int
+	latest := make(map[string]*seriesEntry)
+
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		entry := &seriesEntry{}
+		if err := json.Unmarshal(sc.Bytes(), entry); err != nil || len(entry.Fields) == 0 {
+			corrupt++
+			continue
+		}
+
+		key := seriesKey(entry.Fields)
+		if prev, ok := latest[key]; !ok || prev.Time < entry.Time {
+			latest[key] = entry
+		}
+	}
+
+	file.Close()
+	if err := sc.Err(); err != nil {
+		f.report(name, "cannot read series index: "+err.Error(), "")
+		return
+	}
+
+	var entries []*seriesEntry
+	var orphaned int
+	for _, entry := range latest {
+		switch {
+		case entry.Time < min:
+		case !hasPoints(db, start, end, entry.Fields):
+			orphaned++
+		default:
+			entries = append(entries, entry)
+		}
+	}
+
+	counts := []struct {
+		n    int
+		kind string
+	}{
+		{corrupt, "corrupt"},
+		{orphaned, "orphaned"},
+	}
+
+	var problems []string
+	for _, c := range counts {
+		if c.n > 0 {
+			problems = append(problems, fmt.Sprintf("%d %s", c.n, c.kind))
+		}
+	}
+
+	if len(problems) == 0 {
+		return
+	}
+
+	problem := "series index has " + strings.Join(problems, ", ") + " entries"
+	if !f.repair {
+		f.report(name, problem, "")
+		return
+	}
+
+	if err := writeSeriesIndex(fpath, entries); err != nil {
+		f.report(name, problem+": "+err.Error(), "")
+		return
+	}
+
+	f.report(name, problem, fmt.Sprintf("dropped %d entries, kept %d series", corrupt+orphaned, len(entries)))
+}
+
+// hasPoints checks whether a series has points in a time range
+func hasPoints(db kadiyadb.Database, start, end int64, fields []string) (ok bool) {
+	plds, err := db.One(start, end, fields)
+	if err != nil {
+		// keep entries which cannot be checked
+		return true
+	}
+
+	for _, pld := range plds {
+		if _, num := pldToVal(pld); num > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkWAL finds corrupt or partially written records in the write-ahead
+// log. Records after them are dropped when repairing like the server
+// does when it replays the log.
+func (f *fsck) checkWAL(fpath string) (err error) {
+	flag := os.O_RDONLY
+	if f.repair {
+		flag = os.O_RDWR
+	}
+
+	file, err := os.OpenFile(fpath, flag, 0)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	defer file.Close()
+
+	finfo, err := file.Stat()
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		_, size, err := readWALRecord(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			break
+		}
+
+		offset += size
+	}
+
+	problem := fmt.Sprintf("invalid record at offset %d", offset)
+	if !f.repair {
+		f.report(WALFile, problem, "")
+		return nil
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	f.report(WALFile, problem, fmt.Sprintf("dropped the last %d bytes", finfo.Size()-offset))
+	return nil
+}
+
+// fsckCommand checks a data directory. The server must not be running.
+func fsckCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "repair problems which can be repaired")
+	fs.Parse(args)
+
+	// flags can also be given after the path
+	dir := DefaultData
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+
+	if fs.NArg() > 0 {
+		return goerr.Wrap(ErrUsage, 0)
+	}
+
+	f := &fsck{dir: dir, repair: *repair, out: os.Stdout}
+	if err := f.run(); err != nil {
+		return err
+	}
+
+	if len(f.problems) == 0 {
+		fmt.Println("no problems found")
+		return nil
+	}
+
+	n := f.unrepaired()
+	fmt.Println(len(f.problems), "problems found,", len(f.problems)-n, "repaired")
+
+	if n > 0 {
+		return goerr.Wrap(ErrFsck, 0)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+func TestFsck(t *testing.T) {
+	dir := "/tmp/d-fsck"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	open := &OpenReq{
+		Database:    "test",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	}
+
+	// segments have 2 records of 60 points
+	srv, err := NewServer(&Options{Path: dir, SegmentSize: 2 * 60 * PointSize, Databases: []*OpenReq{open}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	put := &PutReq{Database: "test", Fields: []string{"a"}, Timestamp: uint32(time.Now().Unix()), Value: 1, Count: 1}
+	if _, err := s.put(put); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := path.Join(dir, "test")
+	segBytes := 2 * 60 * PointSize
+	epochPath := path.Join(dbPath, "epoch_0")
+	files := map[string]int{
+		EpochIndexFile: 10,
+		"block_0":      segBytes,
+		"block_1":      segBytes - 100,
+		"block_2":      segBytes + 50,
+	}
+
+	if err := os.MkdirAll(epochPath, DataPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, size := range files {
+		if err := ioutil.WriteFile(path.Join(epochPath, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a duplicate and an expired series are not problems but an orphaned
+	// series without points and a partial line are
+	index := path.Join(dbPath, SeriesIndexFile)
+	data, err := ioutil.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphan := fmt.Sprintf(`{"time":%d,"fields":["b"]}`, time.Now().UnixNano())
+	expired := fmt.Sprintf(`{"time":%d,"fields":["c"]}`, time.Now().UnixNano()-72000e9)
+	data = append(data, data...)
+	data = append(data, []byte(expired+"\n"+orphan+"\n{\"time\":")...)
+	if err := ioutil.WriteFile(index, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path.Join(dir, WALFile), []byte{1, 2, 3}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := dirState(t, dir)
+
+	out := &bytes.Buffer{}
+	f := &fsck{dir: dir, out: out}
+	if err := f.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if after := dirState(t, dir); after != before {
+		t.Fatal("check should not change the data directory", before, after)
+	}
+
+	// two segments, the series index and the wal
+	if len(f.problems) != 4 || f.unrepaired() != 4 {
+		t.Fatal("problems should be reported", out.String())
+	}
+
+	if !strings.Contains(out.String(), "1 corrupt, 1 orphaned") {
+		t.Fatal("series index problems should be reported", out.String())
+	}
+
+	f = &fsck{dir: dir, repair: true, out: out}
+	if err := f.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.problems) != 4 || f.unrepaired() != 0 {
+		t.Fatal("problems should be repaired", out.String())
+	}
+
+	for _, name := range []string{"block_1", "block_2"} {
+		finfo, err := os.Stat(path.Join(epochPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if finfo.Size() != int64(segBytes) {
+			t.Fatal("segments should be resized", name, finfo.Size())
+		}
+	}
+
+	if _, err := os.Stat(path.Join(dir, LostFoundDir, "test", "epoch_0", "block_2")); err != nil {
+		t.Fatal("dropped data should be kept in lost+found", err)
+	}
+
+	f = &fsck{dir: dir, out: out}
+	if err := f.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.problems) != 0 {
+		t.Fatal("repaired data directory should not have problems", f.problems)
+	}
+
+	srv, err = NewServer(&Options{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := srv.(*server).indexes["test"].count(); n != 1 {
+		t.Fatal("only valid series should be kept", n)
+	}
+
+	closeTestServer(t, srv)
+}
+
+func TestFsckArgs(t *testing.T) {
+	dir := "/tmp/d-fsck-args"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(dir, DataPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsckCommand([]string{dir, "-repair"}); err != nil {
+		t.Fatal("flags should be parsed after the path", err)
+	}
+
+	if err := fsckCommand([]string{dir, "other"}); !goerr.Is(err, ErrUsage) {
+		t.Fatal("extra arguments should be rejected", err)
+	}
+}
+
+// dirState describes names, sizes and modification times of all files
+func dirState(t *testing.T, dir string) (state string) {
+	err := filepath.Walk(dir, func(fpath string, finfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		state += fmt.Sprintln(fpath, finfo.Size(), finfo.ModTime().UnixNano())
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state
+}
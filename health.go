@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/kadirahq/kadiyadb"
+)
+
+const (
+	// QuarantineDir has databases which failed to load when quarantine is
+	// enabled. It's hidden so it's not loaded as a database.
+	QuarantineDir = ".quarantine"
+
+	// QuarantineFile is written inside quarantined databases with the
+	// reason so that they are reported after a restart
+	QuarantineFile = "quarantine.json"
+
+	// StatusOK is the status of databases which are loaded
+	StatusOK = "ok"
+
+	// StatusFailed is the status of databases which failed to load
+	StatusFailed = "failed"
+
+	// StatusQuarantined is the status of databases which failed to load
+	// and were moved to the quarantine directory
+	StatusQuarantined = "quarantined"
+)
+
+var (
+	// ErrDatabaseFailed is returned when creating a database with the name
+	// of a database which failed to load. It must be retried or dropped.
+	ErrDatabaseFailed = errors.New("database failed to load, retry or drop it")
+)
+
+// failure has the reason a database failed to load
+type failure struct {
+	Reason      string    `json:"reason"`
+	Time        time.Time `json:"time"`
+	quarantined bool
+}
+
+// loadDatabase opens a database and its series index. Read-write epochs
+// are loaded which also acts as a health check.
+func loadDatabase(dbPath string, recovery bool) (db kadiyadb.Database, x *seriesIndex, err error) {
+	db, err = kadiyadb.Open(dbPath, recovery)
+	if err != nil {
+		return nil, nil, goerr.Wrap(err, 0)
+	}
+
+	closeDB := func() {
+		if err := db.Close(); err != nil {
+			Logger.Error(err)
+		}
+	}
+
+	info, err := db.Info()
+	if err != nil {
+		closeDB()
+		return nil, nil, goerr.Wrap(err, 0)
+	}
+
+	now := time.Now().UnixNano()
+	fields := []string{`¯\_(ツ)_/¯`}
+
+	var i uint32
+	for i = 0; i < info.MaxRWEpochs; i++ {
+		ii64 := int64(i)
+		start := now - ii64*info.Duration
+		end := start + info.Resolution
+
+		// this will trigger a epoch load
+		if _, err := db.One(start, end, fields); err != nil {
+			closeDB()
+			return nil, nil, goerr.Wrap(err, 0)
+		}
+	}
+
+	x, err = openSeriesIndex(dbPath, info.Retention)
+	if err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+
+	return db, x, nil
+}
+
+// failDatabase records a database which failed to load and moves it to
+// the quarantine directory when quarantine is enabled. The databases
+// lock must be held.
+func (s *server) failDatabase(name string, reason error) {
+	Logger.Error(reason, name)
+	f := &failure{Reason: reason.Error(), Time: time.Now()}
+	s.failed[name] = f
+
+	if !s.options.Quarantine {
+		return
+	}
+
+	qdir := path.Join(s.options.Path, QuarantineDir)
+	target := path.Join(qdir, name)
+
+	// an older quarantined copy is never replaced
+	if _, err := os.Stat(target); err == nil {
+		Logger.Error("quarantine: already has a database named", name)
+		return
+	}
+
+	if err := os.MkdirAll(qdir, DataPerm); err != nil {
+		Logger.Error(err)
+		return
+	}
+
+	if err := os.Rename(path.Join(s.options.Path, name), target); err != nil {
+		Logger.Error(err)
+		return
+	}
+
+	f.quarantined = true
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		Logger.Error(err)
+		return
+	}
+
+	if err := ioutil.WriteFile(path.Join(target, QuarantineFile), data, 0644); err != nil {
+		Logger.Error(err)
+	}
+}
+
+// loadQuarantined records databases which were quarantined before the
+// server was started
+func (s *server) loadQuarantined() (err error) {
+	files, err := ioutil.ReadDir(path.Join(s.options.Path, QuarantineDir))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	for _, finfo := range files {
+		if !finfo.IsDir() {
+			continue
+		}
+
+		f := &failure{quarantined: true}
+		fpath := path.Join(s.options.Path, QuarantineDir, finfo.Name(), QuarantineFile)
+		if err := readJSON(fpath, f); err != nil {
+			Logger.Error(err)
+		}
+
+		s.failed[finfo.Name()] = f
+	}
+
+	return nil
+}
+
+// failedInfo returns info of databases which failed to load. The
+// databases lock must be held.
+func (s *server) failedInfo() (dbis []*DBInfo) {
+	for name, f := range s.failed {
+		dbi := &DBInfo{Database: name, Status: StatusFailed, Error: f.Reason}
+		if f.quarantined {
+			dbi.Status = StatusQuarantined
+		}
+
+		dbis = append(dbis, dbi)
+	}
+
+	return dbis
+}
+
+// retry loads databases which failed to load. Quarantined databases are
+// moved back to the data directory first and they are quarantined again
+// if they still fail. All failed databases are retried when the request
+// does not have a database.
+func (s *server) retry(req *RetryReq) (res *RetryRes, err error) {
+	defer Logger.Time(time.Now(), 10*time.Second, "server.retry")
+	res = &RetryRes{}
+
+	var names []string
+	s.dbsMutex.RLock()
+	for name := range s.failed {
+		if req.Database == "" || req.Database == name {
+			names = append(names, name)
+		}
+	}
+	s.dbsMutex.RUnlock()
+
+	if req.Database != "" && len(names) == 0 {
+		return nil, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		res.Databases = append(res.Databases, s.retryDatabase(name))
+	}
+
+	return res, nil
+}
+
+// retryDatabase loads a failed database and returns its new status
+func (s *server) retryDatabase(name string) (dbi *DBInfo) {
+	dbi = &DBInfo{Database: name, Status: StatusOK}
+
+	// the write lock must be taken before the databases lock
+	// because writers take them in the same order.
+	lock := s.writeLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.dbsMutex.Lock()
+	defer s.dbsMutex.Unlock()
+
+	f, ok := s.failed[name]
+	if !ok {
+		// loaded by another request
+		return dbi
+	}
+
+	dbPath := path.Join(s.options.Path, name)
+	if f.quarantined {
+		if _, err := os.Stat(dbPath); err == nil {
+			dbi.Status, dbi.Error = StatusQuarantined, ErrDatabaseExists.Error()
+			return dbi
+		}
+
+		qpath := path.Join(s.options.Path, QuarantineDir, name)
+		if err := os.Remove(path.Join(qpath, QuarantineFile)); err != nil && !os.IsNotExist(err) {
+			Logger.Error(err)
+		}
+
+		if err := os.Rename(qpath, dbPath); err != nil {
+			dbi.Status, dbi.Error = StatusQuarantined, err.Error()
+			return dbi
+		}
+	}
+
+	delete(s.failed, name)
+
+	db, x, err := loadDatabase(dbPath, s.options.Recovery)
+	if err != nil {
+		s.failDatabase(name, err)
+		dbi.Status, dbi.Error = StatusFailed, err.Error()
+		if s.failed[name].quarantined {
+			dbi.Status = StatusQuarantined
+		}
+
+		return dbi
+	}
+
+	s.databases[name] = db
+	s.indexes[name] = x
+
+	metadata, err := db.Info()
+	if err != nil {
+		Logger.Error(err)
+		return dbi
+	}
+
+	dbi.Resolution = uint32(metadata.Resolution / 1e9)
+	dbi.Series, dbi.MaxSeries = x.count()
+
+	return dbi
+}
+
+// dropFailed removes files of a database which failed to load. The
+// databases lock must be held.
+func (s *server) dropFailed(name string) (err error) {
+	f := s.failed[name]
+	dbPath := path.Join(s.options.Path, name)
+	if f.quarantined {
+		dbPath = path.Join(s.options.Path, QuarantineDir, name)
+	}
+
+	if err := os.RemoveAll(dbPath); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	delete(s.failed, name)
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	goerr "github.com/go-errors/errors"
+)
+
+func TestQuarantine(t *testing.T) {
+	dir := "/tmp/d-health"
+	status := func(s *server, name string) *DBInfo {
+		res, err := s.info(&InfoReq{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, dbi := range res.Databases {
+			if dbi.Database == name {
+				return dbi
+			}
+		}
+
+		return nil
+	}
+
+	good := testOpenReq("good")
+	closeTestServer(t, newTestServer(t, &Options{Path: dir, Databases: []*OpenReq{good}}))
+
+	// a database directory without database files
+	if err := os.MkdirAll(path.Join(dir, "broken"), DataPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestServer(t, &Options{Path: dir, Quarantine: true})
+	if dbi := status(s, "good"); dbi == nil || dbi.Status != StatusOK {
+		t.Fatal("healthy databases should be loaded", dbi)
+	}
+
+	if dbi := status(s, "broken"); dbi == nil || dbi.Status != StatusQuarantined || dbi.Error == "" {
+		t.Fatal("failed databases should be reported", dbi)
+	}
+
+	if _, err := os.Stat(path.Join(dir, QuarantineDir, "broken")); err != nil {
+		t.Fatal("failed databases should be moved to quarantine", err)
+	}
+
+	open := *good
+	open.Database = "broken"
+	if _, err := s.open(&open); !goerr.Is(err, ErrDatabaseFailed) {
+		t.Fatal("failed databases should not be replaced", err)
+	}
+
+	// quarantined databases are reported after a restart
+	closeTestServer(t, s)
+	s = openTestServer(t, &Options{Path: dir, Quarantine: true})
+	defer closeTestServer(t, s)
+
+	if dbi := status(s, "broken"); dbi == nil || dbi.Status != StatusQuarantined || dbi.Error == "" {
+		t.Fatal("quarantined databases should be loaded", dbi)
+	}
+
+	res, err := s.retry(&RetryReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Databases) != 1 || res.Databases[0].Status != StatusQuarantined {
+		t.Fatal("databases which still fail should be quarantined again", res.Databases)
+	}
+
+	// fix the database with files of a healthy database
+	metadata, err := ioutil.ReadFile(path.Join(dir, "good", "metadata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path.Join(dir, QuarantineDir, "broken", "metadata"), metadata, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = s.retry(&RetryReq{Database: "broken"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Databases) != 1 || res.Databases[0].Status != StatusOK {
+		t.Fatal("fixed databases should be loaded", res.Databases)
+	}
+
+	if _, ok := s.database("broken"); !ok {
+		t.Fatal("loaded databases should accept requests")
+	}
+
+	if _, err := s.retry(&RetryReq{Database: "broken"}); !goerr.Is(err, ErrDatabase) {
+		t.Fatal("only failed databases can be retried", err)
+	}
+}
+
+func TestDropFailed(t *testing.T) {
+	dir := "/tmp/d-health-drop"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := path.Join(dir, "broken")
+	if err := os.MkdirAll(dbPath, DataPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestServer(t, &Options{Path: dir})
+	defer closeTestServer(t, s)
+
+	res, err := s.info(&InfoReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Databases) != 1 || res.Databases[0].Status != StatusFailed {
+		t.Fatal("failed databases should be reported", res.Databases)
+	}
+
+	if _, err := s.drop(&DropReq{Database: "broken"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+		t.Fatal("failed databases should be removed", err)
+	}
+
+	res, err = s.info(&InfoReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Databases) != 0 {
+		t.Fatal("dropped databases should not be reported", res.Databases)
+	}
+}
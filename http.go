@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	goerr "github.com/go-errors/errors"
+	"golang.org/x/net/websocket"
+)
+
+// listenHTTP serves http ingestion, streaming and backup endpoints
+func (s *server) listenHTTP(addr string) (err error) {
+	mux := http.NewServeMux()
+	mux.Handle("/write", newInflux(s, s.options.InfluxMappings))
+	mux.Handle("/api/v1/write", newPrometheus(s, s.options.PromMappings))
+	mux.Handle("/subscribe", websocket.Handler(s.serveSubscription))
+	mux.HandleFunc("/backup", s.serveBackup)
+	mux.HandleFunc("/restore", s.serveRestore)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	s.closeMutex.Lock()
+	if s.closed {
+		s.closeMutex.Unlock()
+		return goerr.Wrap(ErrClosed, 0)
+	}
+
+	s.httpServer = srv
+	s.closeMutex.Unlock()
+
+	log.Println("HTTP:   listening on", addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// DefaultImportBatch is the default number of rows sent in a batch
+	DefaultImportBatch = 500
+
+	// ImportProgress is the number of rows between progress reports
+	ImportProgress = 10000
+)
+
+// importRows writes rows to a database with put or inc requests. The first
+// skip rows are ignored so an import can continue after a failure. done is
+// called with the number of rows written (including skipped rows) after
+// each successful batch.
+func importRows(call caller, database, method string, r rowReader, skip, batch int, done func(n int) error) (n int, err error) {
+	if method == "inc" {
+		// a failed batch can be partially applied and increments
+		// are not idempotent so they are sent one at a time.
+		batch = 1
+	}
+
+	if batch < 1 {
+		batch = 1
+	}
+
+	req := &ReqBatch{}
+	send := func() error {
+		if len(req.Batch) == 0 {
+			return nil
+		}
+
+		if err := call("batch", req, &ResBatch{}); err != nil {
+			return err
+		}
+
+		n += len(req.Batch)
+		req.Batch = req.Batch[:0]
+		return done(n)
+	}
+
+	for {
+		row, err := r.read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return n, err
+		}
+
+		if skip > 0 {
+			skip--
+			n++
+			continue
+		}
+
+		item := &Request{}
+		switch method {
+		case "inc":
+			item.IncReq = &IncReq{
+				Database:  database,
+				Fields:    row.Fields,
+				Timestamp: row.Timestamp,
+				Value:     row.Value,
+				Count:     row.Count,
+			}
+		default:
+			item.PutReq = &PutReq{
+				Database:  database,
+				Fields:    row.Fields,
+				Timestamp: row.Timestamp,
+				Value:     row.Value,
+				Count:     row.Count,
+			}
+		}
+
+		req.Batch = append(req.Batch, item)
+		if len(req.Batch) >= batch {
+			if err := send(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	if err := send(); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// importCommand reads csv or json lines and writes them to a database.
+// Progress is saved to a state file and a failed import continues from
+// the last successful batch when it's started again.
+func importCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	addr := fs.String("addr", DefaultAddr, "server address")
+	token := fs.String("token", "", "authentication token")
+	secure := newTLSFlags(fs)
+	database := fs.String("database", "", "database name")
+	method := fs.String("method", "put", "write method (put or inc)")
+	batch := fs.Int("batch", DefaultImportBatch, "rows to send with each request")
+	format := fs.String("format", FormatCSV, "input format (csv or jsonl)")
+	in := fs.String("in", "-", "input file")
+	state := fs.String("state", "", "progress file to resume from (default: <in>.progress)")
+	fs.Parse(args)
+
+	if *database == "" || (*method != "put" && *method != "inc") {
+		return goerr.Wrap(ErrUsage, 0)
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		defer file.Close()
+		r = file
+
+		if *state == "" {
+			*state = *in + ".progress"
+		}
+	}
+
+	rr, err := newRowReader(*format, r)
+	if err != nil {
+		return err
+	}
+
+	var skip int
+	if *state != "" {
+		if data, err := ioutil.ReadFile(*state); err == nil {
+			skip, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+			Logger.Info("import: resuming after", skip, "rows")
+		}
+	}
+
+	conn, err := secure.dial(*addr, *token)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	call := conn.call
+
+	reported := skip
+	done := func(n int) error {
+		if n-reported >= ImportProgress {
+			reported = n
+			Logger.Info("import: wrote", n, "rows")
+		}
+
+		if *state == "" {
+			return nil
+		}
+
+		return ioutil.WriteFile(*state, []byte(strconv.Itoa(n)), 0644)
+	}
+
+	n, err := importRows(call, *database, *method, rr, skip, *batch, done)
+	if err != nil {
+		Logger.Error("import: failed after", n, "rows")
+		return err
+	}
+
+	if *state != "" {
+		os.Remove(*state)
+	}
+
+	Logger.Info("import: wrote", n, "rows")
+	return nil
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// InfluxMaxLine is the maximum length of a line protocol line
+	InfluxMaxLine = 4 * 1024 * 1024
+)
+
+var (
+	// ErrInfluxLine is returned when a line protocol line cannot be parsed
+	ErrInfluxLine = errors.New("invalid line protocol")
+
+	// ErrInfluxValue is returned when a field value cannot be parsed
+	ErrInfluxValue = errors.New("invalid field value")
+
+	// ErrInfluxNumeric is returned when a point has no numeric fields
+	ErrInfluxNumeric = errors.New("no numeric fields")
+
+	// ErrInfluxMapping is returned when a point doesn't match any mapping
+	ErrInfluxMapping = errors.New("no influx mapping for measurement")
+
+	// ErrInfluxTag is returned when a tag used in a mapping is missing
+	ErrInfluxTag = errors.New("missing tag for mapping")
+
+	// ErrInfluxPrecision is returned for unknown timestamp precisions
+	ErrInfluxPrecision = errors.New("invalid timestamp precision")
+
+	// ErrInfluxTime is returned when a timestamp cannot be stored
+	ErrInfluxTime = errors.New("timestamp is out of range")
+)
+
+// InfluxMapping maps line protocol points of a measurement to a database.
+// Use "*" as the measurement to match all measurements. Each entry in Fields
+// can be "measurement", "field" (the field key), "tag:<key>" (a tag value)
+// or any other literal value. Each numeric field is written as a point.
+type InfluxMapping struct {
+	Measurement string   `json:"measurement"`
+	Database    string   `json:"database"`
+	Fields      []string `json:"fields"`
+}
+
+// InfluxResult reports accepted and rejected points of a write request
+type InfluxResult struct {
+	Accepted  int            `json:"accepted"`
+	Rejected  int            `json:"rejected"`
+	Throttled int            `json:"throttled"`
+	Errors    []*InfluxError `json:"errors,omitempty"`
+}
+
+// InfluxError has the line number and reason for a rejected point
+type InfluxError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type influxPoint struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]float64
+	timestamp   int64
+	hasTime     bool
+}
+
+type influx struct {
+	server   *server
+	mappings []*InfluxMapping
+}
+
+func newInflux(s *server, mappings []*InfluxMapping) (ix *influx) {
+	return &influx{server: s, mappings: mappings}
+}
+
+// ServeHTTP handles line protocol write requests
+func (ix *influx) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer Logger.Time(time.Now(), time.Second, "influx.write")
+
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !ix.server.authorizeHTTP(w, r, ix.databases(), OpWrite) {
+		return
+	}
+
+	precision := r.URL.Query().Get("precision")
+	scale, err := influxScale(precision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := ix.server.rateClient(httpToken(r))
+	result, err := ix.write(newInfluxScanner(r.Body), scale, time.Now(), client)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Throttled > 0 {
+		w.WriteHeader(http.StatusTooManyRequests)
+	} else if result.Rejected > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		Logger.Error(err)
+	}
+}
+
+// newInfluxScanner reads lines up to InfluxMaxLine bytes
+func newInfluxScanner(r io.Reader) (sc *bufio.Scanner) {
+	sc = bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), InfluxMaxLine)
+	return sc
+}
+
+// write parses and stores all lines and reports the result for each point.
+// Writes are rate limited like put requests of the client.
+func (ix *influx) write(sc *bufio.Scanner, scale int64, now time.Time, client string) (res *InfluxResult, err error) {
+	res = &InfluxResult{}
+	lineNum := 0
+
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := ix.writeLine(line, scale, now, client); err != nil {
+			if goerr.Is(err, ErrRateLimit) {
+				res.Throttled++
+			}
+
+			res.Rejected++
+			res.Errors = append(res.Errors, &InfluxError{Line: lineNum, Error: err.Error()})
+		} else {
+			res.Accepted++
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return res, nil
+}
+
+// writeLine stores all fields of a line. The line is validated before
+// the first field is written so that lines are not partially written.
+func (ix *influx) writeLine(line string, scale int64, now time.Time, client string) (err error) {
+	p, err := parseInfluxLine(line)
+	if err != nil {
+		return err
+	}
+
+	ts := now.Unix()
+	if p.hasTime {
+		ts = p.timestamp / scale
+	}
+
+	if ts < 0 || ts > math.MaxUint32 {
+		return goerr.Wrap(ErrInfluxTime, 0)
+	}
+
+	mp := ix.mapping(p.measurement)
+	if mp == nil {
+		return goerr.Wrap(ErrInfluxMapping, 0)
+	}
+
+	reqs := make([]*PutReq, 0, len(p.fields))
+	for key, val := range p.fields {
+		fields, err := mp.resolve(p, key)
+		if err != nil {
+			return err
+		}
+
+		reqs = append(reqs, &PutReq{
+			Database:  mp.Database,
+			Fields:    fields,
+			Timestamp: uint32(ts),
+			Value:     val,
+			Count:     1,
+		})
+	}
+
+	if err := ix.server.checkWrite(mp.Database, uint32(ts)); err != nil {
+		return err
+	}
+
+	if err := ix.server.limits.take(client, mp.Database, LimitWrites, float64(len(reqs))); err != nil {
+		return err
+	}
+
+	for _, req := range reqs {
+		if _, err := ix.server.put(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// databases returns all databases used by mappings
+func (ix *influx) databases() (names []string) {
+	for _, mp := range ix.mappings {
+		names = append(names, mp.Database)
+	}
+
+	return names
+}
+
+func (ix *influx) mapping(measurement string) (mp *InfluxMapping) {
+	for _, mp := range ix.mappings {
+		if mp.Measurement == measurement || mp.Measurement == "*" {
+			return mp
+		}
+	}
+
+	return nil
+}
+
+func (mp *InfluxMapping) resolve(p *influxPoint, key string) (fields []string, err error) {
+	fields = make([]string, len(mp.Fields))
+	for i, f := range mp.Fields {
+		switch {
+		case f == "measurement":
+			fields[i] = p.measurement
+		case f == "field":
+			fields[i] = key
+		case strings.HasPrefix(f, "tag:"):
+			val, ok := p.tags[strings.TrimPrefix(f, "tag:")]
+			if !ok {
+				return nil, goerr.Wrap(ErrInfluxTag, 0)
+			}
+
+			fields[i] = val
+		default:
+			fields[i] = f
+		}
+	}
+
+	return fields, nil
+}
+
+// influxScale returns the divisor to convert timestamps to seconds
+func influxScale(precision string) (scale int64, err error) {
+	switch precision {
+	case "", "n", "ns":
+		return 1e9, nil
+	case "u", "us":
+		return 1e6, nil
+	case "ms":
+		return 1e3, nil
+	case "s":
+		return 1, nil
+	}
+
+	return 0, goerr.Wrap(ErrInfluxPrecision, 0)
+}
+
+// parseInfluxLine parses a line in "measurement,tag=v field=v timestamp"
+// format. String fields are ignored because they cannot be stored.
+func parseInfluxLine(line string) (p *influxPoint, err error) {
+	sections := splitInflux(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, goerr.Wrap(ErrInfluxLine, 0)
+	}
+
+	p = &influxPoint{
+		tags:   map[string]string{},
+		fields: map[string]float64{},
+	}
+
+	series := splitInflux(sections[0], ',', false)
+	p.measurement = unescapeInflux(series[0])
+	if p.measurement == "" {
+		return nil, goerr.Wrap(ErrInfluxLine, 0)
+	}
+
+	for _, tag := range series[1:] {
+		kv := splitInflux(tag, '=', false)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, goerr.Wrap(ErrInfluxLine, 0)
+		}
+
+		p.tags[unescapeInflux(kv[0])] = unescapeInflux(kv[1])
+	}
+
+	for _, field := range splitInflux(sections[1], ',', true) {
+		kv := splitInflux(field, '=', true)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, goerr.Wrap(ErrInfluxLine, 0)
+		}
+
+		val, ok, err := parseInfluxValue(kv[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			p.fields[unescapeInflux(kv[0])] = val
+		}
+	}
+
+	if len(p.fields) == 0 {
+		return nil, goerr.Wrap(ErrInfluxNumeric, 0)
+	}
+
+	if len(sections) == 3 {
+		p.timestamp, err = strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, goerr.Wrap(ErrInfluxLine, 0)
+		}
+
+		p.hasTime = true
+	}
+
+	return p, nil
+}
+
+// parseInfluxValue parses a field value, ok is false for string values
+func parseInfluxValue(str string) (val float64, ok bool, err error) {
+	switch str {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	if strings.HasPrefix(str, `"`) {
+		if len(str) < 2 || !strings.HasSuffix(str, `"`) {
+			return 0, false, goerr.Wrap(ErrInfluxValue, 0)
+		}
+
+		return 0, false, nil
+	}
+
+	if strings.HasSuffix(str, "i") || strings.HasSuffix(str, "u") {
+		n, err := strconv.ParseInt(str[:len(str)-1], 10, 64)
+		if err != nil {
+			return 0, false, goerr.Wrap(ErrInfluxValue, 0)
+		}
+
+		return float64(n), true, nil
+	}
+
+	val, err = strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, false, goerr.Wrap(ErrInfluxValue, 0)
+	}
+
+	return val, true, nil
+}
+
+// splitInflux splits a string by sep ignoring escaped separators.
+// Separators inside double quotes are also ignored if quoted is true.
+func splitInflux(str string, sep byte, quoted bool) (parts []string) {
+	inQuotes := false
+	start := 0
+
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && quoted:
+			inQuotes = !inQuotes
+		case c == sep && !inQuotes:
+			parts = append(parts, str[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, str[start:])
+}
+
+// unescapeInflux removes backslashes used to escape special characters
+func unescapeInflux(str string) string {
+	if !strings.Contains(str, `\`) {
+		return str
+	}
+
+	buff := make([]byte, 0, len(str))
+	for i := 0; i < len(str); i++ {
+		if str[i] == '\\' && i+1 < len(str) {
+			i++
+		}
+
+		buff = append(buff, str[i])
+	}
+
+	return string(buff)
+}
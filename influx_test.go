@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	p, err := parseInfluxLine(`cpu\ load,host=h\,1,region=eu idle=10.5,busy=3i,ok=t,note="a b" 1445000000000000000`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.measurement != "cpu load" || !p.hasTime || p.timestamp != 1445000000000000000 {
+		t.Fatal("wrong values", p)
+	}
+
+	if !reflect.DeepEqual(p.tags, map[string]string{"host": "h,1", "region": "eu"}) {
+		t.Fatal("wrong tags", p.tags)
+	}
+
+	if !reflect.DeepEqual(p.fields, map[string]float64{"idle": 10.5, "busy": 3, "ok": 1}) {
+		t.Fatal("wrong fields", p.fields)
+	}
+
+	for _, line := range []string{"cpu", "cpu idle=x", `cpu note="a"`, "cpu idle=1 abc"} {
+		if _, err := parseInfluxLine(line); err == nil {
+			t.Fatal("should fail", line)
+		}
+	}
+}
+
+func TestInfluxWrite(t *testing.T) {
+	dir := "/tmp/d-influx"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	_, err = s.open(&OpenReq{
+		Database:    "influx",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix := newInflux(s, []*InfluxMapping{
+		{Measurement: "cpu", Database: "influx", Fields: []string{"field", "tag:host"}},
+	})
+
+	now := time.Now()
+	ts := uint32(now.Unix())
+	body := strings.Join([]string{
+		"cpu,host=h1 idle=10,busy=5",
+		"mem,host=h1 used=1",
+		"cpu idle=1",
+		"cpu,host=h1 idle=",
+	}, "\n")
+
+	res, err := ix.write(bufio.NewScanner(strings.NewReader(body)), 1e9, now, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Accepted != 1 || res.Rejected != 3 || len(res.Errors) != 3 {
+		t.Fatal("wrong result", res)
+	}
+
+	if res.Errors[0].Line != 2 || res.Errors[1].Line != 3 || res.Errors[2].Line != 4 {
+		t.Fatal("wrong error lines", res.Errors)
+	}
+
+	get, err := s.get(&GetReq{
+		Database:  "influx",
+		Fields:    []string{"idle", "h1"},
+		GroupBy:   []bool{true, true},
+		StartTime: ts,
+		EndTime:   ts + 60,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(get.Groups) != 1 || get.Groups[0].Points[0].Value != 10 {
+		t.Fatal("incorrect values for point")
+	}
+
+	old := now.Add(-24 * time.Hour).UnixNano()
+	body = strings.Join([]string{
+		"cpu,host=h2 idle=1,busy=2 " + strconv.FormatInt(old, 10),
+		"cpu,host=h2 idle=1 -1",
+		"cpu,host=h2 idle=1,note=\"" + strings.Repeat("x", 100*1024) + "\"",
+	}, "\n")
+
+	res, err = ix.write(newInfluxScanner(strings.NewReader(body)), 1e9, now, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Accepted != 1 || res.Rejected != 2 {
+		t.Fatal("long lines should be accepted and bad timestamps rejected", res)
+	}
+
+	db, _ := s.database("influx")
+	start := old - old%60e9
+	if hasPoints(db, start, start+60e9, []string{"busy", "h2"}) {
+		t.Fatal("lines should not be partially written")
+	}
+
+	// points are rate limited like puts
+	s.limits.set([]*RateLimit{{Database: "influx", Writes: 1}})
+	body = "cpu,host=h3 idle=1\ncpu,host=h3 idle=2"
+	res, err = ix.write(newInfluxScanner(strings.NewReader(body)), 1e9, now, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Accepted != 1 || res.Throttled != 1 {
+		t.Fatal("writes over the rate limit should be throttled", res)
+	}
+}
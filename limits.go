@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// LimitWrites limits points written per second (put and inc)
+	LimitWrites = "writes"
+
+	// LimitQueries limits get requests per second
+	LimitQueries = "queries"
+
+	// LimitScanned limits points read from storage per second. The number
+	// of points is only known after a query so queries are rejected when
+	// previous queries used more than the limit.
+	LimitScanned = "scanned"
+)
+
+var (
+	// ErrRateLimit is returned when a client or a database is over a limit
+	ErrRateLimit = errors.New("rate limited: too many requests")
+)
+
+// RateLimit sets per second limits for writes and queries. Database is a
+// name or a prefix ending with "*" and each matching database has its
+// own limit. An empty database shares the limit between all databases.
+// Client is a token or a client certificate principal, "*" gives each
+// client its own limit and an empty client shares the limit between all
+// clients. Limits which are zero are not checked.
+type RateLimit struct {
+	Database string  `json:"database"`
+	Client   string  `json:"client"`
+	Writes   float64 `json:"writes"`
+	Queries  float64 `json:"queries"`
+	Scanned  float64 `json:"scanned"`
+}
+
+func (l *RateLimit) rate(kind string) (rate float64) {
+	switch kind {
+	case LimitWrites:
+		return l.Writes
+	case LimitQueries:
+		return l.Queries
+	case LimitScanned:
+		return l.Scanned
+	}
+
+	return 0
+}
+
+func (l *RateLimit) matches(database, client string) (ok bool) {
+	if l.Database != "" && !matchDatabase(l.Database, database) {
+		return false
+	}
+
+	return l.Client == "" || l.Client == "*" || l.Client == client
+}
+
+// key returns the name of the bucket used for a database and a client
+func (l *RateLimit) key(kind, database, client string) (key string) {
+	if l.Database == "" {
+		database = ""
+	}
+
+	if l.Client == "" {
+		client = ""
+	}
+
+	return kind + "\x00" + database + "\x00" + client
+}
+
+// bucket has tokens for one second of requests (at least one) and it's
+// refilled at the rate of the limit. Charges after queries can make it negative.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter checks rate limits. Rules can be replaced while it's used.
+type limiter struct {
+	rules   []*RateLimit
+	metrics *metrics
+	mutex   sync.Mutex
+	buckets []map[string]*bucket
+}
+
+func newLimiter(rules []*RateLimit, m *metrics) (l *limiter) {
+	l = &limiter{metrics: m}
+	l.set(rules)
+	return l
+}
+
+// set replaces rules. Rules which did not change keep their buckets so
+// clients do not get a full burst after a reload.
+func (l *limiter) set(rules []*RateLimit) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	used := make([]bool, len(l.rules))
+	buckets := make([]map[string]*bucket, len(rules))
+	for i, rule := range rules {
+		for j, old := range l.rules {
+			if !used[j] && *old == *rule {
+				used[j] = true
+				buckets[i] = l.buckets[j]
+				break
+			}
+		}
+
+		if buckets[i] == nil {
+			buckets[i] = make(map[string]*bucket)
+		}
+	}
+
+	l.rules = rules
+	l.buckets = buckets
+}
+
+// take removes n tokens from all buckets of the database and the client
+// or returns ErrRateLimit without changes if one of them has too few.
+func (l *limiter) take(client, database, kind string, n float64) (err error) {
+	return l.update(client, database, kind, n, false)
+}
+
+// charge removes n tokens from all buckets even when they have too few
+func (l *limiter) charge(client, database, kind string, n float64) {
+	l.update(client, database, kind, n, true)
+}
+
+func (l *limiter) update(client, database, kind string, n float64, force bool) (err error) {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var matched []*bucket
+	for i, rule := range l.rules {
+		rate := rule.rate(kind)
+		if rate <= 0 || !rule.matches(database, client) {
+			continue
+		}
+
+		// buckets hold at least one token so rates below 1/s still pass
+		capacity := math.Max(rate, 1)
+
+		key := rule.key(kind, database, client)
+		b, ok := l.buckets[i][key]
+		if !ok {
+			b = &bucket{tokens: capacity, last: now}
+			l.buckets[i][key] = b
+		}
+
+		b.tokens += rate * now.Sub(b.last).Seconds()
+		if b.tokens > capacity {
+			b.tokens = capacity
+		}
+
+		b.last = now
+
+		if !force && (b.tokens <= 0 || b.tokens < n) {
+			l.metrics.add("ratelimit.throttled."+kind, 1)
+			return goerr.Wrap(ErrRateLimit, 0)
+		}
+
+		matched = append(matched, b)
+	}
+
+	for _, b := range matched {
+		b.tokens -= n
+	}
+
+	return nil
+}
+
+// requestToken returns the token of a request inside a batch
+func requestToken(req *Request) (token string) {
+	switch {
+	case req.InfoReq != nil:
+		return req.InfoReq.Token
+	case req.OpenReq != nil:
+		return req.OpenReq.Token
+	case req.EditReq != nil:
+		return req.EditReq.Token
+	case req.PutReq != nil:
+		return req.PutReq.Token
+	case req.IncReq != nil:
+		return req.IncReq.Token
+	case req.GetReq != nil:
+		return req.GetReq.Token
+	}
+
+	return ""
+}
+
+// rateClient returns the client used for rate limits. Tokens are not
+// checked without ACLs so all of these clients share limits.
+func (s *server) rateClient(token string) (client string) {
+	if s.acls == nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(token, principalPrefix)
+}
+
+// getAs runs a query for a client if it's within read limits and charges
+// the points it scanned
+func (s *server) getAs(client string, req *GetReq) (res *GetRes, err error) {
+	if err := s.limits.take(client, req.Database, LimitQueries, 1); err != nil {
+		return nil, err
+	}
+
+	if err := s.limits.take(client, req.Database, LimitScanned, 0); err != nil {
+		return nil, err
+	}
+
+	res, scanned, err := s.query(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.limits.charge(client, req.Database, LimitScanned, float64(scanned))
+	return res, nil
+}
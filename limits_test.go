@@ -0,0 +1,197 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+func TestLimiter(t *testing.T) {
+	m := newMetrics()
+	l := newLimiter([]*RateLimit{
+		{Database: "app-*", Client: "*", Writes: 2},
+		{Database: "shared", Queries: 1},
+	}, m)
+
+	for i := 0; i < 2; i++ {
+		if err := l.take("a", "app-1", LimitWrites, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.take("a", "app-1", LimitWrites, 1); !goerr.Is(err, ErrRateLimit) {
+		t.Fatal("client should be over the write limit", err)
+	}
+
+	// each client and each database has its own limit
+	if err := l.take("b", "app-1", LimitWrites, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.take("a", "app-2", LimitWrites, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// other databases are not limited
+	if err := l.take("a", "other", LimitWrites, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// clients share the limit when it's not per client
+	if err := l.take("a", "shared", LimitQueries, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.take("b", "shared", LimitQueries, 1); !goerr.Is(err, ErrRateLimit) {
+		t.Fatal("shared limit should be used by all clients", err)
+	}
+
+	if m.get("ratelimit.throttled.writes") != 1 || m.get("ratelimit.throttled.queries") != 1 {
+		t.Fatal("throttled requests should be counted")
+	}
+
+	// rules which did not change keep their limits after a reload
+	l.set([]*RateLimit{
+		{Database: "app-*", Client: "*", Writes: 2},
+		{Database: "shared", Queries: 2},
+	})
+
+	if err := l.take("a", "app-1", LimitWrites, 1); !goerr.Is(err, ErrRateLimit) {
+		t.Fatal("unchanged limits should not be reset", err)
+	}
+
+	if err := l.take("b", "shared", LimitQueries, 1); err != nil {
+		t.Fatal("changed limits should be reset", err)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	if err := l.take("a", "app-1", LimitWrites, 1); err != nil {
+		t.Fatal("limit should be refilled over time", err)
+	}
+}
+
+func TestLimiterFractional(t *testing.T) {
+	l := newLimiter([]*RateLimit{{Database: "*", Writes: 0.5}}, newMetrics())
+
+	if err := l.take("a", "app", LimitWrites, 1); err != nil {
+		t.Fatal("rates below 1/s should allow a request", err)
+	}
+
+	if err := l.take("a", "app", LimitWrites, 1); !goerr.Is(err, ErrRateLimit) {
+		t.Fatal("bucket should be empty", err)
+	}
+
+	l.buckets[0][LimitWrites+"\x00app\x00"].last = time.Now().Add(-2 * time.Second)
+	if err := l.take("a", "app", LimitWrites, 1); err != nil {
+		t.Fatal("bucket should refill at the rate", err)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	dir := "/tmp/d-limits"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{
+		Path: dir,
+		ACLs: []*ACL{
+			{Token: "admin", Rules: []*ACLRule{{Database: "*", Ops: []string{OpAdmin}}}},
+			{Token: "app", Rules: []*ACLRule{{Database: "*", Ops: []string{OpRead, OpWrite}}}},
+			{Token: "other", Rules: []*ACLRule{{Database: "*", Ops: []string{OpRead, OpWrite}}}},
+		},
+		RateLimits: []*RateLimit{
+			{Database: "limited", Client: "*", Writes: 5, Queries: 3, Scanned: 1},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	call := func(fn func([]byte) ([]byte, error), req, res proto.Message) error {
+		reqData, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resData, err := fn(reqData)
+		if err != nil {
+			return err
+		}
+
+		return proto.Unmarshal(resData, res)
+	}
+
+	open := &OpenReq{
+		Database:    "limited",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+		Token:       "admin",
+	}
+
+	if err := call(s.Open, open, &OpenRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := uint32(time.Now().Unix())
+	put := &PutReq{Database: "limited", Fields: []string{"a"}, Timestamp: now, Value: 1, Count: 1, Token: "app"}
+	for i := 0; i < 5; i++ {
+		if err := call(s.Put, put, &PutRes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := call(s.Put, put, &PutRes{}); !goerr.Is(err, ErrRateLimit) {
+		t.Fatal("writes should be rate limited", err)
+	}
+
+	// another client has its own limit
+	put.Token = "other"
+	if err := call(s.Put, put, &PutRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// subscriptions count as queries
+	sub := &SubscribeRes{}
+	if err := call(s.Subscribe, &SubscribeReq{Database: "limited", Fields: []string{"a"}, Token: "other"}, sub); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call(s.Poll, &PollReq{Id: sub.Id, Token: "other"}, &PollRes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := call(s.Poll, &PollReq{Id: sub.Id, Token: "other"}, &PollRes{}); !goerr.Is(err, ErrRateLimit) {
+		t.Fatal("polls should be rate limited", err)
+	}
+
+	// the first query scans more points than the limit and the next
+	// query is rejected until the limit is refilled
+	get := &GetReq{Database: "limited", Fields: []string{"a"}, GroupBy: []bool{true}, StartTime: now - 3600, EndTime: now + 60, Token: "app"}
+	if err := call(s.Get, get, &GetRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := call(s.Get, get, &GetRes{}); !goerr.Is(err, ErrRateLimit) {
+		t.Fatal("queries should be limited by scanned points", err)
+	}
+
+	batch := &ReqBatch{Token: "app", Batch: []*Request{{PutReq: &PutReq{Database: "limited", Fields: []string{"a"}, Timestamp: now, Value: 1, Count: 1}}}}
+	if err := call(s.Batch, batch, &ResBatch{}); !goerr.Is(err, ErrRateLimit) {
+		t.Fatal("batch writes should be rate limited", err)
+	}
+
+	if s.metrics.get("ratelimit.throttled.writes") != 2 {
+		t.Fatal("throttled writes should be counted")
+	}
+}
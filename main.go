@@ -4,14 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"flag"
-	"io/ioutil"
 	"net/http"
-	"path"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	_ "net/http/pprof"
 
-	"github.com/gogo/protobuf/proto"
+	goerr "github.com/go-errors/errors"
 	"github.com/kadirahq/go-tools/logger"
 	"github.com/kadirahq/go-tools/monitor"
 )
@@ -24,80 +25,139 @@ const (
 	DefaultData = "/tmp/kadiradb"
 
 	// InitFile contains a json array of databases which will be created
-	// or updated when starting kadiradb. Init process will be skipped
-	// if the file is missing or invalid.
+	// or updated when starting kadiradb (and on SIGHUP) in addition to
+	// databases in the config file.
 	InitFile = "init.json"
 
-	// PPROFAddr is the address the pprof server will listen to
+	// PPROFAddr is the default address the pprof server will listen to
 	// Make sure this port cannot be accessed from outside
 	PPROFAddr = ":6060"
+
+	// ExitShutdown is the exit status when the server did not shut down
+	// cleanly (requests did not finish or databases failed to close)
+	ExitShutdown = 1
+
+	// ExitListen is the exit status when the server stops listening
+	ExitListen = 2
+
+	// ExitConfig is the exit status when the config is invalid
+	ExitConfig = 3
 )
 
 var (
 	// Logger logs stuff
-	Logger = logger.New("kadiradb")
+	Logger = &levelLogger{Logger: logger.New("kadiradb")}
 )
 
 func main() {
-	addr := flag.String("addr", DefaultAddr, "server address")
-	data := flag.String("data", DefaultData, "data to store data files")
-	recv := flag.Bool("recv", false, "enable recovery")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				Logger.Error(err)
+				os.Exit(1)
+			}
 
-	if *addr == "" {
-		panic("invalid address: '" + *addr + "'")
+			return
+		}
 	}
 
-	if *data == "" {
-		panic("invalid datadir: '" + *data + "'")
+	config, err := loadConfig(os.Args[1:])
+	if goerr.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		Logger.Error(err)
+		os.Exit(ExitConfig)
 	}
 
-	s, err := NewServer(&Options{
-		Path:     *data,
-		Address:  *addr,
-		Recovery: *recv,
-	})
+	if err := configureLogging(config.Log); err != nil {
+		Logger.Error(err)
+		os.Exit(ExitConfig)
+	}
 
-	if err != nil {
-		panic(err)
+	if config.Address == "" {
+		panic("invalid address: '" + config.Address + "'")
 	}
 
-	ipath := path.Join(*data, InitFile)
-	idata, err := ioutil.ReadFile(ipath)
-	if err == nil {
-		load(s, idata)
+	if config.Data == "" {
+		panic("invalid datadir: '" + config.Data + "'")
 	}
 
-	go printAppMetrics()
-	go startPPROFServer()
-	Logger.Info(s.Listen())
-}
+	if len(config.Cluster) > 0 {
+		r, err := NewRouter(config.options())
+		if err != nil {
+			panic(err)
+		}
 
-func load(s Server, data []byte) {
-	defer Logger.Time(time.Now(), time.Second, "load")
-	var reqs []*OpenReq
+		Logger.Info(r.Listen())
+		return
+	}
 
-	err := json.Unmarshal(data, &reqs)
+	s, err := NewServer(config.options())
 	if err != nil {
-		Logger.Error(err)
-		return
+		panic(err)
 	}
 
-	for _, req := range reqs {
-		reqData, err := proto.Marshal(req)
-		if err != nil {
-			Logger.Error(err)
-			return
-		}
+	go printAppMetrics()
+	if config.PPROFAddress != "" {
+		go startPPROFServer(config.PPROFAddress)
+	}
 
-		_, err = s.Open(reqData)
-		if err != nil {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Listen()
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	for {
+		select {
+		case err := <-errs:
 			Logger.Error(err)
+			if err := s.Close(); err != nil {
+				Logger.Error(err)
+			}
+
+			os.Exit(ExitListen)
+		case sig := <-sigs:
+			if sig == syscall.SIGHUP {
+				reload(s)
+				continue
+			}
+
+			Logger.Info("shutting down on", sig)
+			if err := s.Close(); err != nil {
+				Logger.Error(err)
+				os.Exit(ExitShutdown)
+			}
+
+			Logger.Info("shutdown complete")
 			return
 		}
 	}
 }
 
+// reload reads the config again and applies logging, rate limits and
+// databases. Other settings need a restart.
+func reload(s Server) {
+	config, err := loadConfig(os.Args[1:])
+	if err != nil {
+		Logger.Error("reload:", err)
+		return
+	}
+
+	if err := configureLogging(config.Log); err != nil {
+		Logger.Error("reload:", err)
+	}
+
+	if err := s.Reload(config.options()); err != nil {
+		Logger.Error("reload:", err)
+		return
+	}
+
+	Logger.Info("reload: config applied")
+}
+
 func printAppMetrics() {
 	buff := bytes.NewBuffer(nil)
 	encd := json.NewEncoder(buff)
@@ -112,7 +172,7 @@ func printAppMetrics() {
 	}
 }
 
-func startPPROFServer() {
-	Logger.Info("PPROF: listening on: " + PPROFAddr)
-	Logger.Info(http.ListenAndServe(PPROFAddr, nil))
+func startPPROFServer(addr string) {
+	Logger.Info("PPROF: listening on: " + addr)
+	Logger.Info(http.ListenAndServe(addr, nil))
 }
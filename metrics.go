@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// metrics has named values which are returned by the metrics handler
+type metrics struct {
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+func newMetrics() (m *metrics) {
+	return &metrics{values: make(map[string]float64)}
+}
+
+// add increments the value of a metric by delta
+func (m *metrics) add(name string, delta float64) {
+	m.mutex.Lock()
+	m.values[name] += delta
+	m.mutex.Unlock()
+}
+
+// set replaces the value of a metric
+func (m *metrics) set(name string, value float64) {
+	m.mutex.Lock()
+	m.values[name] = value
+	m.mutex.Unlock()
+}
+
+// get returns the current value of a metric
+func (m *metrics) get(name string) (value float64) {
+	m.mutex.Lock()
+	value = m.values[name]
+	m.mutex.Unlock()
+	return value
+}
+
+// snapshot returns all metrics sorted by name
+func (m *metrics) snapshot() (res []*Metric) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	res = make([]*Metric, 0, len(m.values))
+	for name, value := range m.values {
+		res = append(res, &Metric{Name: name, Value: value})
+	}
+
+	sort.Sort(metricsByName(res))
+	return res
+}
+
+type metricsByName []*Metric
+
+func (ms metricsByName) Len() int           { return len(ms) }
+func (ms metricsByName) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+func (ms metricsByName) Less(i, j int) bool { return ms[i].Name < ms[j].Name }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/golang/snappy"
+)
+
+const (
+	// PromNameLabel is the label which has the prometheus metric name
+	PromNameLabel = "__name__"
+
+	// PromMaxBody is the maximum size of a compressed write request
+	PromMaxBody = 32 * 1024 * 1024
+)
+
+var (
+	// ErrPromMapping is returned when a series doesn't match any mapping
+	ErrPromMapping = errors.New("no prometheus mapping for metric")
+
+	// ErrPromLabel is returned when a series has labels not used in the
+	// mapping. Writing them would merge different series into one.
+	ErrPromLabel = errors.New("series has unmapped labels")
+)
+
+// PromMapping maps prometheus metrics with a name prefix to a database.
+// Each entry in Fields can be "label:<name>" (a label value) or any other
+// literal value. Labels which are not used in Fields must be listed in
+// Ignore, otherwise the series is counted as unmapped and not written.
+type PromMapping struct {
+	Prefix   string   `json:"prefix"`
+	Database string   `json:"database"`
+	Fields   []string `json:"fields"`
+	Ignore   []string `json:"ignore"`
+}
+
+// PromResult reports written samples and unmapped series per metric
+type PromResult struct {
+	Samples   int            `json:"samples"`
+	Failed    int            `json:"failed"`
+	Throttled int            `json:"throttled"`
+	Unmapped  map[string]int `json:"unmapped,omitempty"`
+}
+
+type prometheus struct {
+	server   *server
+	mappings []*PromMapping
+}
+
+func newPrometheus(s *server, mappings []*PromMapping) (pm *prometheus) {
+	return &prometheus{server: s, mappings: mappings}
+}
+
+// ServeHTTP handles snappy compressed remote_write requests
+func (pm *prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer Logger.Time(time.Now(), time.Second, "prometheus.write")
+
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !pm.server.authorizeHTTP(w, r, pm.databases(), OpWrite) {
+		return
+	}
+
+	compressed, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, PromMaxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &WriteRequest{}
+	if err := req.Unmarshal(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := pm.write(req, pm.server.rateClient(httpToken(r)))
+
+	// prometheus retries on server errors so failed writes are sent
+	// again. Unmapped series are reported in the response and in metrics
+	// instead because retries won't help.
+	w.Header().Set("Content-Type", "application/json")
+	if res.Failed > 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else if res.Throttled > 0 {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		Logger.Error(err)
+	}
+}
+
+// write stores all samples of mapped series with put. Samples are rate
+// limited like put requests of the client.
+func (pm *prometheus) write(req *WriteRequest, client string) (res *PromResult) {
+	res = &PromResult{Unmapped: map[string]int{}}
+
+	for _, ts := range req.Timeseries {
+		labels := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			labels[l.Name] = l.Value
+		}
+
+		name := labels[PromNameLabel]
+		database, fields, err := pm.resolve(labels)
+		if err != nil {
+			res.Unmapped[name]++
+			pm.server.metrics.add("prometheus.unmapped", 1)
+			continue
+		}
+
+		for _, sample := range ts.Samples {
+			req := &PutReq{
+				Database:  database,
+				Fields:    fields,
+				Timestamp: uint32(sample.Timestamp / 1000),
+				Value:     sample.Value,
+				Count:     1,
+			}
+
+			if err := pm.server.limits.take(client, database, LimitWrites, 1); err != nil {
+				res.Throttled++
+				continue
+			}
+
+			if _, err := pm.server.put(req); err != nil {
+				Logger.Error(err)
+				res.Failed++
+				continue
+			}
+
+			res.Samples++
+		}
+	}
+
+	pm.server.metrics.add("prometheus.samples", float64(res.Samples))
+	return res
+}
+
+// databases returns all databases used by mappings
+func (pm *prometheus) databases() (names []string) {
+	for _, mp := range pm.mappings {
+		names = append(names, mp.Database)
+	}
+
+	return names
+}
+
+// resolve finds the database and fields for a label set using mappings
+func (pm *prometheus) resolve(labels map[string]string) (database string, fields []string, err error) {
+	name := labels[PromNameLabel]
+
+	for _, mp := range pm.mappings {
+		if !strings.HasPrefix(name, mp.Prefix) {
+			continue
+		}
+
+		used := map[string]bool{}
+		for _, l := range mp.Ignore {
+			used[l] = true
+		}
+
+		fields = make([]string, len(mp.Fields))
+		for i, f := range mp.Fields {
+			if strings.HasPrefix(f, "label:") {
+				l := strings.TrimPrefix(f, "label:")
+				fields[i] = labels[l]
+				used[l] = true
+			} else {
+				fields[i] = f
+			}
+		}
+
+		for l := range labels {
+			if !used[l] {
+				return "", nil, goerr.Wrap(ErrPromLabel, 0)
+			}
+		}
+
+		return mp.Database, fields, nil
+	}
+
+	return "", nil, goerr.Wrap(ErrPromMapping, 0)
+}
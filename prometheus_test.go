@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+func TestPrometheusWrite(t *testing.T) {
+	dir := "/tmp/d-prometheus"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	_, err = s.open(&OpenReq{
+		Database:    "prom",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm := newPrometheus(s, []*PromMapping{{
+		Prefix:   "http_",
+		Database: "prom",
+		Fields:   []string{"label:__name__", "label:job"},
+		Ignore:   []string{"instance"},
+	}})
+
+	now := time.Now()
+	ms := now.UnixNano() / 1e6
+	req := &WriteRequest{
+		Timeseries: []*TimeSeries{
+			{
+				Labels: []*Label{
+					{Name: "__name__", Value: "http_requests"},
+					{Name: "job", Value: "api"},
+					{Name: "instance", Value: "h1"},
+				},
+				Samples: []*Sample{{Value: 42, Timestamp: ms}},
+			},
+			{
+				Labels: []*Label{
+					{Name: "__name__", Value: "http_requests"},
+					{Name: "job", Value: "api"},
+					{Name: "code", Value: "200"},
+				},
+				Samples: []*Sample{{Value: 1, Timestamp: ms}},
+			},
+			{
+				Labels:  []*Label{{Name: "__name__", Value: "up"}},
+				Samples: []*Sample{{Value: 1, Timestamp: ms}},
+			},
+		},
+	}
+
+	data, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := bytes.NewReader(snappy.Encode(nil, data))
+	w := httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/write", body))
+
+	if w.Code != http.StatusOK {
+		t.Fatal("wrong status", w.Code)
+	}
+
+	res := &PromResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Samples != 1 || res.Unmapped["http_requests"] != 1 || res.Unmapped["up"] != 1 {
+		t.Fatal("wrong result", res)
+	}
+
+	if s.metrics.get("prometheus.unmapped") != 2 {
+		t.Fatal("unmapped series should be counted")
+	}
+
+	ts := uint32(now.Unix())
+	get, err := s.get(&GetReq{
+		Database:  "prom",
+		Fields:    []string{"http_requests", "api"},
+		GroupBy:   []bool{true, true},
+		StartTime: ts,
+		EndTime:   ts + 60,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(get.Groups) != 1 || get.Groups[0].Points[0].Value != 42 {
+		t.Fatal("incorrect values for point")
+	}
+
+	// samples are rate limited like puts
+	s.limits.set([]*RateLimit{{Database: "prom", Writes: 1}})
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		pm.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/write", bytes.NewReader(snappy.Encode(nil, data))))
+	}
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatal("samples over the rate limit should be throttled", w.Code)
+	}
+
+	s.limits.set(nil)
+
+	// failed writes should be retried by prometheus
+	pm.mappings[0].Database = "missing"
+	w = httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/write", bytes.NewReader(snappy.Encode(nil, data))))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatal("failed writes should return a server error", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	pm.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/write", bytes.NewReader(make([]byte, PromMaxBody+1))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatal("large requests should be rejected", w.Code)
+	}
+}
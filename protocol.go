@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/kadirahq/kadiradb/protocol"
+)
+
+// Request and response types are generated in the protocol package so the
+// client package can use the same types.
+type (
+	Request        = protocol.Request
+	ReqBatch       = protocol.ReqBatch
+	Response       = protocol.Response
+	ResBatch       = protocol.ResBatch
+	InfoReq        = protocol.InfoReq
+	InfoRes        = protocol.InfoRes
+	DBInfo         = protocol.DBInfo
+	OpenReq        = protocol.OpenReq
+	OpenRes        = protocol.OpenRes
+	EditReq        = protocol.EditReq
+	EditRes        = protocol.EditRes
+	PutReq         = protocol.PutReq
+	PutRes         = protocol.PutRes
+	IncReq         = protocol.IncReq
+	IncRes         = protocol.IncRes
+	GetReq         = protocol.GetReq
+	GetRes         = protocol.GetRes
+	ResSeries      = protocol.ResSeries
+	ResPoint       = protocol.ResPoint
+	SubscribeReq   = protocol.SubscribeReq
+	SubscribeRes   = protocol.SubscribeRes
+	PollReq        = protocol.PollReq
+	PollRes        = protocol.PollRes
+	StreamPoint    = protocol.StreamPoint
+	UnsubscribeReq = protocol.UnsubscribeReq
+	UnsubscribeRes = protocol.UnsubscribeRes
+	AlertRule      = protocol.AlertRule
+	AlertState     = protocol.AlertState
+	SetAlertReq    = protocol.SetAlertReq
+	SetAlertRes    = protocol.SetAlertRes
+	DelAlertReq    = protocol.DelAlertReq
+	DelAlertRes    = protocol.DelAlertRes
+	ListAlertsReq  = protocol.ListAlertsReq
+	ListAlertsRes  = protocol.ListAlertsRes
+	DropReq        = protocol.DropReq
+	DropRes        = protocol.DropRes
+	ReplicateReq   = protocol.ReplicateReq
+	ReplicateRes   = protocol.ReplicateRes
+	ReplOp         = protocol.ReplOp
+	BackupReq      = protocol.BackupReq
+	BackupRes      = protocol.BackupRes
+	RestoreReq     = protocol.RestoreReq
+	RestoreRes     = protocol.RestoreRes
+	MetricsReq     = protocol.MetricsReq
+	MetricsRes     = protocol.MetricsRes
+	Metric         = protocol.Metric
+	ReconcileReq   = protocol.ReconcileReq
+	ReconcileRes   = protocol.ReconcileRes
+	DBChange       = protocol.DBChange
+	RetryReq       = protocol.RetryReq
+	RetryRes       = protocol.RetryRes
+)
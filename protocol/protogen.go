@@ -0,0 +1,5 @@
+// Package protocol has request and response types of the kadiradb rpc
+// api. They are shared by the server and the client package.
+package protocol
+
+//go:generate protoc --gogofaster_out=. protocol.proto
@@ -1,2 +1,2 @@
-//go:generate protoc --gogofaster_out=. protocol.proto
+//go:generate protoc --gogofaster_out=. prometheus.proto
 package main
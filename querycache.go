@@ -0,0 +1,445 @@
+package main
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kadirahq/kadiyadb"
+)
+
+// cacheKey identifies a query for the closed part of a time range.
+// Fields and group by values are joined so the key can be compared.
+type cacheKey struct {
+	database   string
+	fields     string
+	groupBy    string
+	resolution int64
+	duration   int64
+	start      int64
+	end        int64
+}
+
+// newCacheKey normalizes a get request. Group by values after the last
+// field do not change results so they are not part of the key.
+func newCacheKey(req *GetReq, start, end, resolution, duration int64) (key cacheKey) {
+	count := len(req.GroupBy)
+	if count > len(req.Fields) {
+		count = len(req.Fields)
+	}
+
+	groupBy := make([]byte, count)
+	for i := 0; i < count; i++ {
+		groupBy[i] = '0'
+		if req.GroupBy[i] {
+			groupBy[i] = '1'
+		}
+	}
+
+	return cacheKey{
+		database:   req.Database,
+		fields:     strings.Join(req.Fields, "\x00"),
+		groupBy:    string(groupBy),
+		resolution: resolution,
+		duration:   duration,
+		start:      start,
+		end:        end,
+	}
+}
+
+// epochs returns start times of epochs in the range of a key
+func (key cacheKey) epochs() (starts []int64) {
+	for ts := key.start - key.start%key.duration; ts < key.end; ts += key.duration {
+		starts = append(starts, ts)
+	}
+
+	return starts
+}
+
+// cacheEntry has grouped series of a cached query
+type cacheEntry struct {
+	key    cacheKey
+	filter []string
+	groups []*ResSeries
+}
+
+// cacheCall is a query which is running. It's marked stale when a write
+// changes its range so the result is not cached.
+type cacheCall struct {
+	key    cacheKey
+	filter []string
+	stale  bool
+}
+
+// cacheIndex has entries and running calls of a database by the start
+// time of each epoch in their range so writes only check those which
+// cover the epoch of the point.
+type cacheIndex struct {
+	duration int64
+	entries  map[int64]map[*list.Element]bool
+	calls    map[int64]map[*cacheCall]bool
+}
+
+func newCacheIndex(duration int64) (x *cacheIndex) {
+	return &cacheIndex{
+		duration: duration,
+		entries:  make(map[int64]map[*list.Element]bool),
+		calls:    make(map[int64]map[*cacheCall]bool),
+	}
+}
+
+func (x *cacheIndex) addEntry(el *list.Element) {
+	for _, epoch := range el.Value.(*cacheEntry).key.epochs() {
+		if x.entries[epoch] == nil {
+			x.entries[epoch] = make(map[*list.Element]bool)
+		}
+
+		x.entries[epoch][el] = true
+	}
+}
+
+func (x *cacheIndex) removeEntry(el *list.Element) {
+	for _, epoch := range el.Value.(*cacheEntry).key.epochs() {
+		delete(x.entries[epoch], el)
+		if len(x.entries[epoch]) == 0 {
+			delete(x.entries, epoch)
+		}
+	}
+}
+
+func (x *cacheIndex) addCall(call *cacheCall) {
+	for _, epoch := range call.key.epochs() {
+		if x.calls[epoch] == nil {
+			x.calls[epoch] = make(map[*cacheCall]bool)
+		}
+
+		x.calls[epoch][call] = true
+	}
+}
+
+func (x *cacheIndex) removeCall(call *cacheCall) {
+	for _, epoch := range call.key.epochs() {
+		delete(x.calls[epoch], call)
+		if len(x.calls[epoch]) == 0 {
+			delete(x.calls, epoch)
+		}
+	}
+}
+
+// queryCache keeps results of queries for closed epochs which do not
+// change unless points are written into them. The least recently used
+// entry is removed when the cache is full.
+type queryCache struct {
+	mutex   sync.Mutex
+	max     int
+	lru     *list.List
+	entries map[cacheKey]*list.Element
+	indexes map[string]*cacheIndex
+	metrics *metrics
+}
+
+func newQueryCache(max int, m *metrics) (c *queryCache) {
+	return &queryCache{
+		max:     max,
+		lru:     list.New(),
+		entries: make(map[cacheKey]*list.Element),
+		indexes: make(map[string]*cacheIndex),
+		metrics: m,
+	}
+}
+
+// index returns the index of the database of a key. Entries and calls of
+// the database are dropped with the index when the epoch duration of the
+// key is different (the database was created again). The mutex must be
+// held.
+func (c *queryCache) index(key cacheKey) (x *cacheIndex) {
+	x, ok := c.indexes[key.database]
+	if ok && x.duration != key.duration {
+		c.drop(key.database)
+		ok = false
+	}
+
+	if !ok {
+		x = newCacheIndex(key.duration)
+		c.indexes[key.database] = x
+	}
+
+	return x
+}
+
+// get returns a copy of cached groups or starts a call which must be
+// completed with put
+func (c *queryCache) get(key cacheKey, filter []string) (groups []*ResSeries, call *cacheCall, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		c.count(true)
+		return copyGroups(el.Value.(*cacheEntry).groups), nil, true
+	}
+
+	c.count(false)
+	call = &cacheCall{key: key, filter: filter}
+	c.index(key).addCall(call)
+	return nil, call, false
+}
+
+// put completes a call and caches its groups unless it's stale
+func (c *queryCache) put(call *cacheCall, groups []*ResSeries) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.removeCall(call)
+	if call.stale {
+		return
+	}
+
+	if el, ok := c.entries[call.key]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	entry := &cacheEntry{key: call.key, filter: call.filter, groups: copyGroups(groups)}
+	el := c.lru.PushFront(entry)
+	c.entries[call.key] = el
+	c.index(call.key).addEntry(el)
+
+	for c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+	}
+
+	c.metrics.set("querycache.entries", float64(c.lru.Len()))
+}
+
+// done completes a call which failed
+func (c *queryCache) done(call *cacheCall) {
+	c.mutex.Lock()
+	c.removeCall(call)
+	c.mutex.Unlock()
+}
+
+// count updates hit and miss metrics. The mutex must be held.
+func (c *queryCache) count(hit bool) {
+	if hit {
+		c.metrics.add("querycache.hits", 1)
+	} else {
+		c.metrics.add("querycache.misses", 1)
+	}
+
+	hits := c.metrics.get("querycache.hits")
+	misses := c.metrics.get("querycache.misses")
+	c.metrics.set("querycache.hitRate", hits/(hits+misses))
+}
+
+// invalidate removes entries and marks running calls which cover a point
+func (c *queryCache) invalidate(database string, fields []string, ts int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	x, ok := c.indexes[database]
+	if !ok {
+		return
+	}
+
+	epoch := ts - ts%x.duration
+	covers := func(key cacheKey, filter []string) bool {
+		return key.start <= ts && ts < key.end && matchFields(filter, fields)
+	}
+
+	for call := range x.calls[epoch] {
+		if covers(call.key, call.filter) {
+			call.stale = true
+		}
+	}
+
+	var removed []*list.Element
+	for el := range x.entries[epoch] {
+		if e := el.Value.(*cacheEntry); covers(e.key, e.filter) {
+			removed = append(removed, el)
+		}
+	}
+
+	c.invalidated(removed)
+}
+
+// invalidateDatabase removes all entries of a database
+func (c *queryCache) invalidateDatabase(database string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.drop(database)
+}
+
+// drop removes entries and the index of a database and marks its running
+// calls. The mutex must be held.
+func (c *queryCache) drop(database string) {
+	x, ok := c.indexes[database]
+	if !ok {
+		return
+	}
+
+	for _, calls := range x.calls {
+		for call := range calls {
+			call.stale = true
+		}
+	}
+
+	var removed []*list.Element
+	for key, el := range c.entries {
+		if key.database == database {
+			removed = append(removed, el)
+		}
+	}
+
+	c.invalidated(removed)
+	delete(c.indexes, database)
+}
+
+// invalidated removes entries which were invalidated by writes. The mutex
+// must be held.
+func (c *queryCache) invalidated(els []*list.Element) {
+	if len(els) == 0 {
+		return
+	}
+
+	for _, el := range els {
+		c.remove(el)
+	}
+
+	c.metrics.add("querycache.invalidations", float64(len(els)))
+	c.metrics.set("querycache.entries", float64(c.lru.Len()))
+}
+
+// remove removes an entry. The mutex must be held.
+func (c *queryCache) remove(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.entries, entry.key)
+	if x, ok := c.indexes[entry.key.database]; ok && x.duration == entry.key.duration {
+		x.removeEntry(el)
+	}
+}
+
+// removeCall removes a call from the index of its database. The index
+// may have been dropped while the call was running. The mutex must be
+// held.
+func (c *queryCache) removeCall(call *cacheCall) {
+	if x, ok := c.indexes[call.key.database]; ok && x.duration == call.key.duration {
+		x.removeCall(call)
+	}
+}
+
+// copyGroups copies series so cached results are not changed by callers
+func copyGroups(groups []*ResSeries) (res []*ResSeries) {
+	res = make([]*ResSeries, len(groups))
+	for i, sr := range groups {
+		res[i] = &ResSeries{
+			Fields: append([]string{}, sr.Fields...),
+			Points: make([]*ResPoint, len(sr.Points)),
+		}
+
+		for j, p := range sr.Points {
+			res[i].Points[j] = newResPoint(p.Value, p.Count)
+		}
+	}
+
+	return res
+}
+
+// joinGroups concatenates points of groups from two adjacent ranges.
+// Series which are missing in one range get empty points.
+func joinGroups(first, second []*ResSeries, firstLen, secondLen int) (res []*ResSeries) {
+	index := make(map[string]*ResSeries, len(first))
+	for _, sr := range first {
+		index[seriesKey(sr.Fields)] = sr
+		res = append(res, sr)
+	}
+
+	for _, sr := range second {
+		if prev, ok := index[seriesKey(sr.Fields)]; ok {
+			prev.Points = append(prev.Points, sr.Points...)
+			delete(index, seriesKey(sr.Fields))
+			continue
+		}
+
+		sn := newResSeries(sr.Fields)
+		sn.Points = append(emptyPoints(firstLen), sr.Points...)
+		res = append(res, sn)
+	}
+
+	// series which only have points in the first range
+	for _, sr := range index {
+		sr.Points = append(sr.Points, emptyPoints(secondLen)...)
+	}
+
+	return res
+}
+
+func emptyPoints(n int) (points []*ResPoint) {
+	points = make([]*ResPoint, n)
+	for i := range points {
+		points[i] = newResPoint(0, 0)
+	}
+
+	return points
+}
+
+// invalidateCache removes cached results which have a point
+func (s *server) invalidateCache(database string, fields []string, timestamp uint32) {
+	if s.cache != nil {
+		s.cache.invalidate(database, fields, int64(timestamp)*1e9)
+	}
+}
+
+// cachedScan scans the part of a range in read-write epochs and uses the
+// cache for the part in closed read-only epochs. The cached part starts
+// at the start of an epoch so queries with a sliding start time can use
+// the same entry until it moves to the next epoch.
+func (s *server) cachedScan(db kadiyadb.Database, metadata *kadiyadb.Metadata, req *GetReq, g *queryGuard, start, end, resolution int64) (groups []*ResSeries, scanned int, err error) {
+	open := rwStart(metadata, time.Now().UnixNano())
+	open -= open % resolution
+
+	if open <= start {
+		return s.scan(db, metadata, req, g, start, end, resolution)
+	}
+
+	if open > end {
+		open = end
+	}
+
+	cacheStart := start - start%metadata.Duration
+	cacheStart -= cacheStart % resolution
+
+	key := newCacheKey(req, cacheStart, open, resolution, metadata.Duration)
+	closed, call, ok := s.cache.get(key, req.Fields)
+	if !ok {
+		closed, scanned, err = s.scan(db, metadata, req, g, cacheStart, open, resolution)
+		if err != nil {
+			s.cache.done(call)
+			return nil, 0, err
+		}
+
+		s.cache.put(call, closed)
+	}
+
+	// points before the start of the query are not in results
+	skip := int((start - cacheStart) / resolution)
+	for _, sr := range closed {
+		sr.Points = sr.Points[skip:]
+	}
+
+	if open == end {
+		return closed, scanned, nil
+	}
+
+	recent, n, err := s.scan(db, metadata, req, g, open, end, resolution)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	closedLen := int((open - start) / resolution)
+	recentLen := int((end - open) / resolution)
+	return joinGroups(closed, recent, closedLen, recentLen), scanned + n, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryCache(t *testing.T) {
+	open := testOpenReq("test")
+	open.MaxROEpochs = 8
+	open.MaxRWEpochs = 1
+
+	s := newTestServer(t, &Options{Path: "/tmp/d-querycache", QueryCacheSize: 10, Databases: []*OpenReq{open}})
+	now := uint32(time.Now().Unix())
+	now -= now % 60
+	old := now - 3*3600
+
+	put := func(field string, ts uint32, val float64) {
+		req := &PutReq{Database: "test", Fields: []string{field}, Timestamp: ts, Value: val, Count: 1}
+		if _, err := s.put(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := now - 4*3600
+	count := int((now + 60 - start) / 60)
+
+	query := func() (points map[string][]*ResPoint, scanned int) {
+		req := &GetReq{Database: "test", Fields: []string{""}, GroupBy: []bool{true}, StartTime: start, EndTime: now + 60}
+		res, scanned, err := s.query(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		points = make(map[string][]*ResPoint)
+		for _, sr := range res.Groups {
+			if len(sr.Points) != count {
+				t.Fatal("wrong number of points", sr.Fields, len(sr.Points))
+			}
+
+			points[sr.Fields[0]] = sr.Points
+		}
+
+		return points, scanned
+	}
+
+	put("a", old, 1)
+	put("a", now, 2)
+	put("b", now, 3)
+
+	first, _ := query()
+	points, scanned := query()
+	if s.metrics.get("querycache.hits") != 1 || s.metrics.get("querycache.misses") != 1 {
+		t.Fatal("second query should use the cache")
+	}
+
+	if s.metrics.get("querycache.hitRate") != 0.5 {
+		t.Fatal("wrong hit rate", s.metrics.get("querycache.hitRate"))
+	}
+
+	if scanned >= count {
+		t.Fatal("closed epochs should not be scanned again", scanned)
+	}
+
+	for _, pts := range []map[string][]*ResPoint{first, points} {
+		a, b := pts["a"], pts["b"]
+		if a == nil || b == nil {
+			t.Fatal("missing series")
+		}
+
+		if a[(old-start)/60].Value != 1 || a[count-1].Value != 2 {
+			t.Fatal("wrong values for a")
+		}
+
+		if b[(old-start)/60].Count != 0 || b[count-1].Value != 3 {
+			t.Fatal("wrong values for b")
+		}
+	}
+
+	// results are copied so callers can not change cached points
+	points["a"][(old-start)/60].Value = 100
+
+	put("a", old, 5)
+	if s.metrics.get("querycache.invalidations") != 1 {
+		t.Fatal("writes should invalidate cached results")
+	}
+
+	points, _ = query()
+	if points["a"][(old-start)/60].Value != 5 {
+		t.Fatal("queries should see writes after invalidation")
+	}
+
+	// writes to read-write epochs do not invalidate closed ranges
+	put("a", now, 4)
+	points, _ = query()
+	if s.metrics.get("querycache.hits") != 2 {
+		t.Fatal("cache should be used after writes to open epochs")
+	}
+
+	if points["a"][count-1].Value != 4 || points["a"][(old-start)/60].Value != 5 {
+		t.Fatal("wrong values after write to open epochs")
+	}
+
+	// queries which start later in the same epoch use the cached range
+	sliding := start - start%3600 + 60
+	req := &GetReq{Database: "test", Fields: []string{""}, GroupBy: []bool{true}, StartTime: sliding, EndTime: now + 60}
+	res, _, err := s.query(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.metrics.get("querycache.hits") != 3 {
+		t.Fatal("queries with a later start should use the cache")
+	}
+
+	for _, sr := range res.Groups {
+		if len(sr.Points) != int((now+60-sliding)/60) {
+			t.Fatal("wrong number of points", len(sr.Points))
+		}
+
+		if sr.Fields[0] == "a" && sr.Points[(old-sliding)/60].Value != 5 {
+			t.Fatal("wrong values with a later start")
+		}
+	}
+
+	// writes only check entries which cover the epoch of the point
+	x := s.cache.indexes["test"]
+	if len(x.entries[int64(now-now%3600)*1e9]) != 0 || len(x.entries[int64(old-old%3600)*1e9]) != 1 {
+		t.Fatal("entries should be indexed by epoch", x.entries)
+	}
+
+	if _, err := s.drop(&DropReq{Database: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.cache.entries) != 0 {
+		t.Fatal("dropping a database should remove cached results")
+	}
+
+	closeTestServer(t, s)
+}
+
+func TestQueryCacheRecreated(t *testing.T) {
+	c := newQueryCache(10, newMetrics())
+	cache := func(key cacheKey) {
+		_, call, ok := c.get(key, []string{""})
+		if ok {
+			t.Fatal("key should not be cached")
+		}
+
+		c.put(call, nil)
+	}
+
+	cache(cacheKey{database: "a", duration: 3600, start: 0, end: 7200})
+	c.invalidateDatabase("a")
+	if _, ok := c.indexes["a"]; ok || c.lru.Len() != 0 {
+		t.Fatal("dropped databases should not have entries or an index")
+	}
+
+	// databases which are created again can have another epoch duration
+	cache(cacheKey{database: "a", duration: 3600, start: 0, end: 7200})
+	key := cacheKey{database: "a", duration: 1800, start: 0, end: 3600}
+	cache(key)
+	if c.indexes["a"].duration != 1800 || c.lru.Len() != 1 {
+		t.Fatal("entries of the old database should be dropped")
+	}
+
+	c.invalidate("a", []string{"x"}, 1900)
+	if _, _, ok := c.get(key, []string{""}); ok {
+		t.Fatal("writes should invalidate entries with the new duration")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// checkInterval is the number of series grouped between time checks
+	checkInterval = 1000
+)
+
+var (
+	// ErrQueryPoints is returned when the range of a query is too long
+	ErrQueryPoints = errors.New("query limit: time range has too many points for the resolution")
+
+	// ErrQuerySeries is returned when a query reads too many series
+	ErrQuerySeries = errors.New("query limit: too many series match the fields")
+
+	// ErrQueryGroups is returned when a query returns too many groups
+	ErrQueryGroups = errors.New("query limit: too many groups, group by fewer fields")
+
+	// ErrQueryTimeout is returned when a query runs for too long
+	ErrQueryTimeout = errors.New("query limit: query timed out")
+)
+
+// QueryLimit limits get requests. Database is a name or a prefix ending
+// with "*". A limit with an empty database has server defaults which are
+// used when no other matching limit sets a value. Values which are zero
+// are not checked.
+//
+// MaxPoints is the number of points of each series in the time range at
+// the requested resolution. MaxSeries is the number of series read from
+// storage and MaxGroups is the number of series returned after grouping.
+type QueryLimit struct {
+	Database  string   `json:"database"`
+	MaxPoints int      `json:"maxPoints"`
+	MaxSeries int      `json:"maxSeries"`
+	MaxGroups int      `json:"maxGroups"`
+	Timeout   Duration `json:"timeout"`
+}
+
+// queryLimits finds limits of databases. Limits can be replaced while
+// they are used.
+type queryLimits struct {
+	mutex   sync.RWMutex
+	rules   []*QueryLimit
+	metrics *metrics
+}
+
+func newQueryLimits(rules []*QueryLimit, m *metrics) (l *queryLimits) {
+	l = &queryLimits{metrics: m}
+	l.set(rules)
+	return l
+}
+
+// set replaces limits
+func (l *queryLimits) set(rules []*QueryLimit) {
+	l.mutex.Lock()
+	l.rules = rules
+	l.mutex.Unlock()
+}
+
+// get merges limits which match a database. Each value is taken from the
+// first limit which sets it and database limits are used before defaults.
+func (l *queryLimits) get(database string) (limit *QueryLimit) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	limit = &QueryLimit{Database: database}
+	for _, defaults := range []bool{false, true} {
+		for _, rule := range l.rules {
+			if defaults != (rule.Database == "") {
+				continue
+			}
+
+			if !defaults && !matchDatabase(rule.Database, database) {
+				continue
+			}
+
+			if limit.MaxPoints == 0 {
+				limit.MaxPoints = rule.MaxPoints
+			}
+
+			if limit.MaxSeries == 0 {
+				limit.MaxSeries = rule.MaxSeries
+			}
+
+			if limit.MaxGroups == 0 {
+				limit.MaxGroups = rule.MaxGroups
+			}
+
+			if limit.Timeout == 0 {
+				limit.Timeout = rule.Timeout
+			}
+		}
+	}
+
+	return limit
+}
+
+// guard starts checking limits of a query
+func (l *queryLimits) guard(database string) (g *queryGuard) {
+	g = &queryGuard{limit: l.get(database), series: make(map[string]bool), metrics: l.metrics}
+	if g.limit.Timeout > 0 {
+		g.deadline = time.Now().Add(time.Duration(g.limit.Timeout))
+	}
+
+	return g
+}
+
+// queryGuard checks limits while a query runs. The timeout is checked
+// between steps so a slow read from storage is stopped after it returns.
+// Series are counted once when a query reads more than one range.
+type queryGuard struct {
+	limit    *QueryLimit
+	deadline time.Time
+	series   map[string]bool
+	metrics  *metrics
+}
+
+// fail counts a query which is over a limit
+func (g *queryGuard) fail(kind string, err error) error {
+	g.metrics.add("querylimit.rejected."+kind, 1)
+	g.metrics.add("querylimit.rejected."+kind+"."+g.limit.Database, 1)
+	return goerr.Wrap(err, 0)
+}
+
+// checkRange checks the number of points of each series in a range
+func (g *queryGuard) checkRange(start, end, resolution int64) (err error) {
+	if g.limit.MaxPoints > 0 && (end-start)/resolution > int64(g.limit.MaxPoints) {
+		return g.fail("points", ErrQueryPoints)
+	}
+
+	return nil
+}
+
+// checkIndex checks the number of series which match a query in the
+// series index before storage is read
+func (g *queryGuard) checkIndex(n int) (err error) {
+	if g.limit.MaxSeries > 0 && n > g.limit.MaxSeries {
+		return g.fail("series", ErrQuerySeries)
+	}
+
+	return nil
+}
+
+// addSeries counts a series read from storage
+func (g *queryGuard) addSeries(fields []string) (err error) {
+	if g.limit.MaxSeries == 0 {
+		return nil
+	}
+
+	g.series[seriesKey(fields)] = true
+	if len(g.series) > g.limit.MaxSeries {
+		return g.fail("series", ErrQuerySeries)
+	}
+
+	return nil
+}
+
+// checkGroups checks the number of series in results
+func (g *queryGuard) checkGroups(n int) (err error) {
+	if g.limit.MaxGroups > 0 && n > g.limit.MaxGroups {
+		return g.fail("groups", ErrQueryGroups)
+	}
+
+	return nil
+}
+
+// checkTime checks whether the query is over its timeout
+func (g *queryGuard) checkTime() (err error) {
+	if !g.deadline.IsZero() && time.Now().After(g.deadline) {
+		return g.fail("timeout", ErrQueryTimeout)
+	}
+
+	return nil
+}
+
+// checkSeriesIndex checks the series limit of a query with the series
+// index of the database. Results from the query cache are only checked
+// here since their series are not read again.
+func (s *server) checkSeriesIndex(req *GetReq, g *queryGuard, start int64) (err error) {
+	if g.limit.MaxSeries == 0 {
+		return nil
+	}
+
+	s.dbsMutex.RLock()
+	x := s.indexes[req.Database]
+	s.dbsMutex.RUnlock()
+
+	if x == nil {
+		return nil
+	}
+
+	return g.checkIndex(x.countMatching(req.Fields, start, g.limit.MaxSeries))
+}
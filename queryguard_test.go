@@ -0,0 +1,146 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+func TestQueryLimits(t *testing.T) {
+	open := func(name string) *OpenReq {
+		req := testOpenReq(name)
+		req.MaxROEpochs = 8
+		return req
+	}
+
+	limits := []*QueryLimit{
+		{Database: "big*", MaxPoints: 1000, MaxGroups: 10},
+		{MaxPoints: 60, MaxSeries: 3, MaxGroups: 2},
+	}
+
+	s := newTestServer(t, &Options{Path: "/tmp/d-queryguard", QueryLimits: limits, Databases: []*OpenReq{open("small"), open("bigger")}})
+	now := uint32(time.Now().Unix())
+	now -= now % 60
+
+	for _, db := range []string{"small", "bigger"} {
+		for _, field := range []string{"a", "b", "c", "d"} {
+			req := &PutReq{Database: db, Fields: []string{"x", field}, Timestamp: now, Value: 1, Count: 1}
+			if _, err := s.put(req); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	get := func(db string, start uint32, fields []string, groupBy []bool) (err error) {
+		req := &GetReq{Database: db, Fields: fields, GroupBy: groupBy, StartTime: start, EndTime: now + 60}
+		_, err = s.get(req)
+		return err
+	}
+
+	isErr := func(err, target error) bool {
+		if e, ok := err.(*goerr.Error); ok {
+			err = e.Err
+		}
+
+		return err == target
+	}
+
+	if err := get("small", now-3600, []string{"x", "a"}, nil); !isErr(err, ErrQueryPoints) {
+		t.Fatal("long ranges should be rejected", err)
+	}
+
+	if err := get("small", now-600, []string{"x", ""}, []bool{false, false}); !isErr(err, ErrQuerySeries) {
+		t.Fatal("queries over too many series should be rejected", err)
+	}
+
+	if err := get("small", now-600, []string{"x", "a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.metrics.get("querylimit.rejected.points") != 1 || s.metrics.get("querylimit.rejected.series.small") != 1 {
+		t.Fatal("rejected queries should be counted")
+	}
+
+	// database limits override defaults and other values use defaults
+	if err := get("bigger", now-3600, []string{"x", "a"}, nil); err != nil {
+		t.Fatal("database limits should override defaults", err)
+	}
+
+	if err := get("bigger", now-600, []string{"x", ""}, []bool{false, true}); !isErr(err, ErrQuerySeries) {
+		t.Fatal("defaults should be used for values without overrides", err)
+	}
+
+	if err := s.Reload(&Options{QueryLimits: []*QueryLimit{{MaxGroups: 2}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := get("small", now-600, []string{"x", ""}, []bool{false, true}); !isErr(err, ErrQueryGroups) {
+		t.Fatal("queries with too many groups should be rejected", err)
+	}
+
+	if err := get("small", now-600, []string{"x", ""}, []bool{false, false}); err != nil {
+		t.Fatal("reload should replace limits", err)
+	}
+
+	g := s.queryLimits.guard("small")
+	g.deadline = time.Now().Add(-time.Second)
+	if err := g.checkTime(); !isErr(err, ErrQueryTimeout) {
+		t.Fatal("queries over the timeout should be stopped", err)
+	}
+
+	closeTestServer(t, s)
+}
+
+func TestQueryLimitsCache(t *testing.T) {
+	open := testOpenReq("test")
+	open.MaxROEpochs = 8
+	open.MaxRWEpochs = 1
+
+	limits := []*QueryLimit{{MaxSeries: 2}}
+	s := newTestServer(t, &Options{Path: "/tmp/d-queryguard-cache", QueryCacheSize: 10, QueryLimits: limits, Databases: []*OpenReq{open}})
+	now := uint32(time.Now().Unix())
+	now -= now % 60
+	old := now - 3*3600
+
+	for _, field := range []string{"a", "b"} {
+		for _, ts := range []uint32{old, now} {
+			req := &PutReq{Database: "test", Fields: []string{field}, Timestamp: ts, Value: 1, Count: 1}
+			if _, err := s.put(req); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	get := func(start, end uint32) (err error) {
+		req := &GetReq{Database: "test", Fields: []string{""}, GroupBy: []bool{true}, StartTime: start, EndTime: end}
+		_, err = s.get(req)
+		return err
+	}
+
+	// closed and open epochs are read separately but series count once
+	if err := get(now-4*3600, now+60); err != nil {
+		t.Fatal("series should be counted once", err)
+	}
+
+	// the range ends where read-write epochs start so it's all cached
+	closed := now - now%3600
+	if err := get(now-4*3600, closed); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.metrics.get("querycache.hits") != 1 {
+		t.Fatal("closed range should be cached")
+	}
+
+	// cached results are checked with the series index
+	if err := s.Reload(&Options{QueryLimits: []*QueryLimit{{MaxSeries: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := get(now-4*3600, closed); !goerr.Is(err, ErrQuerySeries) {
+		t.Fatal("cached results should be limited", err)
+	}
+
+	closeTestServer(t, s)
+}
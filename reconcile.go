@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// ActionCreate creates a database which is not on the server
+	ActionCreate = "create"
+
+	// ActionUpdate changes epoch limits or the series limit of a database
+	ActionUpdate = "update"
+
+	// ActionDrop drops a database which is not listed (with prune)
+	ActionDrop = "drop"
+)
+
+var (
+	// ErrPruneAll is returned when prune is used without any databases
+	// which would drop all databases of the server
+	ErrPruneAll = errors.New("refusing to prune without database definitions")
+
+	// ErrPrunePartial is reported for databases which are not dropped
+	// because other definitions have errors
+	ErrPrunePartial = errors.New("not dropped because some definitions failed")
+
+	// ErrDefinition is returned for invalid database definitions
+	ErrDefinition = errors.New("resolution and epoch time must be positive and epoch time must be a multiple of resolution")
+)
+
+// reconcile creates and updates databases to match definitions and drops
+// databases which are not listed when prune is set. Errors are reported
+// for each database and do not stop other changes but nothing is dropped
+// when a definition is invalid or a database cannot be created. With dryRun, changes are only reported.
+func (s *server) reconcile(req *ReconcileReq) (res *ReconcileRes, err error) {
+	defer Logger.Time(time.Now(), 10*time.Second, "server.reconcile")
+	res = &ReconcileRes{}
+
+	if s.options.Follow != "" && !req.DryRun {
+		return nil, goerr.Wrap(ErrFollower, 0)
+	}
+
+	if req.Prune && len(req.Databases) == 0 {
+		return nil, goerr.Wrap(ErrPruneAll, 0)
+	}
+
+	var failed bool
+	listed := make(map[string]bool)
+	for _, dbr := range req.Databases {
+		if listed[dbr.Database] {
+			failed = true
+			res.Changes = append(res.Changes, &DBChange{
+				Database: dbr.Database,
+				Error:    "database is defined more than once",
+			})
+
+			continue
+		}
+
+		listed[dbr.Database] = true
+		if ch := s.reconcileDatabase(dbr, req.DryRun); ch != nil {
+			// existing databases which cannot be updated are still listed
+			failed = failed || (ch.Error != "" && ch.Action != ActionUpdate)
+			res.Changes = append(res.Changes, ch)
+		}
+	}
+
+	if !req.Prune {
+		return res, nil
+	}
+
+	var names []string
+	s.dbsMutex.RLock()
+	for name := range s.databases {
+		if !listed[name] {
+			names = append(names, name)
+		}
+	}
+	s.dbsMutex.RUnlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		ch := &DBChange{Database: name, Action: ActionDrop}
+		if failed {
+			// a database may be missing because its definition failed
+			ch.Error = ErrPrunePartial.Error()
+		} else if !req.DryRun {
+			if _, err := s.drop(&DropReq{Database: name}); err != nil {
+				ch.Error = err.Error()
+			}
+		}
+
+		res.Changes = append(res.Changes, ch)
+	}
+
+	return res, nil
+}
+
+// reconcileDatabase returns the change needed for a database definition
+// or nil if the database already matches it
+func (s *server) reconcileDatabase(req *OpenReq, dryRun bool) (ch *DBChange) {
+	ch = &DBChange{Database: req.Database}
+
+	if !validName(req.Database) {
+		ch.Error = ErrDatabaseName.Error()
+		return ch
+	}
+
+	if req.Resolution == 0 || req.EpochTime == 0 || req.EpochTime%req.Resolution != 0 {
+		ch.Error = ErrDefinition.Error()
+		return ch
+	}
+
+	db, ok := s.database(req.Database)
+	if !ok {
+		ch.Action = ActionCreate
+		ch.Details = []string{
+			fmt.Sprintf("resolution %ds", req.Resolution),
+			fmt.Sprintf("retention %ds", req.Retention),
+			fmt.Sprintf("epochTime %ds", req.EpochTime),
+			fmt.Sprintf("maxROEpochs %d", req.MaxROEpochs),
+			fmt.Sprintf("maxRWEpochs %d", req.MaxRWEpochs),
+			fmt.Sprintf("maxSeries %d", req.MaxSeries),
+		}
+
+		if !dryRun {
+			if _, err := s.open(req); err != nil {
+				ch.Error = err.Error()
+			}
+		}
+
+		return ch
+	}
+
+	metadata, err := db.Info()
+	if err != nil {
+		ch.Error = err.Error()
+		return ch
+	}
+
+	var maxSeries uint32
+	s.dbsMutex.RLock()
+	if x, ok := s.indexes[req.Database]; ok {
+		_, maxSeries = x.count()
+	}
+	s.dbsMutex.RUnlock()
+
+	// kadiyadb can only change epoch limits of existing databases and edit
+	// does not change retention either. These differences are errors so
+	// the reconcile command fails for them, also with -dry-run.
+	var fixed []string
+	check := func(name string, current, wanted int64) {
+		if current != wanted {
+			fixed = append(fixed, fmt.Sprintf("%s %ds -> %ds", name, current, wanted))
+		}
+	}
+
+	check("resolution", metadata.Resolution/1e9, int64(req.Resolution))
+	check("retention", metadata.Retention/1e9, int64(req.Retention))
+	check("epochTime", metadata.Duration/1e9, int64(req.EpochTime))
+
+	var details []string
+	change := func(name string, current, wanted uint32) {
+		if current != wanted {
+			details = append(details, fmt.Sprintf("%s %d -> %d", name, current, wanted))
+		}
+	}
+
+	change("maxROEpochs", metadata.MaxROEpochs, req.MaxROEpochs)
+	change("maxRWEpochs", metadata.MaxRWEpochs, req.MaxRWEpochs)
+
+	// series limits are only changed when they are defined
+	if req.MaxSeries > 0 {
+		change("maxSeries", maxSeries, req.MaxSeries)
+	}
+
+	if len(details) == 0 && len(fixed) == 0 {
+		return nil
+	}
+
+	ch.Action = ActionUpdate
+	ch.Details = details
+
+	if len(fixed) > 0 {
+		ch.Error = "cannot change " + strings.Join(fixed, ", ") + " without recreating the database"
+	}
+
+	if !dryRun && len(details) > 0 {
+		edit := &EditReq{
+			Database:    req.Database,
+			MaxROEpochs: req.MaxROEpochs,
+			MaxRWEpochs: req.MaxRWEpochs,
+			MaxSeries:   req.MaxSeries,
+		}
+
+		if _, err := s.edit(edit); err != nil {
+			ch.Error = err.Error()
+		}
+	}
+
+	return ch
+}
+
+// define reconciles databases from options and logs changes. Followers
+// get databases from the primary so definitions are ignored.
+func (s *server) define(reqs []*OpenReq, prune bool) {
+	if s.options.Follow != "" || (len(reqs) == 0 && !prune) {
+		return
+	}
+
+	res, err := s.reconcile(&ReconcileReq{Databases: reqs, Prune: prune})
+	if err != nil {
+		Logger.Error(err)
+		return
+	}
+
+	for _, ch := range res.Changes {
+		if ch.Error != "" {
+			Logger.Error("reconcile:", formatChange(ch))
+		} else {
+			Logger.Info("reconcile:", formatChange(ch))
+		}
+	}
+}
+
+// formatChange returns a line which describes a change
+func formatChange(ch *DBChange) (line string) {
+	line = ch.Database
+	if ch.Action != "" {
+		line = ch.Action + " " + line
+	}
+
+	if len(ch.Details) > 0 {
+		line += " (" + strings.Join(ch.Details, ", ") + ")"
+	}
+
+	if ch.Error != "" {
+		line += ": " + ch.Error
+	}
+
+	return line
+}
+
+// reconcileCommand applies database definitions from a json file to a
+// running server and prints changes. It fails when a change fails or
+// cannot be applied (like a retention change) even with -dry-run.
+func reconcileCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	addr := fs.String("addr", DefaultAddr, "server address")
+	token := fs.String("token", "", "authentication token")
+	secure := newTLSFlags(fs)
+	in := fs.String("in", path.Join(DefaultData, InitFile), "database definitions file")
+	prune := fs.Bool("prune", false, "drop databases which are not defined")
+	dryRun := fs.Bool("dry-run", false, "print changes without applying them")
+	fs.Parse(args)
+
+	req := &ReconcileReq{Prune: *prune, DryRun: *dryRun}
+	if err := readJSON(*in, &req.Databases); err != nil {
+		return err
+	}
+
+	conn, err := secure.dial(*addr, *token)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	call := conn.call
+
+	res := &ReconcileRes{}
+	if err := call("reconcile", req, res); err != nil {
+		return err
+	}
+
+	if len(res.Changes) == 0 {
+		fmt.Println("no changes")
+		return nil
+	}
+
+	var failed int
+	for _, ch := range res.Changes {
+		if ch.Error != "" {
+			failed++
+		}
+
+		fmt.Println(formatChange(ch))
+	}
+
+	if failed > 0 {
+		fmt.Fprintln(os.Stderr, failed, "of", len(res.Changes), "changes failed")
+		return goerr.Errorf("%d changes failed", failed)
+	}
+
+	return nil
+}
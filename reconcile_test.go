@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	goerr "github.com/go-errors/errors"
+)
+
+func TestReconcile(t *testing.T) {
+	def := func(name string, maxRW uint32) *OpenReq {
+		req := testOpenReq(name)
+		req.MaxRWEpochs = maxRW
+		return req
+	}
+
+	s := newTestServer(t, &Options{Path: "/tmp/d-reconcile", Databases: []*OpenReq{def("a", 2), def("b", 2)}})
+	defer closeTestServer(t, s)
+
+	changed := def("a", 3)
+	changed.Resolution = 30
+	changed.EpochTime = 1800
+	req := &ReconcileReq{
+		Databases: []*OpenReq{changed, def("c", 2), def("../x", 2)},
+		Prune:     true,
+		DryRun:    true,
+	}
+
+	res, err := s.reconcile(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := make(map[string]*DBChange)
+	for _, ch := range res.Changes {
+		actions[ch.Database] = ch
+	}
+
+	if len(res.Changes) != 4 ||
+		actions["a"].Action != ActionUpdate ||
+		actions["c"].Action != ActionCreate ||
+		actions["b"].Action != ActionDrop ||
+		actions["b"].Error != ErrPrunePartial.Error() ||
+		actions["../x"].Error == "" {
+		t.Fatal("changes should be planned", res.Changes)
+	}
+
+	if actions["a"].Error == "" || len(actions["a"].Details) != 1 {
+		t.Fatal("resolution changes should be reported as errors", actions["a"])
+	}
+
+	if _, ok := s.database("c"); ok {
+		t.Fatal("dry run should not create databases")
+	}
+
+	if _, ok := s.database("b"); !ok {
+		t.Fatal("dry run should not drop databases")
+	}
+
+	// errors of one database do not stop other changes
+	req.DryRun = false
+	if _, err := s.reconcile(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.database("c"); !ok {
+		t.Fatal("missing databases should be created")
+	}
+
+	if _, ok := s.database("b"); !ok {
+		t.Fatal("databases should not be dropped when definitions fail")
+	}
+
+	req.Databases = []*OpenReq{changed, def("c", 2)}
+	if _, err := s.reconcile(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.database("b"); ok {
+		t.Fatal("databases which are not defined should be dropped")
+	}
+
+	db, _ := s.database("a")
+	metadata, err := db.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata.MaxRWEpochs != 3 {
+		t.Fatal("epoch limits should be updated", metadata.MaxRWEpochs)
+	}
+
+	res, err = s.reconcile(&ReconcileReq{Databases: []*OpenReq{def("a", 3), def("c", 2)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Changes) != 0 {
+		t.Fatal("matching databases should not change", res.Changes)
+	}
+
+	// retention cannot be changed by edit either
+	retention := def("c", 2)
+	retention.Retention *= 2
+	res, err = s.reconcile(&ReconcileReq{Databases: []*OpenReq{retention}, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Changes) != 1 || res.Changes[0].Error == "" {
+		t.Fatal("retention changes should be reported as errors", res.Changes)
+	}
+
+	if _, err := s.reconcile(&ReconcileReq{Prune: true}); !goerr.Is(err, ErrPruneAll) {
+		t.Fatal("prune without definitions should fail", err)
+	}
+}
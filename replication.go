@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+const (
+	// ReplDir is the directory in the data path with replication log
+	// segments. It's hidden so it's not loaded as a database.
+	ReplDir = ".replication"
+
+	// ReplOffsetFile stores the offset of the last operation applied by
+	// a follower in the data path.
+	ReplOffsetFile = "replication.offset"
+
+	// ReplSegmentSize is the size of a log segment before a new one is
+	// started. Offsets are byte positions in the log so a segment file
+	// is named with the offset of its first record.
+	ReplSegmentSize = 64 * 1024 * 1024
+
+	// ReplSegments is the number of segments kept for followers to catch
+	// up after a disconnect. Older segments are removed.
+	ReplSegments = 8
+
+	// DefaultReplMaxOps is the default number of operations in a response
+	DefaultReplMaxOps = 1000
+
+	// DefaultReplTimeout is the default time to wait for new operations
+	DefaultReplTimeout = 5 * time.Second
+
+	// MaxReplTimeout is the maximum time to wait for new operations
+	MaxReplTimeout = 30 * time.Second
+
+	// ReplRetry is the time to wait before reconnecting to the primary
+	ReplRetry = time.Second
+)
+
+var (
+	// ErrFollower is returned when a client writes to a follower
+	ErrFollower = errors.New("writes are not accepted by followers")
+
+	// ErrReplication is returned when replication is not enabled
+	ErrReplication = errors.New("replication is not enabled")
+
+	// ErrReplOffset is returned when a follower requests an offset which
+	// is no longer (or not yet) in the replication log. The follower has
+	// to be seeded again with a backup of the primary.
+	ErrReplOffset = errors.New("replication offset is not available")
+)
+
+// replLog is a log of database operations split into segment files
+type replLog struct {
+	dir      string
+	mutex    sync.Mutex
+	segments []uint64
+	file     *os.File
+	size     int64
+
+	// notify is closed and replaced when operations are appended
+	notify chan struct{}
+}
+
+func openReplLog(dir string) (l *replLog, err error) {
+	if err := os.MkdirAll(dir, DataPerm); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	l = &replLog{dir: dir, notify: make(chan struct{})}
+	for _, finfo := range files {
+		base, err := strconv.ParseUint(strings.TrimSuffix(finfo.Name(), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		l.segments = append(l.segments, base)
+	}
+
+	sort.Sort(offsets(l.segments))
+	if len(l.segments) == 0 {
+		l.segments = []uint64{0}
+	}
+
+	base := l.segments[len(l.segments)-1]
+	file, err := os.OpenFile(l.segmentPath(base), os.O_RDWR|os.O_CREATE, DataPerm)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	// drop a partially written record at the end of the last segment
+	var size int64
+	r := bufio.NewReader(file)
+	for {
+		data, err := readRecord(r)
+		if err != nil {
+			break
+		}
+
+		size += int64(WALHeaderSize + len(data))
+	}
+
+	if err := file.Truncate(size); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if _, err := file.Seek(size, 0); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	l.file = file
+	l.size = size
+
+	return l, nil
+}
+
+// close closes the current segment file
+func (l *replLog) close() (err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.file.Close(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+func (l *replLog) segmentPath(base uint64) (fpath string) {
+	return path.Join(l.dir, fmt.Sprintf("%020d.log", base))
+}
+
+// end returns the offset after the last operation
+func (l *replLog) end() (offset uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.segments[len(l.segments)-1] + uint64(l.size)
+}
+
+func (l *replLog) append(op *ReplOp) (err error) {
+	data, err := proto.Marshal(op)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	buff := encodeRecord(data)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := l.file.Write(buff); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	l.size += int64(len(buff))
+	close(l.notify)
+	l.notify = make(chan struct{})
+
+	if l.size >= ReplSegmentSize {
+		return l.rotate()
+	}
+
+	return nil
+}
+
+// rotate starts a new segment and removes old segments
+func (l *replLog) rotate() (err error) {
+	base := l.segments[len(l.segments)-1] + uint64(l.size)
+	file, err := os.OpenFile(l.segmentPath(base), os.O_RDWR|os.O_CREATE, DataPerm)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if err := l.file.Close(); err != nil {
+		Logger.Error(err)
+	}
+
+	l.file = file
+	l.size = 0
+	l.segments = append(l.segments, base)
+
+	for len(l.segments) > ReplSegments {
+		if err := os.Remove(l.segmentPath(l.segments[0])); err != nil {
+			Logger.Error(err)
+		}
+
+		l.segments = l.segments[1:]
+	}
+
+	return nil
+}
+
+// wait returns when there are operations after offset or on timeout
+func (l *replLog) wait(offset uint64, timeout time.Duration) {
+	l.mutex.Lock()
+	end := l.segments[len(l.segments)-1] + uint64(l.size)
+	notify := l.notify
+	l.mutex.Unlock()
+
+	if end > offset {
+		return
+	}
+
+	select {
+	case <-notify:
+	case <-time.After(timeout):
+	}
+}
+
+// read returns up to max operations from offset and the next offset
+func (l *replLog) read(offset uint64, max int) (ops []*ReplOp, next uint64, err error) {
+	l.mutex.Lock()
+	segments := l.segments
+	end := segments[len(segments)-1] + uint64(l.size)
+	l.mutex.Unlock()
+
+	if offset == end {
+		return nil, offset, nil
+	}
+
+	if offset < segments[0] || offset > end {
+		return nil, 0, goerr.Wrap(ErrReplOffset, 0)
+	}
+
+	i := sort.Search(len(segments), func(i int) bool { return segments[i] > offset }) - 1
+	base := segments[i]
+	limit := end
+	if i+1 < len(segments) {
+		limit = segments[i+1]
+	}
+
+	file, err := os.Open(l.segmentPath(base))
+	if err != nil {
+		return nil, 0, goerr.Wrap(err, 0)
+	}
+
+	defer file.Close()
+
+	if _, err := file.Seek(int64(offset-base), 0); err != nil {
+		return nil, 0, goerr.Wrap(err, 0)
+	}
+
+	// only read complete records written before the end was loaded
+	r := bufio.NewReader(io.LimitReader(file, int64(limit-offset)))
+	next = offset
+
+	for len(ops) < max {
+		data, err := readRecord(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, 0, goerr.Wrap(ErrReplOffset, 0)
+		}
+
+		op := &ReplOp{}
+		if err := proto.Unmarshal(data, op); err != nil {
+			return nil, 0, goerr.Wrap(err, 0)
+		}
+
+		ops = append(ops, op)
+		next += uint64(WALHeaderSize + len(data))
+	}
+
+	return ops, next, nil
+}
+
+type offsets []uint64
+
+func (o offsets) Len() int           { return len(o) }
+func (o offsets) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o offsets) Less(i, j int) bool { return o[i] < o[j] }
+
+// record appends an operation to the replication log if it's enabled
+func (s *server) record(op *ReplOp) (err error) {
+	if s.repl == nil {
+		return nil
+	}
+
+	op.Time = time.Now().UnixNano()
+	return s.repl.append(op)
+}
+
+func (s *server) replicate(req *ReplicateReq) (res *ReplicateRes, err error) {
+	res = &ReplicateRes{}
+
+	if s.repl == nil {
+		return nil, goerr.Wrap(ErrReplication, 0)
+	}
+
+	timeout := time.Duration(req.Timeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = DefaultReplTimeout
+	} else if timeout > MaxReplTimeout {
+		timeout = MaxReplTimeout
+	}
+
+	max := int(req.MaxOps)
+	if max <= 0 {
+		max = DefaultReplMaxOps
+	}
+
+	s.repl.wait(req.Offset, timeout)
+
+	res.Ops, res.Offset, err = s.repl.read(req.Offset, max)
+	if err != nil {
+		return nil, err
+	}
+
+	res.End = s.repl.end()
+
+	if req.Follower != "" {
+		s.metrics.set("replication.follower."+req.Follower+".lag.bytes", float64(res.End-res.Offset))
+	}
+
+	return res, nil
+}
+
+// follower reads operations from the primary and applies them
+type follower struct {
+	server *server
+	id     string
+	fpath  string
+	offset uint64
+}
+
+func newFollower(s *server) (f *follower) {
+	id := s.options.FollowerID
+	if id == "" {
+		host, _ := os.Hostname()
+		id = host + s.options.Address
+	}
+
+	f = &follower{
+		server: s,
+		id:     id,
+		fpath:  path.Join(s.options.Path, ReplOffsetFile),
+	}
+
+	if data, err := ioutil.ReadFile(f.fpath); err == nil {
+		f.offset, _ = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+
+	return f
+}
+
+// run follows the primary and reconnects after failures
+func (f *follower) run() {
+	for !f.server.closing() {
+		if err := f.follow(); err != nil {
+			Logger.Error(err)
+		}
+
+		time.Sleep(ReplRetry)
+	}
+}
+
+func (f *follower) follow() (err error) {
+	config, err := peerTLSConfig(f.server.options)
+	if err != nil {
+		return err
+	}
+
+	conn, err := dial(f.server.options.Follow, f.server.options.FollowToken, config)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	Logger.Info("replication: following", f.server.options.Follow, "from", f.offset)
+
+	for !f.server.closing() {
+		req := &ReplicateReq{Follower: f.id, Offset: f.offset}
+		res := &ReplicateRes{}
+		if err := conn.call("replicate", req, res); err != nil {
+			return err
+		}
+
+		if err := f.apply(res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply applies operations and saves the new offset. Operations are
+// idempotent so they can be applied again if the offset is not saved.
+// The offset is not changed when an operation fails so it's retried with
+// the operations before it after reconnecting.
+func (f *follower) apply(res *ReplicateRes) (err error) {
+	s := f.server
+	for _, op := range res.Ops {
+		var err error
+		switch {
+		case op.Open != nil:
+			_, err = s.applyOpen(op.Open)
+		case op.Edit != nil:
+			_, err = s.applyEdit(op.Edit)
+		case op.Put != nil:
+			_, err = s.applyPut(op.Put)
+		case op.Drop != nil:
+			_, err = s.applyDrop(op.Drop)
+		}
+
+		if err != nil {
+			s.metrics.add("replication.errors", 1)
+			return err
+		}
+	}
+
+	if res.Offset != f.offset {
+		f.offset = res.Offset
+		data := []byte(strconv.FormatUint(f.offset, 10))
+		if err := ioutil.WriteFile(f.fpath, data, 0644); err != nil {
+			return goerr.Wrap(err, 0)
+		}
+	}
+
+	var lag float64
+	if n := len(res.Ops); n > 0 && res.Offset < res.End {
+		lag = time.Since(time.Unix(0, res.Ops[n-1].Time)).Seconds()
+	}
+
+	s.metrics.set("replication.offset", float64(f.offset))
+	s.metrics.set("replication.lag.bytes", float64(res.End-res.Offset))
+	s.metrics.set("replication.lag.seconds", lag)
+
+	return nil
+}
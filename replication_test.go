@@ -0,0 +1,267 @@
+package main
+
+import (
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+func TestReplication(t *testing.T) {
+	for _, dir := range []string{"/tmp/d-primary", "/tmp/d-follower"} {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	psrv, err := NewServer(&Options{Path: "/tmp/d-primary", Replication: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsrv, err := NewServer(&Options{Path: "/tmp/d-follower", Follow: "localhost:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := psrv.(*server)
+	f := fsrv.(*server)
+
+	for _, name := range []string{"repl", "dropped"} {
+		_, err = p.open(&OpenReq{
+			Database:    name,
+			Resolution:  60,
+			Retention:   36000,
+			EpochTime:   3600,
+			MaxROEpochs: 2,
+			MaxRWEpochs: 2,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := uint32(time.Now().Unix())
+	fields := []string{"a"}
+	if _, err := p.put(&PutReq{Database: "repl", Fields: fields, Timestamp: now, Value: 5, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.inc(&IncReq{Database: "repl", Fields: fields, Timestamp: now, Value: 2, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.drop(&DropReq{Database: "dropped"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fl := newFollower(f)
+	sync := func() {
+		for {
+			res, err := p.replicate(&ReplicateReq{Follower: "test", Offset: fl.offset, MaxOps: 2, Timeout: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := fl.apply(res); err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Offset == res.End {
+				return
+			}
+		}
+	}
+
+	sync()
+
+	if _, ok := f.database("dropped"); ok {
+		t.Fatal("dropped database should be removed")
+	}
+
+	res, err := f.get(&GetReq{
+		Database:  "repl",
+		Fields:    fields,
+		GroupBy:   []bool{true},
+		StartTime: now,
+		EndTime:   now + 60,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Groups) != 1 || res.Groups[0].Points[0].Value != 7 {
+		t.Fatal("follower should have replicated points")
+	}
+
+	_, err = f.put(&PutReq{Database: "repl", Fields: fields, Timestamp: now, Value: 1, Count: 1})
+	if !goerr.Is(err, ErrFollower) {
+		t.Fatal("follower should reject writes", err)
+	}
+
+	if f.metrics.get("replication.lag.bytes") != 0 {
+		t.Fatal("follower should not lag")
+	}
+
+	// a new follower continues from the saved offset
+	if _, err := p.put(&PutReq{Database: "repl", Fields: fields, Timestamp: now, Value: 9, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	offset := fl.offset
+	fl = newFollower(f)
+	if fl.offset != offset {
+		t.Fatal("offset should be loaded from the data path")
+	}
+
+	sync()
+
+	if p.metrics.get("replication.follower.test.lag.bytes") != 0 {
+		t.Fatal("incorrect follower lag on primary")
+	}
+
+	res, err = f.get(&GetReq{
+		Database:  "repl",
+		Fields:    fields,
+		GroupBy:   []bool{true},
+		StartTime: now,
+		EndTime:   now + 60,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Groups[0].Points[0].Value != 9 {
+		t.Fatal("follower should catch up")
+	}
+
+	// operations which fail are retried from the same offset
+	offset = fl.offset
+	bad := &ReplOp{Put: &PutReq{Database: "missing", Fields: fields, Timestamp: now, Value: 1, Count: 1}}
+	if err := fl.apply(&ReplicateRes{Ops: []*ReplOp{bad}, Offset: offset + 100, End: offset + 100}); err == nil {
+		t.Fatal("failed operations should stop the follower")
+	}
+
+	if fl.offset != offset {
+		t.Fatal("offset should not pass failed operations", fl.offset)
+	}
+
+	if _, err := p.replicate(&ReplicateReq{Offset: offset + 1e6, Timeout: 1}); err == nil {
+		t.Fatal("should reject unknown offsets")
+	}
+
+	// the log is reopened with the same end offset
+	end := p.repl.end()
+	l, err := openReplLog(p.repl.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l.end() != end {
+		t.Fatal("incorrect end offset after reopening the log")
+	}
+}
+
+func TestReplicationWriteOrder(t *testing.T) {
+	dir := "/tmp/d-repl-order"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{Path: dir, Replication: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	_, err = s.open(&OpenReq{
+		Database:    "order",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := s.repl.end()
+	now := uint32(time.Now().Unix())
+	now -= now % 60
+	fields := []string{"a"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := &PutReq{Database: "order", Fields: fields, Timestamp: now, Value: float64(i), Count: 1}
+			if _, err := s.put(req); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	ops, _, err := s.repl.read(start, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := s.database("order")
+	data, err := db.One(int64(now)*1e9, int64(now+60)*1e9, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if val, _ := pldToVal(data[0]); len(ops) != 50 || ops[49].Put.Value != val {
+		t.Fatal("the last logged write should be the stored value", len(ops), val)
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// writes replayed from the write-ahead log may be missing from the
+	// replication log after a crash so they are logged again
+	w, err := openWAL(path.Join(dir, WALFile), WALSyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.append(&PutReq{Database: "order", Fields: fields, Timestamp: now, Value: 1, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	end := s.repl.end()
+	srv, err = NewServer(&Options{Path: dir, Replication: true, WALPolicy: WALSyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops, _, err = srv.(*server).repl.read(end, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ops) != 1 || ops[0].Put == nil || ops[0].Put.Value != 1 {
+		t.Fatal("replayed writes should be added to the replication log", ops)
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// RestorePrefix is added to directories used while restoring databases.
+	// Directories starting with a "." are not loaded as databases.
+	RestorePrefix = ".restore-"
+
+	// ReplacedPrefix is added to directories of databases which are
+	// replaced by a restore until the restored database is loaded
+	ReplacedPrefix = ".replaced-"
+)
+
+var (
+	// ErrDatabaseExists is returned when restoring over an existing
+	// database without the force option
+	ErrDatabaseExists = errors.New("database already exists")
+
+	// ErrReplRestore is returned when restoring on a primary which keeps
+	// a replication log
+	ErrReplRestore = errors.New("restore is not supported on a server with replication enabled")
+
+	// ErrDatabaseName is returned when a database name is not valid
+	ErrDatabaseName = errors.New("database name is not valid")
+
+	// ErrManifest is returned when a backup manifest is missing or invalid
+	ErrManifest = errors.New("backup manifest is not valid")
+
+	// ErrChecksum is returned when a backup file does not match the manifest
+	ErrChecksum = errors.New("backup file does not match the manifest")
+)
+
+func (s *server) restore(req *RestoreReq) (res *RestoreRes, err error) {
+	defer Logger.Time(time.Now(), time.Minute, "server.restore")
+	res = &RestoreRes{}
+
+	dir, err := s.backupPath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := s.restoreFrom(dir, req.Database, req.Name, req.Force)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Databases = names
+	return res, nil
+}
+
+// serveRestore restores databases from a tar archive created by a backup.
+// The archive is unpacked to a temporary directory before restoring.
+func (s *server) serveRestore(w http.ResponseWriter, r *http.Request) {
+	defer Logger.Time(time.Now(), time.Minute, "server.serveRestore")
+
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	databases := []string{query.Get("database")}
+	if databases[0] == "" {
+		databases[0] = AllDatabases
+	}
+
+	if name := query.Get("name"); name != "" {
+		databases = append(databases, name)
+	}
+
+	if !s.authorizeHTTP(w, r, databases, OpAdmin) {
+		return
+	}
+
+	tmp, err := ioutil.TempDir("", "kadiradb-restore-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer os.RemoveAll(tmp)
+
+	if err := readTar(r.Body, tmp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	force, _ := strconv.ParseBool(query.Get("force"))
+	names, err := s.restoreFrom(tmp, query.Get("database"), query.Get("name"), force)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if goerr.Is(err, ErrDatabaseExists) {
+			status = http.StatusConflict
+		}
+
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+// restoreFrom verifies a backup directory and restores one or all of its
+// databases. A single database can be restored with a new name.
+func (s *server) restoreFrom(dir, database, name string, force bool) (names []string, err error) {
+	if s.options.Follow != "" {
+		return nil, goerr.Wrap(ErrFollower, 0)
+	}
+
+	// restored files are not in the replication log so followers would
+	// keep the old data
+	if s.repl != nil {
+		return nil, goerr.Wrap(ErrReplRestore, 0)
+	}
+
+	m, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var bdbs []*BackupDatabase
+	for _, bdb := range m.Databases {
+		if database == "" || bdb.Name == database {
+			bdbs = append(bdbs, bdb)
+		}
+	}
+
+	if len(bdbs) == 0 {
+		return nil, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	if name != "" && len(bdbs) != 1 {
+		return nil, goerr.Wrap(ErrDatabaseName, 0)
+	}
+
+	for _, bdb := range bdbs {
+		if err := verifyBackup(dir, bdb); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, bdb := range bdbs {
+		target := bdb.Name
+		if name != "" {
+			target = name
+		}
+
+		if err := s.restoreDatabase(dir, bdb, target, force); err != nil {
+			return names, err
+		}
+
+		names = append(names, target)
+	}
+
+	return names, nil
+}
+
+// restoreDatabase copies database files from a backup and replaces the
+// database in the running server. Writes wait until it's replaced. The
+// replaced database is moved back if the restored one fails to load.
+func (s *server) restoreDatabase(dir string, bdb *BackupDatabase, name string, force bool) (err error) {
+	if !validName(name) {
+		return goerr.Wrap(ErrDatabaseName, 0)
+	}
+
+	staging := path.Join(s.options.Path, RestorePrefix+name)
+	if err := os.RemoveAll(staging); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	defer os.RemoveAll(staging)
+
+	for _, epoch := range bdb.Epochs {
+		if err := os.MkdirAll(path.Join(staging, epoch), DataPerm); err != nil {
+			return goerr.Wrap(err, 0)
+		}
+	}
+
+	for _, f := range bdb.Files {
+		dst := path.Join(staging, strings.TrimPrefix(f.Path, bdb.Name+"/"))
+		if err := os.MkdirAll(path.Dir(dst), DataPerm); err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		if _, err := copyFile(path.Join(dir, f.Path), dst); err != nil {
+			return goerr.Wrap(err, 0)
+		}
+	}
+
+	// the write lock must be taken before the databases lock
+	// because writers take them in the same order.
+	lock := s.writeLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.dbsMutex.Lock()
+	defer s.dbsMutex.Unlock()
+
+	target := path.Join(s.options.Path, name)
+	old, exists := s.databases[name]
+	if _, err := os.Stat(target); err == nil {
+		exists = true
+	}
+
+	if exists && !force {
+		return goerr.Wrap(ErrDatabaseExists, 0)
+	}
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			Logger.Error(err)
+		}
+
+		delete(s.databases, name)
+	}
+
+	if x, ok := s.indexes[name]; ok {
+		if err := x.close(); err != nil {
+			Logger.Error(err)
+		}
+
+		delete(s.indexes, name)
+	}
+
+	if s.incs != nil {
+		s.incs.discard(name)
+	}
+
+	if s.cache != nil {
+		s.cache.invalidateDatabase(name)
+	}
+
+	replaced := path.Join(s.options.Path, ReplacedPrefix+name)
+	if err := os.RemoveAll(replaced); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	_, statErr := os.Stat(target)
+	onDisk := statErr == nil
+	if onDisk {
+		if err := os.Rename(target, replaced); err != nil {
+			s.reloadReplaced(name, old != nil)
+			return goerr.Wrap(err, 0)
+		}
+	}
+
+	rollback := func() {
+		if err := os.RemoveAll(target); err != nil {
+			Logger.Error(err)
+			return
+		}
+
+		if onDisk {
+			if err := os.Rename(replaced, target); err != nil {
+				Logger.Error(err)
+				return
+			}
+
+			s.reloadReplaced(name, old != nil)
+		}
+	}
+
+	if err := os.Rename(staging, target); err != nil {
+		rollback()
+		return goerr.Wrap(err, 0)
+	}
+
+	db, x, err := loadDatabase(target, s.options.Recovery)
+	if err != nil {
+		rollback()
+		return err
+	}
+
+	s.databases[name] = db
+	s.indexes[name] = x
+	delete(s.failed, name)
+
+	if onDisk {
+		if err := os.RemoveAll(replaced); err != nil {
+			Logger.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// reloadReplaced loads a database again after a restore failed. Databases
+// which were not loaded before the restore are left as they were. The
+// databases lock must be held.
+func (s *server) reloadReplaced(name string, loaded bool) {
+	if !loaded {
+		return
+	}
+
+	db, x, err := loadDatabase(path.Join(s.options.Path, name), s.options.Recovery)
+	if err != nil {
+		s.failDatabase(name, err)
+		return
+	}
+
+	s.databases[name] = db
+	s.indexes[name] = x
+}
+
+func readManifest(dir string) (m *BackupManifest, err error) {
+	data, err := ioutil.ReadFile(path.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, goerr.Wrap(ErrManifest, 0)
+	}
+
+	m = &BackupManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, goerr.Wrap(ErrManifest, 0)
+	}
+
+	return m, nil
+}
+
+// verifyBackup checks sizes and checksums of all files of a database
+func verifyBackup(dir string, bdb *BackupDatabase) (err error) {
+	if !validName(bdb.Name) {
+		return goerr.Wrap(ErrManifest, 0)
+	}
+
+	for _, epoch := range bdb.Epochs {
+		if !validName(epoch) {
+			return goerr.Wrap(ErrManifest, 0)
+		}
+	}
+
+	for _, f := range bdb.Files {
+		if !strings.HasPrefix(f.Path, bdb.Name+"/") || path.Clean(f.Path) != f.Path {
+			return goerr.Wrap(ErrManifest, 0)
+		}
+
+		file, err := os.Open(path.Join(dir, f.Path))
+		if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		hash := sha256.New()
+		size, err := io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		if size != f.Size || hex.EncodeToString(hash.Sum(nil)) != f.SHA256 {
+			return goerr.Errorf("%s: %s", ErrChecksum, f.Path)
+		}
+	}
+
+	return nil
+}
+
+// validName checks whether a name can be used as a directory name
+// inside the data path without escaping it or being hidden.
+func validName(name string) (ok bool) {
+	return name != "" && name != InitFile &&
+		!strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, `/\`)
+}
+
+// readTar unpacks a tar archive into dir
+func readTar(r io.Reader, dir string) (err error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return goerr.Wrap(ErrManifest, 0)
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, DataPerm); err != nil {
+				return goerr.Wrap(err, 0)
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(dst), DataPerm); err != nil {
+				return goerr.Wrap(err, 0)
+			}
+
+			file, err := os.Create(dst)
+			if err != nil {
+				return goerr.Wrap(err, 0)
+			}
+
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return goerr.Wrap(err, 0)
+			}
+		}
+	}
+}
+
+// restoreCommand restores databases on a running server. With -path the
+// server reads a backup directory on its own filesystem. With -http a
+// tar archive from -in is uploaded to the server.
+func restoreCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	addr := fs.String("addr", DefaultAddr, "server address")
+	token := fs.String("token", "", "authentication token")
+	secure := newTLSFlags(fs)
+	httpAddr := fs.String("http", "", "server http address to upload a tar archive")
+	database := fs.String("database", "", "database name in the backup (default: all databases)")
+	name := fs.String("name", "", "restore a single database with a new name")
+	force := fs.Bool("force", false, "replace existing databases")
+	dir := fs.String("path", "", "backup directory on the server")
+	in := fs.String("in", "-", "tar archive file when using -http")
+	fs.Parse(args)
+
+	if *dir != "" {
+		req := &RestoreReq{Path: *dir, Database: *database, Name: *name, Force: *force}
+		res := &RestoreRes{}
+		conn, err := secure.dial(*addr, *token)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+		call := conn.call
+
+		if err := call("restore", req, res); err != nil {
+			return err
+		}
+
+		fmt.Println("restored:", strings.Join(res.Databases, ", "))
+		return nil
+	}
+
+	if *httpAddr == "" {
+		return goerr.Wrap(ErrUsage, 0)
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		defer file.Close()
+		r = file
+	}
+
+	query := url.Values{
+		"database": {*database},
+		"name":     {*name},
+		"force":    {strconv.FormatBool(*force)},
+	}
+
+	req, err := newHTTPRequest("POST", "http://"+*httpAddr+"/restore?"+query.Encode(), *token, r)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	req.Header.Set("Content-Type", "application/x-tar")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	defer resp.Body.Close()
+
+	msg, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return goerr.New(strings.TrimSpace(string(msg)))
+	}
+
+	fmt.Println("restored:", strings.TrimSpace(string(msg)))
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+func TestRestore(t *testing.T) {
+	dir := "/tmp/d-restore"
+	out := "/tmp/d-restore-out"
+	for _, p := range []string{dir, out} {
+		if err := os.RemoveAll(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv, err := NewServer(&Options{Path: dir, BackupRoot: "/tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	_, err = s.open(&OpenReq{
+		Database:    "restore",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := uint32(time.Now().Unix())
+	fields := []string{"a"}
+	if _, err := s.put(&PutReq{Database: "restore", Fields: fields, Timestamp: now, Value: 5, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.backup(&BackupReq{Path: out}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.restore(&RestoreReq{Path: out})
+	if !goerr.Is(err, ErrDatabaseExists) {
+		t.Fatal("should not overwrite without force", err)
+	}
+
+	if _, err := s.restore(&RestoreReq{Path: out, Name: "../x"}); err == nil {
+		t.Fatal("should reject invalid names")
+	}
+
+	// followers would not get restored databases
+	p := newTestServer(t, &Options{Path: "/tmp/d-restore-primary", BackupRoot: "/tmp", Replication: true})
+	if _, err := p.restore(&RestoreReq{Path: out, Name: "copy"}); !goerr.Is(err, ErrReplRestore) {
+		t.Fatal("should not restore with replication", err)
+	}
+
+	closeTestServer(t, p)
+
+	res, err := s.restore(&RestoreReq{Path: out, Name: "copy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Databases) != 1 || res.Databases[0] != "copy" {
+		t.Fatal("incorrect databases", res.Databases)
+	}
+
+	get := func(database string) float64 {
+		res, err := s.get(&GetReq{
+			Database:  database,
+			Fields:    fields,
+			GroupBy:   []bool{true},
+			StartTime: now,
+			EndTime:   now + 60,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Groups) != 1 {
+			t.Fatal("incorrect number of results")
+		}
+
+		return res.Groups[0].Points[0].Value
+	}
+
+	if get("copy") != 5 {
+		t.Fatal("restored database should have the point")
+	}
+
+	// replace a database with older data from the backup
+	if _, err := s.put(&PutReq{Database: "restore", Fields: fields, Timestamp: now, Value: 9, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.restore(&RestoreReq{Path: out, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if get("restore") != 5 {
+		t.Fatal("database should be replaced")
+	}
+
+	// restore from a tar archive
+	w := httptest.NewRecorder()
+	s.serveBackup(w, httptest.NewRequest("GET", "/backup?database=restore", nil))
+	archive := w.Body.Bytes()
+
+	w = httptest.NewRecorder()
+	s.serveRestore(w, httptest.NewRequest("POST", "/restore?name=fromtar", bytes.NewReader(archive)))
+	if w.Code != 200 {
+		t.Fatal("incorrect status", w.Code, w.Body.String())
+	}
+
+	if get("fromtar") != 5 {
+		t.Fatal("restored database should have the point")
+	}
+
+	// databases are kept when the restored copy can not be loaded
+	m, err := readManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bdb := m.Databases[0]
+	var files []*BackupFile
+	for _, f := range bdb.Files {
+		if path.Base(f.Path) != "metadata" {
+			files = append(files, f)
+		}
+	}
+
+	bdb.Files = files
+	if err := s.restoreDatabase(out, bdb, "restore", true); err == nil {
+		t.Fatal("should fail to load a restore without metadata")
+	}
+
+	if get("restore") != 5 {
+		t.Fatal("database should be kept when a restore fails")
+	}
+
+	// corrupt a file in the backup
+	m, err = readManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fpath := path.Join(out, m.Databases[0].Files[0].Path)
+	if err := ioutil.WriteFile(fpath, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.restore(&RestoreReq{Path: out, Name: "corrupt"}); err == nil {
+		t.Fatal("should reject corrupt backups")
+	}
+
+	if _, ok := s.database("corrupt"); ok {
+		t.Fatal("corrupt backup should not be restored")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// FormatCSV writes one row per point with a column for each field
+	// followed by timestamp, value and count columns.
+	FormatCSV = "csv"
+
+	// FormatJSONL writes one json object per line
+	FormatJSONL = "jsonl"
+)
+
+var (
+	// ErrFormat is returned when the export/import format is unknown
+	ErrFormat = errors.New("format must be csv or jsonl")
+
+	// ErrRow is returned when a row cannot be parsed
+	ErrRow = errors.New("invalid row")
+)
+
+// Row is a single point of a series used when exporting and importing
+type Row struct {
+	Fields    []string `json:"fields"`
+	Timestamp uint32   `json:"timestamp"`
+	Value     float64  `json:"value"`
+	Count     uint32   `json:"count"`
+}
+
+type rowWriter interface {
+	write(row *Row) (err error)
+	flush() (err error)
+}
+
+type rowReader interface {
+	// read returns io.EOF when there are no more rows
+	read() (row *Row, err error)
+}
+
+func newRowWriter(format string, w io.Writer) (rw rowWriter, err error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+
+	return nil, goerr.Wrap(ErrFormat, 0)
+}
+
+func newRowReader(format string, r io.Reader) (rr rowReader, err error) {
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		return &csvReader{r: cr}, nil
+	case FormatJSONL:
+		return &jsonlReader{dec: json.NewDecoder(r)}, nil
+	}
+
+	return nil, goerr.Wrap(ErrFormat, 0)
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (cw *csvWriter) write(row *Row) (err error) {
+	if !cw.header {
+		cw.header = true
+
+		header := make([]string, 0, len(row.Fields)+3)
+		for i := range row.Fields {
+			header = append(header, "field"+strconv.Itoa(i))
+		}
+
+		header = append(header, "timestamp", "value", "count")
+		if err := cw.w.Write(header); err != nil {
+			return goerr.Wrap(err, 0)
+		}
+	}
+
+	record := make([]string, 0, len(row.Fields)+3)
+	record = append(record, row.Fields...)
+	record = append(record,
+		strconv.FormatUint(uint64(row.Timestamp), 10),
+		strconv.FormatFloat(row.Value, 'g', -1, 64),
+		strconv.FormatUint(uint64(row.Count), 10),
+	)
+
+	if err := cw.w.Write(record); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+func (cw *csvWriter) flush() (err error) {
+	cw.w.Flush()
+	if err := cw.w.Error(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+type csvReader struct {
+	r      *csv.Reader
+	header bool
+}
+
+func (cr *csvReader) read() (row *Row, err error) {
+	if !cr.header {
+		cr.header = true
+		if _, err := cr.r.Read(); err != nil {
+			return nil, err
+		}
+	}
+
+	record, err := cr.r.Read()
+	if err == io.EOF {
+		return nil, err
+	} else if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	n := len(record) - 3
+	if n < 1 {
+		return nil, goerr.Wrap(ErrRow, 0)
+	}
+
+	ts, err := strconv.ParseUint(record[n], 10, 32)
+	if err != nil {
+		return nil, goerr.Wrap(ErrRow, 0)
+	}
+
+	val, err := strconv.ParseFloat(record[n+1], 64)
+	if err != nil {
+		return nil, goerr.Wrap(ErrRow, 0)
+	}
+
+	num, err := strconv.ParseUint(record[n+2], 10, 32)
+	if err != nil {
+		return nil, goerr.Wrap(ErrRow, 0)
+	}
+
+	row = &Row{
+		Fields:    record[:n],
+		Timestamp: uint32(ts),
+		Value:     val,
+		Count:     uint32(num),
+	}
+
+	return row, nil
+}
+
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (jw *jsonlWriter) write(row *Row) (err error) {
+	if err := jw.enc.Encode(row); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+func (jw *jsonlWriter) flush() (err error) {
+	if err := jw.w.Flush(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+type jsonlReader struct {
+	dec *json.Decoder
+}
+
+func (jr *jsonlReader) read() (row *Row, err error) {
+	row = &Row{}
+	if err := jr.dec.Decode(row); err == io.EOF {
+		return nil, err
+	} else if err != nil {
+		return nil, goerr.Wrap(ErrRow, 0)
+	}
+
+	if len(row.Fields) == 0 {
+		return nil, goerr.Wrap(ErrRow, 0)
+	}
+
+	return row, nil
+}
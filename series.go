@@ -4,7 +4,8 @@ func newResPoint(val float64, num uint32) (p *ResPoint) {
 	return &ResPoint{Value: val, Count: num}
 }
 
-func (p *ResPoint) add(q *ResPoint) {
+// addPoint adds values and counts of q to p
+func addPoint(p, q *ResPoint) {
 	p.Value += q.Value
 	p.Count += q.Count
 }
@@ -13,14 +14,16 @@ func newResSeries(fields []string) (sr *ResSeries) {
 	return &ResSeries{Fields: fields, Points: []*ResPoint{}}
 }
 
-func (sr *ResSeries) add(sn *ResSeries) {
+// addPoints adds points of sn to points of sr
+func addPoints(sr, sn *ResSeries) {
 	count := len(sr.Points)
 	for i := 0; i < count; i++ {
-		sr.Points[i].add(sn.Points[i])
+		addPoint(sr.Points[i], sn.Points[i])
 	}
 }
 
-func (sr *ResSeries) canMerge(sn *ResSeries) (can bool) {
+// canMerge checks whether two series have the same fields
+func canMerge(sr, sn *ResSeries) (can bool) {
 	count := len(sr.Fields)
 	for i := 0; i < count; i++ {
 		if sr.Fields[i] != sn.Fields[i] {
@@ -42,8 +45,8 @@ func (ss *seriesSet) add(sn *ResSeries) {
 	count := len(ss.items)
 	for i := 0; i < count; i++ {
 		sr := ss.items[i]
-		if sr.canMerge(sn) {
-			sr.add(sn)
+		if canMerge(sr, sn) {
+			addPoints(sr, sn)
 			return
 		}
 	}
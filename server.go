@@ -2,11 +2,16 @@ package main
 
 import (
 	"errors"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -35,6 +40,9 @@ var (
 
 	// ErrResolution requested resolution is not valid
 	ErrResolution = errors.New("resolution is not valid")
+
+	// ErrWriteTime is returned when a timestamp is not in a writable epoch
+	ErrWriteTime = errors.New("timestamp is not in a read-write epoch")
 )
 
 // Server handles requests
@@ -48,11 +56,72 @@ type Server interface {
 	Get(reqData []byte) (resData []byte, err error)
 	Batch(reqData []byte) (resData []byte, err error)
 	Metrics(reqData []byte) (resData []byte, err error)
+	Subscribe(reqData []byte) (resData []byte, err error)
+	Poll(reqData []byte) (resData []byte, err error)
+	Unsubscribe(reqData []byte) (resData []byte, err error)
+	SetAlert(reqData []byte) (resData []byte, err error)
+	DelAlert(reqData []byte) (resData []byte, err error)
+	ListAlerts(reqData []byte) (resData []byte, err error)
+	Backup(reqData []byte) (resData []byte, err error)
+	Restore(reqData []byte) (resData []byte, err error)
+	Drop(reqData []byte) (resData []byte, err error)
+	Replicate(reqData []byte) (resData []byte, err error)
+	Close() (err error)
+	Reload(options *Options) (err error)
+	Reconcile(reqData []byte) (resData []byte, err error)
+	Retry(reqData []byte) (resData []byte, err error)
 }
 
 type server struct {
 	options   *Options
 	databases map[string]kadiyadb.Database
+	dbsMutex  sync.RWMutex
+	metrics   *metrics
+	hub       *hub
+	alerts    *alerts
+	acls      *acls
+	limits    *limiter
+	wal       *wal
+	walMutex  sync.RWMutex
+	repl      *replLog
+
+	// indexes has the series index of each database (see seriesIndex)
+	indexes map[string]*seriesIndex
+
+	// incs buffers increments when IncFlush is set (see incBuffer)
+	incs *incBuffer
+
+	// cache has query results when QueryCacheSize is set (see queryCache)
+	cache *queryCache
+
+	// queryLimits has limits of get requests (see QueryLimit)
+	queryLimits *queryLimits
+
+	// failed has databases which failed to load (see failDatabase)
+	failed map[string]*failure
+
+	// closed is set by Close and requests has running rpc requests. The
+	// rpc listener (srpc or TLS) is kept to stop accepting requests.
+	closed     bool
+	closeMutex sync.RWMutex
+	requests   sync.WaitGroup
+	listener   io.Closer
+	httpServer *http.Server
+	statsd     *statsd
+
+	// readers is held (shared) while databases are read without a write
+	// lock so they are not closed while they are used
+	readers sync.RWMutex
+
+	// locks has a lock for each database which is held (shared) while
+	// writing and held (exclusive) while taking a consistent snapshot.
+	locks      map[string]*sync.RWMutex
+	locksMutex sync.Mutex
+
+	// seriesLocks order writes to the same series so that they are in
+	// the write-ahead log and the replication log in the order they were
+	// applied (see seriesLock)
+	seriesLocks [256]sync.Mutex
 }
 
 // Options has server options
@@ -60,6 +129,99 @@ type Options struct {
 	Path     string
 	Address  string
 	Recovery bool
+
+	// Quarantine moves databases which fail to load to QuarantineDir
+	Quarantine bool
+
+	// BackupRoot is the directory where clients can write backups with
+	// the backup handler. Backups to paths are disabled when it's empty.
+	BackupRoot string
+
+	// StatsdAddress is the udp address to receive statsd metrics.
+	// Statsd metrics are not accepted if it's empty.
+	StatsdAddress  string
+	StatsdFlush    time.Duration
+	StatsdMappings []*StatsdMapping
+
+	// HTTPAddress is the address to serve http ingestion endpoints.
+	// Line protocol writes are mapped to databases with InfluxMappings
+	// and prometheus remote_write requests are mapped with PromMappings.
+	HTTPAddress    string
+	InfluxMappings []*InfluxMapping
+	PromMappings   []*PromMapping
+
+	// AlertRules are evaluated every AlertInterval and notifications are
+	// sent to AlertWebhook unless the rule has its own webhook url.
+	AlertRules    []*AlertRule
+	AlertInterval time.Duration
+	AlertWebhook  string
+
+	// WALPolicy enables the write-ahead log when it's not empty. It can be
+	// WALSyncAlways, WALSyncBatch or WALSyncInterval. The log is synced
+	// every WALInterval with batch and interval policies. Databases are
+	// synced and the log is truncated every WALCheckpoint.
+	WALPolicy     string
+	WALPath       string
+	WALInterval   time.Duration
+	WALCheckpoint time.Duration
+
+	// Replication keeps a log of database operations which followers
+	// read with replicate requests. A server started with Follow set to
+	// the address of a primary applies operations from the primary and
+	// does not accept writes from clients.
+	Replication bool
+	Follow      string
+	FollowerID  string
+
+	// Cluster has node addresses when running as a router (see Router)
+	Cluster []string
+
+	// ACLs enable token authentication when not empty. Followers send
+	// FollowToken with replication requests.
+	ACLs        []*ACL
+	FollowToken string
+
+	// TLSCert and TLSKey enable TLS for the rpc listener. Clients must
+	// present a certificate signed by TLSClientCA when it's set and the
+	// certificate common name is matched with ACL principals.
+	TLSCert     string
+	TLSKey      string
+	TLSClientCA string
+
+	// PeerTLSCA enables TLS for connections to other servers (the primary
+	// of a follower and cluster nodes of a router). PeerTLSCert and
+	// PeerTLSKey are sent to servers which verify clients.
+	PeerTLSCA   string
+	PeerTLSCert string
+	PeerTLSKey  string
+
+	// RateLimits limit writes and queries of databases and clients
+	RateLimits []*RateLimit
+
+	// ShutdownTimeout is the time Close waits for running requests
+	ShutdownTimeout time.Duration
+
+	// SegmentSize is the maximum size of segment files of new databases
+	SegmentSize uint32
+
+	// IncFlush enables merging increments of the same point in memory.
+	// They are written every IncFlush or when IncBufferSize points are
+	// buffered. Increments which are not written are lost on a crash.
+	IncFlush      time.Duration
+	IncBufferSize int
+
+	// QueryCacheSize is the number of query results kept for ranges in
+	// read-only epochs. The cache is disabled when it's zero.
+	QueryCacheSize int
+
+	// QueryLimits limit the range, series, groups and time of queries
+	QueryLimits []*QueryLimit
+
+	// Databases are created or updated when the server starts and when
+	// options are reloaded. Other databases are dropped with
+	// PruneDatabases (see reconcile).
+	Databases      []*OpenReq
+	PruneDatabases bool
 }
 
 // NewServer creates a server to handle requests
@@ -69,6 +231,21 @@ func NewServer(options *Options) (s Server, err error) {
 	srv := &server{
 		options:   options,
 		databases: dbs,
+		metrics:   newMetrics(),
+		hub:       newHub(),
+		acls:      newACLs(options.ACLs),
+		locks:     make(map[string]*sync.RWMutex),
+		indexes:   make(map[string]*seriesIndex),
+		failed:    make(map[string]*failure),
+	}
+
+	srv.limits = newLimiter(options.RateLimits, srv.metrics)
+	srv.queryLimits = newQueryLimits(options.QueryLimits, srv.metrics)
+	srv.alerts = newAlerts(srv, options.AlertWebhook)
+	for _, rule := range options.AlertRules {
+		if err := srv.alerts.set(rule); err != nil {
+			Logger.Error(err, rule.Name)
+		}
 	}
 
 	err = os.MkdirAll(options.Path, DataPerm)
@@ -81,76 +258,180 @@ func NewServer(options *Options) (s Server, err error) {
 		return nil, goerr.Wrap(err, 0)
 	}
 
-	now := time.Now().UnixNano()
-	fields := []string{`¯\_(ツ)_/¯`}
-
 	for _, finfo := range files {
 		fname := finfo.Name()
-		dbPath := path.Join(options.Path, fname)
 
-		if fname == InitFile {
+		// hidden directories are used while restoring databases
+		if fname == InitFile || !finfo.IsDir() || strings.HasPrefix(fname, ".") {
 			continue
 		}
 
-		db, err := kadiyadb.Open(dbPath, options.Recovery)
+		db, x, err := loadDatabase(path.Join(options.Path, fname), options.Recovery)
 		if err != nil {
-			Logger.Error(err)
+			srv.failDatabase(fname, err)
 			continue
 		}
 
-		info, err := db.Info()
-		if err != nil {
-			Logger.Error(err)
-			continue
-		}
+		dbs[fname] = db
+		srv.indexes[fname] = x
+	}
 
-		var i uint32
-		for i = 0; i < info.MaxRWEpochs; i++ {
-			ii64 := int64(i)
-			start := now - ii64*info.Duration
-			end := start + info.Resolution
+	if err := srv.loadQuarantined(); err != nil {
+		return nil, err
+	}
 
-			// this will trigger a epoch load
-			// also acts as a db health check
-			_, err = db.One(start, end, fields)
-			if err != nil {
+	if options.Replication {
+		srv.repl, err = openReplLog(path.Join(options.Path, ReplDir))
+		if err != nil {
+			return nil, err
+		}
+	}
 
-				if err := db.Close(); err != nil {
-					Logger.Error(err)
-				}
+	if options.WALPolicy != "" {
+		if options.WALPath == "" {
+			options.WALPath = path.Join(options.Path, WALFile)
+		}
 
-				continue
-			}
+		if err := srv.replayWAL(); err != nil {
+			return nil, err
 		}
+	}
 
-		dbs[fname] = db
+	if options.IncFlush > 0 {
+		srv.incs = newIncBuffer(options.IncBufferSize)
+		go srv.flushIncsEvery(options.IncFlush)
+	}
+
+	if options.QueryCacheSize > 0 {
+		srv.cache = newQueryCache(options.QueryCacheSize, srv.metrics)
 	}
 
+	srv.define(options.Databases, options.PruneDatabases)
+
 	return srv, nil
 }
 
+// Reload applies settings which can be changed while the server runs.
+// Rate and query limits are replaced and databases are reconciled.
+func (s *server) Reload(options *Options) (err error) {
+	defer Logger.Time(time.Now(), 10*time.Second, "server.reload")
+
+	s.limits.set(options.RateLimits)
+	s.queryLimits.set(options.QueryLimits)
+	s.define(options.Databases, options.PruneDatabases)
+
+	return nil
+}
+
 func (s *server) Listen() (err error) {
+	if s.options.StatsdAddress != "" {
+		flush := s.options.StatsdFlush
+		if flush <= 0 {
+			flush = DefaultStatsdFlush
+		}
+
+		sd := newStatsd(s, s.options.StatsdMappings)
+		s.statsd = sd
+		go sd.flushEvery(flush)
+		go func() {
+			log.Println("STATSD: listening on", s.options.StatsdAddress)
+			if err := sd.listen(s.options.StatsdAddress); err != nil {
+				Logger.Error(err)
+			}
+		}()
+	}
+
+	go s.hub.expireEvery(SubExpiry)
+
+	interval := s.options.AlertInterval
+	if interval <= 0 {
+		interval = DefaultAlertInterval
+	}
+
+	go s.alerts.evaluateEvery(interval)
+
+	if s.options.Follow != "" {
+		go newFollower(s).run()
+	}
+
+	if s.options.HTTPAddress != "" {
+		go func() {
+			if err := s.listenHTTP(s.options.HTTPAddress); err != nil {
+				Logger.Error(err)
+			}
+		}()
+	}
+
+	if s.options.TLSCert != "" {
+		return s.listenTLS()
+	}
+
 	srv := srpc.NewServer(s.options.Address)
-	srv.SetHandler("info", s.Info)
-	srv.SetHandler("open", s.Open)
-	srv.SetHandler("edit", s.Edit)
-	srv.SetHandler("put", s.Put)
-	srv.SetHandler("inc", s.Inc)
-	srv.SetHandler("get", s.Get)
-	srv.SetHandler("batch", s.Batch)
-	srv.SetHandler("metrics", s.Metrics)
+	for method, handler := range s.handlers() {
+		srv.SetHandler(method, handler)
+	}
+
+	s.closeMutex.Lock()
+	if s.closed {
+		s.closeMutex.Unlock()
+		return goerr.Wrap(ErrClosed, 0)
+	}
+
+	s.listener = srv
+	s.closeMutex.Unlock()
 
 	log.Println("SRPCS:  listening on", s.options.Address)
 	return srv.Listen()
 }
 
+// handlers returns rpc handlers by method name
+func (s *server) handlers() (handlers map[string]func([]byte) ([]byte, error)) {
+	handlers = map[string]func([]byte) ([]byte, error){
+		"info":        s.Info,
+		"open":        s.Open,
+		"edit":        s.Edit,
+		"put":         s.Put,
+		"inc":         s.Inc,
+		"get":         s.Get,
+		"batch":       s.Batch,
+		"metrics":     s.Metrics,
+		"subscribe":   s.Subscribe,
+		"poll":        s.Poll,
+		"unsubscribe": s.Unsubscribe,
+		"setAlert":    s.SetAlert,
+		"delAlert":    s.DelAlert,
+		"listAlerts":  s.ListAlerts,
+		"backup":      s.Backup,
+		"restore":     s.Restore,
+		"drop":        s.Drop,
+		"replicate":   s.Replicate,
+		"reconcile":   s.Reconcile,
+		"retry":       s.Retry,
+	}
+
+	for method, handler := range handlers {
+		handlers[method] = s.track(handler)
+	}
+
+	return handlers
+}
+
 func (s *server) Info(reqData []byte) (resData []byte, err error) {
+	req := &InfoReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
 
-	res, err := s.info(nil)
+	res, err := s.info(req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
 	}
 
+	if err := s.filterInfo(res, req.Token); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
 	resData, err = proto.Marshal(res)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
@@ -166,6 +447,15 @@ func (s *server) Open(reqData []byte) (resData []byte, err error) {
 		return nil, goerr.Wrap(err, 0)
 	}
 
+	// names with path separators could match acl prefixes of other names
+	if !validName(req.Database) {
+		return nil, goerr.Wrap(ErrDatabaseName, 0)
+	}
+
+	if err := s.authorize(&req.Token, req.Database, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
 	res, err := s.open(req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
@@ -186,6 +476,10 @@ func (s *server) Edit(reqData []byte) (resData []byte, err error) {
 		return nil, goerr.Wrap(err, 0)
 	}
 
+	if err := s.authorize(&req.Token, req.Database, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
 	res, err := s.edit(req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
@@ -206,6 +500,15 @@ func (s *server) Put(reqData []byte) (resData []byte, err error) {
 		return nil, goerr.Wrap(err, 0)
 	}
 
+	client := s.rateClient(req.Token)
+	if err := s.authorize(&req.Token, req.Database, OpWrite); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if err := s.limits.take(client, req.Database, LimitWrites, 1); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
 	res, err := s.put(req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
@@ -226,6 +529,15 @@ func (s *server) Inc(reqData []byte) (resData []byte, err error) {
 		return nil, goerr.Wrap(err, 0)
 	}
 
+	client := s.rateClient(req.Token)
+	if err := s.authorize(&req.Token, req.Database, OpWrite); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if err := s.limits.take(client, req.Database, LimitWrites, 1); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
 	res, err := s.inc(req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
@@ -246,7 +558,12 @@ func (s *server) Get(reqData []byte) (resData []byte, err error) {
 		return nil, goerr.Wrap(err, 0)
 	}
 
-	res, err := s.get(req)
+	client := s.rateClient(req.Token)
+	if err := s.authorize(&req.Token, req.Database, OpRead); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := s.getAs(client, req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
 	}
@@ -269,24 +586,48 @@ func (s *server) Batch(reqData []byte) (resData []byte, err error) {
 	num := len(req.Batch)
 	res := &ResBatch{}
 	res.Batch = make([]*Response, num)
+	token := req.Token
 
 	for i, req := range req.Batch {
+		client := requestToken(req)
+		if client == "" {
+			client = token
+		}
+
+		client = s.rateClient(client)
+		if req.OpenReq != nil && !validName(req.OpenReq.Database) {
+			return nil, goerr.Wrap(ErrDatabaseName, 0)
+		}
+
+		if err := s.authorizeRequest(req, token); err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+
 		response := &Response{}
 		var err error
 
 		switch {
 		case req.InfoReq != nil:
 			response.InfoRes, err = s.info(req.InfoReq)
+			if err == nil {
+				err = s.filterInfo(response.InfoRes, req.InfoReq.Token)
+			}
 		case req.OpenReq != nil:
 			response.OpenRes, err = s.open(req.OpenReq)
 		case req.EditReq != nil:
 			response.EditRes, err = s.edit(req.EditReq)
 		case req.PutReq != nil:
-			response.PutRes, err = s.put(req.PutReq)
+			err = s.limits.take(client, req.PutReq.Database, LimitWrites, 1)
+			if err == nil {
+				response.PutRes, err = s.put(req.PutReq)
+			}
 		case req.IncReq != nil:
-			response.IncRes, err = s.inc(req.IncReq)
+			err = s.limits.take(client, req.IncReq.Database, LimitWrites, 1)
+			if err == nil {
+				response.IncRes, err = s.inc(req.IncReq)
+			}
 		case req.GetReq != nil:
-			response.GetRes, err = s.get(req.GetReq)
+			response.GetRes, err = s.getAs(client, req.GetReq)
 		}
 
 		if err != nil {
@@ -305,7 +646,17 @@ func (s *server) Batch(reqData []byte) (resData []byte, err error) {
 }
 
 func (s *server) Metrics(reqData []byte) (resData []byte, err error) {
-	res := &MetricsRes{}
+	req := &MetricsReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if err := s.authorize(&req.Token, AllDatabases, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res := &MetricsRes{Metrics: s.metrics.snapshot()}
 	resData, err = proto.Marshal(res)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
@@ -314,182 +665,923 @@ func (s *server) Metrics(reqData []byte) (resData []byte, err error) {
 	return resData, nil
 }
 
-func (s *server) info(req *InfoReq) (res *InfoRes, err error) {
-	defer Logger.Time(time.Now(), time.Second, "server.info")
-	res = &InfoRes{}
-	res.Databases = make([]*DBInfo, len(s.databases))
-
-	var i int
-	for name, db := range s.databases {
-		metadata, err := db.Info()
-		if err != nil {
-			Logger.Error(err)
-			continue
-		}
+func (s *server) Subscribe(reqData []byte) (resData []byte, err error) {
+	req := &SubscribeReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
 
-		res.Databases[i] = &DBInfo{
-			Database:   name,
-			Resolution: uint32(metadata.Resolution / 1e9),
-		}
+	client := s.rateClient(req.Token)
+	if err := s.authorize(&req.Token, req.Database, OpRead); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
 
-		i++ // increment
+	if err := s.limits.take(client, req.Database, LimitQueries, 1); err != nil {
+		return nil, goerr.Wrap(err, 0)
 	}
 
-	return res, nil
-}
+	res, err := s.subscribe(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
 
-func (s *server) open(req *OpenReq) (res *OpenRes, err error) {
-	defer Logger.Time(time.Now(), 10*time.Second, "server.open")
-	res = &OpenRes{}
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
 
-	db, ok := s.databases[req.Database]
-	if !ok {
-		poinsCount := uint32(req.EpochTime / req.Resolution)
-		ssize := SegSize / (PointSize * poinsCount)
+	return resData, nil
+}
 
-		// FIXME: security issue: req.Name can use ../../
-		//        only allow alpha numeric characters and -
-		db, err := kadiyadb.New(&kadiyadb.Options{
-			Path:        path.Join(s.options.Path, req.Database),
-			Resolution:  int64(req.Resolution) * 1e9,
-			Retention:   int64(req.Retention) * 1e9,
-			Duration:    int64(req.EpochTime) * 1e9,
-			PayloadSize: PointSize,
-			SegmentSize: ssize,
-			MaxROEpochs: req.MaxROEpochs,
-			MaxRWEpochs: req.MaxRWEpochs,
-		})
+func (s *server) Poll(reqData []byte) (resData []byte, err error) {
+	req := &PollReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
 
-		if err != nil {
+	if sub, ok := s.hub.get(req.Id); ok {
+		client := s.rateClient(req.Token)
+		if err := s.authorize(&req.Token, sub.database, OpRead); err != nil {
 			return nil, goerr.Wrap(err, 0)
 		}
 
-		s.databases[req.Database] = db
-	} else {
-		// TODO: update retention period
-		err = db.Edit(req.MaxROEpochs, req.MaxRWEpochs)
-		if err != nil {
+		if err := s.limits.take(client, sub.database, LimitQueries, 1); err != nil {
 			return nil, goerr.Wrap(err, 0)
 		}
 	}
 
-	return res, nil
-}
-
-func (s *server) edit(req *EditReq) (res *EditRes, err error) {
-	defer Logger.Time(time.Now(), time.Second, "server.edit")
-	res = &EditRes{}
-	db, ok := s.databases[req.Database]
-	if !ok {
-		return nil, goerr.Wrap(ErrDatabase, 0)
+	res, err := s.poll(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
 	}
 
-	// TODO: update retention period
-	err = db.Edit(req.MaxROEpochs, req.MaxRWEpochs)
+	resData, err = proto.Marshal(res)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
 	}
 
-	return res, nil
+	return resData, nil
 }
 
-func (s *server) put(req *PutReq) (res *PutRes, err error) {
-	defer Logger.Time(time.Now(), time.Second, "server.put")
-	res = &PutRes{}
-
-	db, ok := s.databases[req.Database]
-	if !ok {
-		return nil, goerr.Wrap(ErrDatabase, 0)
-	}
-
-	payload := valToPld(req.Value, req.Count)
-	timestamp := int64(req.Timestamp) * 1e9
-	err = db.Put(timestamp, req.Fields, payload)
+func (s *server) Unsubscribe(reqData []byte) (resData []byte, err error) {
+	req := &UnsubscribeReq{}
+	err = proto.Unmarshal(reqData, req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
 	}
 
-	return res, nil
-}
-
-func (s *server) inc(req *IncReq) (res *IncRes, err error) {
-	defer Logger.Time(time.Now(), time.Second, "server.inc")
-	res = &IncRes{}
-
-	db, ok := s.databases[req.Database]
-	if !ok {
-		return nil, goerr.Wrap(ErrDatabase, 0)
+	if sub, ok := s.hub.get(req.Id); ok {
+		if err := s.authorize(&req.Token, sub.database, OpRead); err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
 	}
 
-	metadata, err := db.Info()
+	res, err := s.unsubscribe(req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
 	}
 
-	timestamp := int64(req.Timestamp) * 1e9
-	endTime := timestamp + metadata.Resolution
-	data, err := db.One(timestamp, endTime, req.Fields)
+	resData, err = proto.Marshal(res)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
 	}
 
-	val, num := pldToVal(data[0])
-	num += req.Count
-	val += req.Value
-	pld := valToPld(val, num)
+	return resData, nil
+}
 
-	err = db.Put(timestamp, req.Fields, pld)
+func (s *server) SetAlert(reqData []byte) (resData []byte, err error) {
+	req := &SetAlertReq{}
+	err = proto.Unmarshal(reqData, req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
 	}
 
-	return res, nil
-}
+	var database string
+	if req.Rule != nil && req.Rule.Query != nil {
+		database = req.Rule.Query.Database
+		req.Rule.Query.Token = ""
+	}
 
-func (s *server) get(req *GetReq) (res *GetRes, err error) {
-	defer Logger.Time(time.Now(), time.Second, "server.get")
-	res = &GetRes{}
+	// rules are replaced by name so the database of an existing rule
+	// must also be allowed
+	if req.Rule != nil {
+		if rule, ok := s.alerts.get(req.Rule.Name); ok {
+			if err := s.acls.allow(req.Token, rule.Query.Database, OpAdmin); err != nil {
+				return nil, goerr.Wrap(err, 0)
+			}
+		}
+	}
 
-	db, ok := s.databases[req.Database]
-	if !ok {
-		return nil, goerr.Wrap(ErrDatabase, 0)
+	if err := s.authorize(&req.Token, database, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
 	}
 
-	metadata, err := db.Info()
+	res, err := s.setAlert(req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
 	}
 
-	var resolution int64
-	if req.Resolution == 0 {
-		resolution = metadata.Resolution
-	} else {
-		resolution = int64(req.Resolution) * 1e9
-		if resolution%metadata.Resolution != 0 {
-			return nil, goerr.Wrap(ErrResolution, 0)
-		}
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
 	}
 
-	startTime := int64(req.StartTime) * 1e9
-	startTime -= startTime % resolution
-
-	endTime := int64(req.EndTime) * 1e9
-	endTime -= endTime % resolution
+	return resData, nil
+}
 
-	dataMap, err := db.Get(startTime, endTime, req.Fields)
+func (s *server) DelAlert(reqData []byte) (resData []byte, err error) {
+	req := &DelAlertReq{}
+	err = proto.Unmarshal(reqData, req)
 	if err != nil {
 		return nil, goerr.Wrap(err, 0)
 	}
 
-	ss := s.newSeriesSet(req.GroupBy)
-	for item, value := range dataMap {
-		sr := s.newSeries(value, item.Fields, startTime, metadata.Resolution, resolution)
-		ss.add(sr)
+	database := AllDatabases
+	if rule, ok := s.alerts.get(req.Name); ok {
+		database = rule.Query.Database
 	}
 
-	res.Groups = ss.toResult()
+	if err := s.authorize(&req.Token, database, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
 
-	return res, nil
+	res, err := s.delAlert(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (s *server) ListAlerts(reqData []byte) (resData []byte, err error) {
+	req := &ListAlertsReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := s.listAlerts(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if err := s.filterAlerts(res, req.Token); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (s *server) Backup(reqData []byte) (resData []byte, err error) {
+	req := &BackupReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	// backups are written to a server path
+	if err := s.authorize(&req.Token, AllDatabases, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := s.backup(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (s *server) Restore(reqData []byte) (resData []byte, err error) {
+	req := &RestoreReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	// backups are read from a server path
+	if err := s.authorize(&req.Token, AllDatabases, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := s.restore(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (s *server) Drop(reqData []byte) (resData []byte, err error) {
+	req := &DropReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if err := s.authorize(&req.Token, req.Database, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := s.drop(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (s *server) Replicate(reqData []byte) (resData []byte, err error) {
+	req := &ReplicateReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if err := s.authorize(&req.Token, AllDatabases, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := s.replicate(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (s *server) Reconcile(reqData []byte) (resData []byte, err error) {
+	req := &ReconcileReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if err := s.authorize(&req.Token, AllDatabases, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := s.reconcile(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (s *server) Retry(reqData []byte) (resData []byte, err error) {
+	req := &RetryReq{}
+	err = proto.Unmarshal(reqData, req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	database := req.Database
+	if database == "" {
+		database = AllDatabases
+	}
+
+	if err := s.authorize(&req.Token, database, OpAdmin); err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	res, err := s.retry(req)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	resData, err = proto.Marshal(res)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return resData, nil
+}
+
+func (s *server) info(req *InfoReq) (res *InfoRes, err error) {
+	defer Logger.Time(time.Now(), time.Second, "server.info")
+	res = &InfoRes{}
+
+	s.dbsMutex.RLock()
+	defer s.dbsMutex.RUnlock()
+	res.Databases = make([]*DBInfo, len(s.databases))
+
+	var i int
+	for name, db := range s.databases {
+		metadata, err := db.Info()
+		if err != nil {
+			Logger.Error(err)
+			continue
+		}
+
+		res.Databases[i] = &DBInfo{
+			Database:   name,
+			Resolution: uint32(metadata.Resolution / 1e9),
+			Status:     StatusOK,
+		}
+
+		if x, ok := s.indexes[name]; ok {
+			res.Databases[i].Series, res.Databases[i].MaxSeries = x.count()
+		}
+
+		i++ // increment
+	}
+
+	res.Databases = append(res.Databases[:i], s.failedInfo()...)
+
+	return res, nil
+}
+
+func (s *server) open(req *OpenReq) (res *OpenRes, err error) {
+	if s.options.Follow != "" {
+		return nil, goerr.Wrap(ErrFollower, 0)
+	}
+
+	return s.applyOpen(req)
+}
+
+func (s *server) applyOpen(req *OpenReq) (res *OpenRes, err error) {
+	defer Logger.Time(time.Now(), 10*time.Second, "server.open")
+	res = &OpenRes{}
+
+	if !validName(req.Database) {
+		return nil, goerr.Wrap(ErrDatabaseName, 0)
+	}
+
+	s.dbsMutex.Lock()
+	defer s.dbsMutex.Unlock()
+
+	if _, ok := s.failed[req.Database]; ok {
+		return nil, goerr.Wrap(ErrDatabaseFailed, 0)
+	}
+
+	db, ok := s.databases[req.Database]
+	if !ok {
+		segSize := s.options.SegmentSize
+		if segSize == 0 {
+			segSize = SegSize
+		}
+
+		poinsCount := uint32(req.EpochTime / req.Resolution)
+		ssize := segSize / (PointSize * poinsCount)
+
+		db, err := kadiyadb.New(&kadiyadb.Options{
+			Path:        path.Join(s.options.Path, req.Database),
+			Resolution:  int64(req.Resolution) * 1e9,
+			Retention:   int64(req.Retention) * 1e9,
+			Duration:    int64(req.EpochTime) * 1e9,
+			PayloadSize: PointSize,
+			SegmentSize: ssize,
+			MaxROEpochs: req.MaxROEpochs,
+			MaxRWEpochs: req.MaxRWEpochs,
+		})
+
+		if err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+
+		x, err := openSeriesIndex(path.Join(s.options.Path, req.Database), int64(req.Retention)*1e9)
+		if err != nil {
+			if err := db.Close(); err != nil {
+				Logger.Error(err)
+			}
+
+			return nil, err
+		}
+
+		s.databases[req.Database] = db
+		s.indexes[req.Database] = x
+	} else {
+		// TODO: update retention period
+		err = db.Edit(req.MaxROEpochs, req.MaxRWEpochs)
+		if err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+	}
+
+	// the series limit is not changed when it's not set
+	if x, ok := s.indexes[req.Database]; ok && req.MaxSeries > 0 {
+		if err := x.setMax(req.MaxSeries); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.record(&ReplOp{Open: req}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *server) edit(req *EditReq) (res *EditRes, err error) {
+	if s.options.Follow != "" {
+		return nil, goerr.Wrap(ErrFollower, 0)
+	}
+
+	return s.applyEdit(req)
+}
+
+func (s *server) applyEdit(req *EditReq) (res *EditRes, err error) {
+	defer Logger.Time(time.Now(), time.Second, "server.edit")
+	res = &EditRes{}
+	db, ok := s.database(req.Database)
+	if !ok {
+		return nil, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	// TODO: update retention period
+	err = db.Edit(req.MaxROEpochs, req.MaxRWEpochs)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	// closed epochs change with the number of read-write epochs
+	if s.cache != nil {
+		s.cache.invalidateDatabase(req.Database)
+	}
+
+	s.dbsMutex.RLock()
+	x, ok := s.indexes[req.Database]
+	s.dbsMutex.RUnlock()
+
+	// the series limit is not changed when it's not set
+	if ok && (req.MaxSeries > 0 || req.ClearMaxSeries) {
+		if err := x.setMax(req.MaxSeries); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.record(&ReplOp{Edit: req}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// checkWrite checks whether a point can be written to a database. Only
+// read-write epochs accept writes and new epochs are created when the
+// current epoch ends.
+func (s *server) checkWrite(database string, timestamp uint32) (err error) {
+	db, ok := s.database(database)
+	if !ok {
+		return goerr.Wrap(ErrDatabase, 0)
+	}
+
+	metadata, err := db.Info()
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	now := time.Now().UnixNano()
+	ts := int64(timestamp) * 1e9
+	if ts < rwStart(metadata, now) || ts >= now-now%metadata.Duration+metadata.Duration {
+		return goerr.Wrap(ErrWriteTime, 0)
+	}
+
+	return nil
+}
+
+// rwStart returns the start of the oldest read-write epoch
+func rwStart(metadata *kadiyadb.Metadata, now int64) (start int64) {
+	start = now - now%metadata.Duration
+	if metadata.MaxRWEpochs > 1 {
+		start -= int64(metadata.MaxRWEpochs-1) * metadata.Duration
+	}
+
+	return start
+}
+
+func (s *server) put(req *PutReq) (res *PutRes, err error) {
+	if s.options.Follow != "" {
+		return nil, goerr.Wrap(ErrFollower, 0)
+	}
+
+	release, err := s.reserveSeries(req.Database, req.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+	return s.applyPut(req)
+}
+
+// applyPut writes a point. Writes replayed from the write-ahead log are
+// recorded again because they may not be in the replication log after a
+// crash. Puts set values so followers can apply them twice.
+func (s *server) applyPut(req *PutReq) (res *PutRes, err error) {
+	defer Logger.Time(time.Now(), time.Second, "server.put")
+	res = &PutRes{}
+
+	s.walMutex.RLock()
+	defer s.walMutex.RUnlock()
+
+	lock := s.writeLock(req.Database)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	slock := s.seriesLock(req.Database, req.Fields)
+	slock.Lock()
+	defer slock.Unlock()
+
+	db, ok := s.database(req.Database)
+	if !ok {
+		return nil, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	if err := s.logWrite(req); err != nil {
+		return nil, err
+	}
+
+	payload := valToPld(req.Value, req.Count)
+	timestamp := int64(req.Timestamp) * 1e9
+	err = db.Put(timestamp, req.Fields, payload)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	s.invalidateCache(req.Database, req.Fields, req.Timestamp)
+
+	// series from replays and the primary are not limited
+	if err := s.addSeries(req.Database, req.Fields); err != nil {
+		return nil, err
+	}
+
+	if err := s.record(&ReplOp{Put: req}); err != nil {
+		return nil, err
+	}
+
+	s.hub.publish(&StreamPoint{
+		Database:  req.Database,
+		Fields:    req.Fields,
+		Timestamp: req.Timestamp,
+		Value:     req.Value,
+		Count:     req.Count,
+	})
+
+	return res, nil
+}
+
+func (s *server) inc(req *IncReq) (res *IncRes, err error) {
+	defer Logger.Time(time.Now(), time.Second, "server.inc")
+	res = &IncRes{}
+
+	if s.options.Follow != "" {
+		return nil, goerr.Wrap(ErrFollower, 0)
+	}
+
+	release, err := s.reserveSeries(req.Database, req.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	if s.incs != nil {
+		if err := s.bufferInc(req); err != nil {
+			return nil, err
+		}
+
+		// buffered series are counted before they are written
+		if err := s.addSeries(req.Database, req.Fields); err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	}
+
+	return s.applyInc(req)
+}
+
+// applyInc adds an increment to the stored point
+func (s *server) applyInc(req *IncReq) (res *IncRes, err error) {
+	res = &IncRes{}
+
+	s.walMutex.RLock()
+	defer s.walMutex.RUnlock()
+
+	lock := s.writeLock(req.Database)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	// the point is read and written while other writes to it wait
+	slock := s.seriesLock(req.Database, req.Fields)
+	slock.Lock()
+	defer slock.Unlock()
+
+	db, ok := s.database(req.Database)
+	if !ok {
+		return nil, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	metadata, err := db.Info()
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	timestamp := int64(req.Timestamp) * 1e9
+	endTime := timestamp + metadata.Resolution
+	data, err := db.One(timestamp, endTime, req.Fields)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	val, num := pldToVal(data[0])
+	num += req.Count
+	val += req.Value
+	pld := valToPld(val, num)
+
+	// log the result instead of the increment to make replays idempotent
+	result := &PutReq{
+		Database:  req.Database,
+		Fields:    req.Fields,
+		Timestamp: req.Timestamp,
+		Value:     val,
+		Count:     num,
+	}
+
+	if err := s.logWrite(result); err != nil {
+		return nil, err
+	}
+
+	err = db.Put(timestamp, req.Fields, pld)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	s.invalidateCache(req.Database, req.Fields, req.Timestamp)
+
+	if err := s.addSeries(req.Database, req.Fields); err != nil {
+		return nil, err
+	}
+
+	if err := s.record(&ReplOp{Put: result}); err != nil {
+		return nil, err
+	}
+
+	s.hub.publish(&StreamPoint{
+		Database:  req.Database,
+		Fields:    req.Fields,
+		Timestamp: req.Timestamp,
+		Value:     val,
+		Count:     num,
+	})
+
+	return res, nil
+}
+
+func (s *server) drop(req *DropReq) (res *DropRes, err error) {
+	if s.options.Follow != "" {
+		return nil, goerr.Wrap(ErrFollower, 0)
+	}
+
+	return s.applyDrop(req)
+}
+
+func (s *server) applyDrop(req *DropReq) (res *DropRes, err error) {
+	defer Logger.Time(time.Now(), 10*time.Second, "server.drop")
+	res = &DropRes{}
+
+	if !validName(req.Database) {
+		return nil, goerr.Wrap(ErrDatabaseName, 0)
+	}
+
+	lock := s.writeLock(req.Database)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.dbsMutex.Lock()
+	defer s.dbsMutex.Unlock()
+
+	if _, ok := s.failed[req.Database]; ok {
+		if err := s.dropFailed(req.Database); err != nil {
+			return nil, err
+		}
+
+		if err := s.record(&ReplOp{Drop: req}); err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	}
+
+	db, ok := s.databases[req.Database]
+	if !ok {
+		return nil, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	if err := db.Close(); err != nil {
+		Logger.Error(err)
+	}
+
+	if x, ok := s.indexes[req.Database]; ok {
+		if err := x.close(); err != nil {
+			Logger.Error(err)
+		}
+
+		delete(s.indexes, req.Database)
+	}
+
+	delete(s.databases, req.Database)
+
+	if s.incs != nil {
+		s.incs.discard(req.Database)
+	}
+
+	if s.cache != nil {
+		s.cache.invalidateDatabase(req.Database)
+	}
+
+	err = os.RemoveAll(path.Join(s.options.Path, req.Database))
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	if err := s.record(&ReplOp{Drop: req}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *server) get(req *GetReq) (res *GetRes, err error) {
+	res, _, err = s.query(req)
+	return res, err
+}
+
+// query runs a get request and returns the number of points it scanned
+func (s *server) query(req *GetReq) (res *GetRes, scanned int, err error) {
+	defer Logger.Time(time.Now(), time.Second, "server.get")
+	res = &GetRes{}
+
+	// buffered increments are written while queries do not read
+	if s.incs != nil {
+		s.incs.applyMutex.RLock()
+		defer s.incs.applyMutex.RUnlock()
+	}
+
+	s.readers.RLock()
+	defer s.readers.RUnlock()
+
+	db, ok := s.database(req.Database)
+	if !ok {
+		return nil, 0, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	metadata, err := db.Info()
+	if err != nil {
+		return nil, 0, goerr.Wrap(err, 0)
+	}
+
+	var resolution int64
+	if req.Resolution == 0 {
+		resolution = metadata.Resolution
+	} else {
+		resolution = int64(req.Resolution) * 1e9
+		if resolution%metadata.Resolution != 0 {
+			return nil, 0, goerr.Wrap(ErrResolution, 0)
+		}
+	}
+
+	startTime := int64(req.StartTime) * 1e9
+	startTime -= startTime % resolution
+
+	endTime := int64(req.EndTime) * 1e9
+	endTime -= endTime % resolution
+
+	g := s.queryLimits.guard(req.Database)
+	if err := g.checkRange(startTime, endTime, resolution); err != nil {
+		return nil, 0, err
+	}
+
+	if err := s.checkSeriesIndex(req, g, startTime); err != nil {
+		return nil, 0, err
+	}
+
+	if s.cache != nil {
+		res.Groups, scanned, err = s.cachedScan(db, metadata, req, g, startTime, endTime, resolution)
+	} else {
+		res.Groups, scanned, err = s.scan(db, metadata, req, g, startTime, endTime, resolution)
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := g.checkGroups(len(res.Groups)); err != nil {
+		return nil, 0, err
+	}
+
+	return res, scanned, nil
+}
+
+// scan reads points from start to end and groups series. Query limits
+// are checked before and after reading and while grouping.
+func (s *server) scan(db kadiyadb.Database, metadata *kadiyadb.Metadata, req *GetReq, g *queryGuard, start, end, resolution int64) (groups []*ResSeries, scanned int, err error) {
+	if err := g.checkTime(); err != nil {
+		return nil, 0, err
+	}
+
+	dataMap, err := db.Get(start, end, req.Fields)
+	if err != nil {
+		return nil, 0, goerr.Wrap(err, 0)
+	}
+
+	if s.incs != nil {
+		s.incs.merge(req.Database, req.Fields, dataMap, start, end, metadata.Resolution)
+	}
+
+	if err := g.checkTime(); err != nil {
+		return nil, 0, err
+	}
+
+	for item := range dataMap {
+		if err := g.addSeries(item.Fields); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	ss := s.newSeriesSet(req.GroupBy)
+	var count int
+	for item, value := range dataMap {
+		count++
+		if count%checkInterval == 0 {
+			if err := g.checkTime(); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		sr := s.newSeries(value, item.Fields, start, metadata.Resolution, resolution)
+		ss.add(sr)
+		scanned += len(value)
+	}
+
+	return ss.toResult(), scanned, nil
+}
+
+func (s *server) database(name string) (db kadiyadb.Database, ok bool) {
+	s.dbsMutex.RLock()
+	db, ok = s.databases[name]
+	s.dbsMutex.RUnlock()
+	return db, ok
+}
+
+// writeLock returns the write lock of a database
+func (s *server) writeLock(name string) (lock *sync.RWMutex) {
+	s.locksMutex.Lock()
+	defer s.locksMutex.Unlock()
+
+	lock, ok := s.locks[name]
+	if !ok {
+		lock = &sync.RWMutex{}
+		s.locks[name] = lock
+	}
+
+	return lock
+}
+
+// seriesLock returns the lock which is held while a series is written.
+// Series share a fixed number of locks.
+func (s *server) seriesLock(database string, fields []string) (lock *sync.Mutex) {
+	h := fnv.New32a()
+	h.Write([]byte(database + "\x00" + seriesKey(fields)))
+	return &s.seriesLocks[h.Sum32()%uint32(len(s.seriesLocks))]
 }
 
 func (s *server) newSeries(data [][]byte, fields []string, start, dres, rres int64) (sr *ResSeries) {
@@ -516,7 +1608,7 @@ func (s *server) newSeries(data [][]byte, fields []string, start, dres, rres int
 		p := newResPoint(val, num)
 
 		if rts == prevTs {
-			prevPt.add(p)
+			addPoint(prevPt, p)
 		} else {
 			sr.Points = append(sr.Points, p)
 			prevTs = rts
@@ -52,6 +52,59 @@ func init() {
 	ss = s.(*server)
 }
 
+// testOpenReq returns a request to open a database with test options
+func testOpenReq(database string) (req *OpenReq) {
+	return &OpenReq{
+		Database:    database,
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	}
+}
+
+// newTestServer creates a server in an empty directory
+func newTestServer(t *testing.T, options *Options) (s *server) {
+	if err := os.RemoveAll(options.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	return openTestServer(t, options)
+}
+
+// openTestServer creates a server with existing data
+func openTestServer(t *testing.T, options *Options) (s *server) {
+	srv, err := NewServer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srv.(*server)
+}
+
+// closeTestServer closes a server so its directory can be opened again
+func closeTestServer(t *testing.T, s Server) {
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testCall sends a request to a handler and reads the response
+func testCall(t *testing.T, fn func([]byte) ([]byte, error), req, res proto.Message) (err error) {
+	reqData, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resData, err := fn(reqData)
+	if err != nil {
+		return err
+	}
+
+	return proto.Unmarshal(resData, res)
+}
+
 func TestInfo(t *testing.T) {
 	reqData := []byte{}
 	resData, err := s.Info(reqData)
@@ -0,0 +1,684 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/peterh/liner"
+)
+
+const (
+	// HistoryFile keeps shell history in the home directory
+	HistoryFile = ".kadiradb_history"
+
+	// ShellPrompt is shown when the shell waits for a command
+	ShellPrompt = "kadiradb> "
+
+	// BatchPrompt is shown while commands are added to a batch
+	BatchPrompt = "batch> "
+
+	// TimeFormat is used to show timestamps in get results
+	TimeFormat = "2006-01-02 15:04:05"
+)
+
+var (
+	// ErrShellCommand is returned for unknown shell commands
+	ErrShellCommand = errors.New("unknown command, type help for a list of commands")
+
+	// ErrShellArgs is returned when shell command arguments are invalid
+	ErrShellArgs = errors.New("invalid arguments, type help for usage")
+
+	// ErrShellBatch is returned for commands which cannot be in a batch
+	ErrShellBatch = errors.New("only info, open, edit, put, inc and get can be used in a batch")
+)
+
+// shellUsage has the usage of each shell command
+var shellUsage = [][2]string{
+	{"info", "list databases"},
+	{"open <db> resolution=<s> retention=<s> epochTime=<s> [maxROEpochs=2] [maxRWEpochs=2] [maxSeries=0]", "create a database"},
+	{"edit <db> maxROEpochs=<n> maxRWEpochs=<n> [retention=<s>] [maxSeries=<n>]", "change database options (maxSeries=0 removes the limit)"},
+	{"put <db> <fields> <value> [count=1] [time=now]", "write a point"},
+	{"inc <db> <fields> <value> [count=1] [time=now]", "increment a point"},
+	{"get <db> <fields> [from=-1h] [to=now] [resolution=<s>] [groupBy=true,...]", "read points (use * to match any field value)"},
+	{"batch", "add commands until end and send them as one request"},
+	{"metrics [prefix]", "show server metrics"},
+	{"help", "show this help"},
+	{"exit", "leave the shell"},
+}
+
+// shell runs commands against a server and writes results as tables
+type shell struct {
+	call  caller
+	out   io.Writer
+	batch *ReqBatch
+
+	// databases has resolutions of databases seen in info results. It's
+	// used for completion and to show timestamps of points.
+	databases map[string]uint32
+}
+
+func newShell(call caller, out io.Writer) (sh *shell) {
+	return &shell{call: call, out: out, databases: make(map[string]uint32)}
+}
+
+// exec runs a command line. Lines starting with # are comments.
+func (sh *shell) exec(line string) (err error) {
+	args := strings.Fields(line)
+	if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+		return nil
+	}
+
+	cmd, args := args[0], args[1:]
+
+	if sh.batch != nil {
+		if cmd == "end" {
+			batch := sh.batch
+			sh.batch = nil
+			return sh.send(batch)
+		}
+
+		req, err := sh.request(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		sh.batch.Batch = append(sh.batch.Batch, req)
+		return nil
+	}
+
+	switch cmd {
+	case "help":
+		sh.help()
+		return nil
+	case "batch":
+		sh.batch = &ReqBatch{}
+		return nil
+	case "metrics":
+		return sh.metrics(args)
+	}
+
+	req, err := sh.request(cmd, args)
+	if goerr.Is(err, ErrShellBatch) {
+		return goerr.Wrap(ErrShellCommand, 0)
+	} else if err != nil {
+		return err
+	}
+
+	return sh.send(&ReqBatch{Batch: []*Request{req}})
+}
+
+// request parses a command which can be sent in a batch
+func (sh *shell) request(cmd string, args []string) (req *Request, err error) {
+	a := parseShellArgs(args)
+	req = &Request{}
+
+	switch cmd {
+	case "info":
+		req.InfoReq = &InfoReq{}
+	case "open":
+		req.OpenReq = &OpenReq{
+			Database:    a.arg(0),
+			Resolution:  a.seconds("resolution", 0),
+			Retention:   a.seconds("retention", 0),
+			EpochTime:   a.seconds("epochTime", 0),
+			MaxROEpochs: a.uint32("maxROEpochs", 2),
+			MaxRWEpochs: a.uint32("maxRWEpochs", 2),
+			MaxSeries:   a.uint32("maxSeries", 0),
+		}
+
+		if req.OpenReq.Resolution == 0 || req.OpenReq.Retention == 0 || req.OpenReq.EpochTime == 0 {
+			return nil, goerr.Wrap(ErrShellArgs, 0)
+		}
+	case "edit":
+		// the server always sets both epoch limits so they are required
+		_, hasRO := a.opts["maxROEpochs"]
+		_, hasRW := a.opts["maxRWEpochs"]
+		_, hasMaxSeries := a.opts["maxSeries"]
+
+		req.EditReq = &EditReq{
+			Database:    a.arg(0),
+			Retention:   a.seconds("retention", 0),
+			MaxROEpochs: a.uint32("maxROEpochs", 0),
+			MaxRWEpochs: a.uint32("maxRWEpochs", 0),
+			MaxSeries:   a.uint32("maxSeries", 0),
+		}
+
+		if !hasRO || !hasRW || req.EditReq.MaxROEpochs == 0 || req.EditReq.MaxRWEpochs == 0 {
+			return nil, goerr.Wrap(ErrShellArgs, 0)
+		}
+
+		// maxSeries=0 removes the limit and omitting it keeps the limit
+		req.EditReq.ClearMaxSeries = hasMaxSeries && req.EditReq.MaxSeries == 0
+	case "put", "inc":
+		now := uint32(time.Now().Unix())
+		put := &PutReq{
+			Database:  a.arg(0),
+			Fields:    strings.Split(a.arg(1), ","),
+			Value:     a.float(2),
+			Count:     a.uint32("count", 1),
+			Timestamp: a.timestamp("time", now, now),
+		}
+
+		if cmd == "put" {
+			req.PutReq = put
+		} else {
+			req.IncReq = &IncReq{
+				Database:  put.Database,
+				Fields:    put.Fields,
+				Value:     put.Value,
+				Count:     put.Count,
+				Timestamp: put.Timestamp,
+			}
+		}
+	case "get":
+		now := uint32(time.Now().Unix())
+		get := &GetReq{
+			Database:   a.arg(0),
+			Fields:     parseFieldFilter(a.arg(1)),
+			StartTime:  a.timestamp("from", now-3600, now),
+			EndTime:    a.timestamp("to", now, now),
+			Resolution: a.seconds("resolution", 0),
+		}
+
+		get.GroupBy = a.bools("groupBy", len(get.Fields))
+		req.GetReq = get
+	default:
+		return nil, goerr.Wrap(ErrShellBatch, 0)
+	}
+
+	if err := a.done(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// send sends a batch and prints responses
+func (sh *shell) send(batch *ReqBatch) (err error) {
+	if len(batch.Batch) == 0 {
+		return nil
+	}
+
+	res := &ResBatch{}
+	if err := sh.call("batch", batch, res); err != nil {
+		return err
+	}
+
+	for i, r := range res.Batch {
+		if i > 0 {
+			fmt.Fprintln(sh.out)
+		}
+
+		if err := sh.print(batch.Batch[i], r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// print writes a response as a table
+func (sh *shell) print(req *Request, res *Response) (err error) {
+	switch {
+	case res.InfoRes != nil:
+		sh.printInfo(res.InfoRes)
+	case res.GetRes != nil:
+		return sh.printGet(req.GetReq, res.GetRes)
+	case res.OpenRes != nil:
+		sh.databases[req.OpenReq.Database] = req.OpenReq.Resolution
+		fmt.Fprintln(sh.out, "ok")
+	default:
+		fmt.Fprintln(sh.out, "ok")
+	}
+
+	return nil
+}
+
+func (sh *shell) printInfo(res *InfoRes) {
+	sort.Sort(byDatabase(res.Databases))
+
+	w := tabwriter.NewWriter(sh.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tRESOLUTION\tSERIES\tMAX SERIES\tSTATUS\tERROR")
+	for _, dbi := range res.Databases {
+		if dbi.Status == StatusOK || dbi.Status == "" {
+			sh.databases[dbi.Database] = dbi.Resolution
+		}
+
+		fmt.Fprintf(w, "%s\t%ds\t%d\t%d\t%s\t%s\n", dbi.Database, dbi.Resolution, dbi.Series, dbi.MaxSeries, dbi.Status, dbi.Error)
+	}
+
+	w.Flush()
+}
+
+// printGet writes a row for each point which has a value
+func (sh *shell) printGet(req *GetReq, res *GetRes) (err error) {
+	resolution := req.Resolution
+	if resolution == 0 {
+		if resolution, err = sh.resolution(req.Database); err != nil {
+			return err
+		}
+	}
+
+	start := req.StartTime - req.StartTime%resolution
+
+	w := tabwriter.NewWriter(sh.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tFIELDS\tVALUE\tCOUNT")
+
+	var rows int
+	for _, sr := range res.Groups {
+		fields := strings.Join(sr.Fields, ",")
+		for i, p := range sr.Points {
+			if p.Count == 0 {
+				continue
+			}
+
+			ts := time.Unix(int64(start+uint32(i)*resolution), 0).Format(TimeFormat)
+			fmt.Fprintf(w, "%s\t%s\t%v\t%d\n", ts, fields, p.Value, p.Count)
+			rows++
+		}
+	}
+
+	w.Flush()
+	fmt.Fprintln(sh.out, rows, "points")
+	return nil
+}
+
+// resolution returns the resolution of a database from info results
+func (sh *shell) resolution(database string) (resolution uint32, err error) {
+	if resolution, ok := sh.databases[database]; ok && resolution > 0 {
+		return resolution, nil
+	}
+
+	if err := sh.refresh(); err != nil {
+		return 0, err
+	}
+
+	if resolution, ok := sh.databases[database]; ok && resolution > 0 {
+		return resolution, nil
+	}
+
+	return 0, goerr.Wrap(ErrDatabase, 0)
+}
+
+// refresh loads database names and resolutions
+func (sh *shell) refresh() (err error) {
+	res := &InfoRes{}
+	if err := sh.call("info", &InfoReq{}, res); err != nil {
+		return err
+	}
+
+	for _, dbi := range res.Databases {
+		if dbi.Status == StatusOK || dbi.Status == "" {
+			sh.databases[dbi.Database] = dbi.Resolution
+		}
+	}
+
+	return nil
+}
+
+func (sh *shell) metrics(args []string) (err error) {
+	res := &MetricsRes{}
+	if err := sh.call("metrics", &MetricsReq{}, res); err != nil {
+		return err
+	}
+
+	var prefix string
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+
+	sort.Sort(metricsByName(res.Metrics))
+
+	w := tabwriter.NewWriter(sh.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METRIC\tVALUE")
+	for _, m := range res.Metrics {
+		if strings.HasPrefix(m.Name, prefix) {
+			fmt.Fprintf(w, "%s\t%v\n", m.Name, m.Value)
+		}
+	}
+
+	return w.Flush()
+}
+
+func (sh *shell) help() {
+	w := tabwriter.NewWriter(sh.out, 0, 4, 2, ' ', 0)
+	for _, u := range shellUsage {
+		fmt.Fprintf(w, "%s\t%s\n", u[0], u[1])
+	}
+
+	w.Flush()
+}
+
+// complete returns completions for commands and database names
+func (sh *shell) complete(line string) (lines []string) {
+	args := strings.Fields(line)
+	if strings.HasSuffix(line, " ") {
+		args = append(args, "")
+	}
+
+	switch len(args) {
+	case 0, 1:
+		var prefix string
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+
+		for _, u := range shellUsage {
+			cmd := strings.Fields(u[0])[0]
+			if strings.HasPrefix(cmd, prefix) {
+				lines = append(lines, cmd+" ")
+			}
+		}
+
+		if sh.batch != nil && strings.HasPrefix("end", prefix) {
+			lines = append(lines, "end")
+		}
+	case 2:
+		switch args[0] {
+		case "edit", "put", "inc", "get":
+		default:
+			return nil
+		}
+
+		for name := range sh.databases {
+			if strings.HasPrefix(name, args[1]) {
+				lines = append(lines, args[0]+" "+name+" ")
+			}
+		}
+	}
+
+	sort.Strings(lines)
+	return lines
+}
+
+// shellArgs has positional arguments and name=value options of a command.
+// Errors are kept until done is called.
+type shellArgs struct {
+	pos  []string
+	opts map[string]string
+	used map[string]bool
+	err  error
+}
+
+func parseShellArgs(args []string) (a *shellArgs) {
+	a = &shellArgs{opts: make(map[string]string), used: make(map[string]bool)}
+	for _, arg := range args {
+		if i := strings.Index(arg, "="); i > 0 {
+			a.opts[arg[:i]] = arg[i+1:]
+		} else {
+			a.pos = append(a.pos, arg)
+		}
+	}
+
+	return a
+}
+
+func (a *shellArgs) fail() {
+	if a.err == nil {
+		a.err = goerr.Wrap(ErrShellArgs, 0)
+	}
+}
+
+// arg returns a required positional argument
+func (a *shellArgs) arg(i int) (str string) {
+	if i >= len(a.pos) {
+		a.fail()
+		return ""
+	}
+
+	return a.pos[i]
+}
+
+// float returns a required positional argument as a number
+func (a *shellArgs) float(i int) (v float64) {
+	v, err := strconv.ParseFloat(a.arg(i), 64)
+	if err != nil {
+		a.fail()
+	}
+
+	return v
+}
+
+// opt returns an option and marks it as used
+func (a *shellArgs) opt(name string) (str string, ok bool) {
+	str, ok = a.opts[name]
+	a.used[name] = true
+	return str, ok
+}
+
+func (a *shellArgs) uint32(name string, def uint32) (v uint32) {
+	str, ok := a.opt(name)
+	if !ok {
+		return def
+	}
+
+	n, err := strconv.ParseUint(str, 10, 32)
+	if err != nil {
+		a.fail()
+	}
+
+	return uint32(n)
+}
+
+// seconds reads seconds or a duration string like 1h
+func (a *shellArgs) seconds(name string, def uint32) (v uint32) {
+	str, ok := a.opt(name)
+	if !ok {
+		return def
+	}
+
+	if n, err := strconv.ParseUint(str, 10, 32); err == nil {
+		return uint32(n)
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil || d < 0 {
+		a.fail()
+	}
+
+	return uint32(d / time.Second)
+}
+
+// timestamp reads a unix timestamp, now or a duration relative to now
+// (like -1h)
+func (a *shellArgs) timestamp(name string, def, now uint32) (v uint32) {
+	str, ok := a.opt(name)
+	if !ok {
+		return def
+	}
+
+	if str == "now" {
+		return now
+	}
+
+	if n, err := strconv.ParseUint(str, 10, 32); err == nil {
+		return uint32(n)
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		a.fail()
+	}
+
+	return uint32(int64(now) + int64(d/time.Second))
+}
+
+// bools reads a comma separated list with n values. All values are true
+// when it's not set.
+func (a *shellArgs) bools(name string, n int) (v []bool) {
+	v = make([]bool, n)
+	str, ok := a.opt(name)
+	if !ok {
+		for i := range v {
+			v[i] = true
+		}
+
+		return v
+	}
+
+	parts := strings.Split(str, ",")
+	if len(parts) != n {
+		a.fail()
+		return v
+	}
+
+	for i, part := range parts {
+		b, err := strconv.ParseBool(part)
+		if err != nil {
+			a.fail()
+		}
+
+		v[i] = b
+	}
+
+	return v
+}
+
+// done returns the first error or an error for unknown options
+func (a *shellArgs) done() (err error) {
+	for name := range a.opts {
+		if !a.used[name] {
+			a.fail()
+		}
+	}
+
+	return a.err
+}
+
+type byDatabase []*DBInfo
+
+func (s byDatabase) Len() int           { return len(s) }
+func (s byDatabase) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byDatabase) Less(i, j int) bool { return s[i].Database < s[j].Database }
+
+// shellCommand starts an interactive shell. Commands are read from -e or
+// from stdin when it's not a terminal and the shell stops at the first
+// error so it can be used in scripts.
+func shellCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	addr := fs.String("addr", DefaultAddr, "server address")
+	token := fs.String("token", "", "authentication token")
+	secure := newTLSFlags(fs)
+	script := fs.String("e", "", "commands to run separated by ; (non-interactive)")
+	fs.Parse(args)
+
+	conn, err := secure.dial(*addr, *token)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	call := conn.call
+
+	sh := newShell(call, os.Stdout)
+
+	if *script != "" {
+		return sh.run(strings.NewReader(strings.Replace(*script, ";", "\n", -1)))
+	}
+
+	if finfo, err := os.Stdin.Stat(); err == nil && finfo.Mode()&os.ModeCharDevice == 0 {
+		return sh.run(os.Stdin)
+	}
+
+	return sh.interactive()
+}
+
+// run runs commands from a reader and stops at the first error. A batch
+// which is not ended is sent at the end.
+func (sh *shell) run(r io.Reader) (err error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		input := strings.TrimSpace(sc.Text())
+		if input == "exit" || input == "quit" {
+			break
+		}
+
+		if err := sh.exec(input); err != nil {
+			return err
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if sh.batch != nil {
+		batch := sh.batch
+		sh.batch = nil
+		return sh.send(batch)
+	}
+
+	return nil
+}
+
+// interactive reads commands with history and completion until exit
+func (sh *shell) interactive() (err error) {
+	if err := sh.refresh(); err != nil {
+		Logger.Error(err)
+	}
+
+	line := liner.NewLiner()
+	defer line.Close()
+
+	line.SetCtrlCAborts(true)
+	line.SetCompleter(sh.complete)
+
+	hpath := path.Join(os.Getenv("HOME"), HistoryFile)
+	if file, err := os.Open(hpath); err == nil {
+		line.ReadHistory(file)
+		file.Close()
+	}
+
+	defer func() {
+		if file, err := os.Create(hpath); err == nil {
+			line.WriteHistory(file)
+			file.Close()
+		}
+	}()
+
+	fmt.Fprintln(sh.out, "type help for a list of commands")
+
+	for {
+		prompt := ShellPrompt
+		if sh.batch != nil {
+			prompt = BatchPrompt
+		}
+
+		input, err := line.Prompt(prompt)
+		if err == liner.ErrPromptAborted {
+			sh.batch = nil
+			continue
+		} else if err == io.EOF {
+			fmt.Fprintln(sh.out)
+			return nil
+		} else if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+
+		line.AppendHistory(input)
+
+		if input == "exit" || input == "quit" {
+			return nil
+		}
+
+		if err := sh.exec(input); err != nil {
+			fmt.Fprintln(sh.out, "error:", err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	goerr "github.com/go-errors/errors"
+)
+
+func TestShell(t *testing.T) {
+	dir := "/tmp/d-shell"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	sh := newShell(localCaller(srv), out)
+
+	script := `
+# create a database and write points in a batch
+open test resolution=1m retention=10h epochTime=1h
+batch
+put test a,b 2 time=-2m
+inc test a,c 3 count=2 time=-2m
+end
+info
+get test a,* from=-1h
+exit
+put test a,b 5
+`
+
+	if err := sh.run(strings.NewReader(script)); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	var info, points string
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "test "):
+			info = line
+		case strings.Contains(line, "a,c"):
+			points = line
+		}
+	}
+
+	if fields := strings.Fields(info); len(fields) < 5 || fields[1] != "60s" || fields[2] != "2" || fields[4] != StatusOK {
+		t.Fatal("info should be a table", out.String())
+	}
+
+	if fields := strings.Fields(points); len(fields) != 5 || fields[3] != "3" || fields[4] != "2" {
+		t.Fatal("points should be a table", out.String())
+	}
+
+	out.Reset()
+	if err := sh.exec("get test a,b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "1 points") {
+		t.Fatal("commands after exit should not run", out.String())
+	}
+
+	if err := sh.exec("get test a,* groupBy=true"); !goerr.Is(err, ErrShellArgs) {
+		t.Fatal("invalid arguments should fail", err)
+	}
+
+	if err := sh.exec("put test a 1 foo=1"); !goerr.Is(err, ErrShellArgs) {
+		t.Fatal("unknown options should fail", err)
+	}
+
+	if err := sh.exec("edit test maxSeries=100"); !goerr.Is(err, ErrShellArgs) {
+		t.Fatal("edit should require epoch limits", err)
+	}
+
+	req, err := sh.request("edit", []string{"test", "maxROEpochs=2", "maxRWEpochs=2", "maxSeries=0"})
+	if err != nil || !req.EditReq.ClearMaxSeries {
+		t.Fatal("maxSeries=0 should remove the limit", req, err)
+	}
+
+	if err := sh.exec("drop test"); !goerr.Is(err, ErrShellCommand) {
+		t.Fatal("unknown commands should fail", err)
+	}
+
+	if err := sh.run(strings.NewReader("put test a 1\nput missing a 1\ninfo")); err == nil {
+		t.Fatal("scripts should stop at the first error")
+	}
+
+	if c := sh.complete("g"); len(c) != 1 || c[0] != "get " {
+		t.Fatal("commands should be completed", c)
+	}
+
+	if c := sh.complete("put te"); len(c) != 1 || c[0] != "put test " {
+		t.Fatal("databases should be completed", c)
+	}
+}
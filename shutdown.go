@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/kadirahq/kadiyadb"
+)
+
+const (
+	// DefaultShutdownTimeout is the default time to wait for requests to
+	// finish before databases are closed
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+var (
+	// ErrClosed is returned for requests received while shutting down
+	ErrClosed = errors.New("server is shutting down")
+
+	// ErrShutdownTimeout is returned by Close when requests did not finish
+	// before the shutdown timeout
+	ErrShutdownTimeout = errors.New("timed out waiting for requests to finish")
+)
+
+// begin registers a request unless the server is closing. done must be
+// called on s.requests when the request finishes.
+func (s *server) begin() (ok bool) {
+	s.closeMutex.RLock()
+	defer s.closeMutex.RUnlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.requests.Add(1)
+	return true
+}
+
+// closing checks whether Close has been called
+func (s *server) closing() (closed bool) {
+	s.closeMutex.RLock()
+	defer s.closeMutex.RUnlock()
+	return s.closed
+}
+
+// track rejects requests after Close is called and keeps count of running
+// requests so that Close can wait for them
+func (s *server) track(handler func([]byte) ([]byte, error)) func([]byte) ([]byte, error) {
+	return func(reqData []byte) (resData []byte, err error) {
+		if !s.begin() {
+			return nil, goerr.Wrap(ErrClosed, 0)
+		}
+
+		defer s.requests.Done()
+		return handler(reqData)
+	}
+}
+
+// Close stops accepting requests, waits for running requests and closes
+// all databases. Databases are closed even if requests did not finish
+// before the timeout but not while they are read. Writes which are still
+// running will fail.
+func (s *server) Close() (err error) {
+	defer Logger.Time(time.Now(), 10*time.Second, "server.close")
+
+	s.closeMutex.Lock()
+	if s.closed {
+		s.closeMutex.Unlock()
+		return goerr.Wrap(ErrClosed, 0)
+	}
+
+	s.closed = true
+	listener, httpServer := s.listener, s.httpServer
+	s.closeMutex.Unlock()
+
+	timeout := s.options.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	if listener != nil {
+		if err := listener.Close(); err != nil {
+			Logger.Error(err)
+		}
+	}
+
+	if s.statsd != nil {
+		if err := s.statsd.close(); err != nil {
+			Logger.Error(err)
+		}
+	}
+
+	if httpServer != nil {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		if err := httpServer.Shutdown(ctx); err != nil {
+			Logger.Error(err)
+		}
+
+		cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.requests.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(deadline.Sub(time.Now())):
+		err = goerr.Wrap(ErrShutdownTimeout, 0)
+		Logger.Error(err)
+	}
+
+	// write aggregated statsd values before databases are closed
+	if s.statsd != nil {
+		s.statsd.flush(time.Now())
+	}
+
+	if ferr := s.flushIncs(); ferr != nil && err == nil {
+		err = ferr
+	}
+
+	if cerr := s.closeDatabases(); cerr != nil && err == nil {
+		err = cerr
+	}
+
+	if s.repl != nil {
+		if cerr := s.repl.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// closeDatabases syncs and closes all databases and the write-ahead log.
+// It waits for running reads, writes are blocked while databases are
+// closed and both fail afterwards.
+func (s *server) closeDatabases() (err error) {
+	s.readers.Lock()
+	defer s.readers.Unlock()
+
+	s.walMutex.Lock()
+	defer s.walMutex.Unlock()
+
+	s.dbsMutex.Lock()
+	defer s.dbsMutex.Unlock()
+
+	synced := true
+	for name, db := range s.databases {
+		if serr := db.Sync(); serr != nil {
+			Logger.Error(serr, name)
+			synced = false
+			if err == nil {
+				err = goerr.Wrap(serr, 0)
+			}
+		}
+
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = goerr.Wrap(cerr, 0)
+		}
+
+		if x, ok := s.indexes[name]; ok {
+			if cerr := x.close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+
+	s.databases = make(map[string]kadiyadb.Database)
+	s.indexes = make(map[string]*seriesIndex)
+
+	if s.wal != nil {
+		// the log is only needed for databases which were not synced
+		if synced {
+			if terr := s.wal.truncate(); terr != nil && err == nil {
+				err = terr
+			}
+		}
+
+		if cerr := s.wal.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/gogo/protobuf/proto"
+)
+
+func TestClose(t *testing.T) {
+	dir := "/tmp/d-shutdown"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{Path: dir, WALPolicy: WALSyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	handlers := s.handlers()
+	call := func(method string, req, res proto.Message) error {
+		reqData, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resData, err := handlers[method](reqData)
+		if err != nil {
+			return err
+		}
+
+		return proto.Unmarshal(resData, res)
+	}
+
+	open := &OpenReq{
+		Database:    "closing",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	}
+
+	if err := call("open", open, &OpenRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	put := &PutReq{Database: "closing", Fields: []string{"a"}, Timestamp: uint32(time.Now().Unix()), Value: 1, Count: 1}
+	if err := call("put", put, &PutRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a running request delays Close until it finishes
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slow := s.track(func(reqData []byte) ([]byte, error) {
+		close(started)
+		<-release
+		return s.Put(reqData)
+	})
+
+	reqData, err := proto.Marshal(put)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slowErr := make(chan error, 1)
+	go func() {
+		_, err := slow(reqData)
+		slowErr <- err
+	}()
+
+	<-started
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- srv.Close()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-closed:
+		t.Fatal("close should wait for running requests")
+	default:
+	}
+
+	if err := call("put", put, &PutRes{}); !goerr.Is(err, ErrClosed) {
+		t.Fatal("new requests should be rejected while closing", err)
+	}
+
+	close(release)
+	if err := <-slowErr; err != nil {
+		t.Fatal("running requests should finish", err)
+	}
+
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.databases) != 0 {
+		t.Fatal("databases should be closed")
+	}
+
+	if finfo, err := os.Stat(path.Join(dir, WALFile)); err != nil || finfo.Size() != 0 {
+		t.Fatal("wal should be truncated after databases are synced", err)
+	}
+
+	if err := srv.Close(); !goerr.Is(err, ErrClosed) {
+		t.Fatal("second close should fail", err)
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	dir := "/tmp/d-shutdown-timeout"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{Path: dir, ShutdownTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{})
+	stuck := s.track(func(reqData []byte) ([]byte, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+
+	go stuck(nil)
+	<-started
+
+	// databases are not closed while they are read
+	s.readers.RLock()
+	closed := make(chan error, 1)
+	go func() {
+		closed <- srv.Close()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-closed:
+		t.Fatal("close should wait for running reads")
+	default:
+	}
+
+	s.readers.RUnlock()
+	if err := <-closed; !goerr.Is(err, ErrShutdownTimeout) {
+		t.Fatal("close should time out", err)
+	}
+}
+
+func TestCloseListener(t *testing.T) {
+	addr := "127.0.0.1:19351"
+	s := newTestServer(t, &Options{Path: "/tmp/d-shutdown-listener", Address: addr})
+
+	listening := make(chan error, 1)
+	go func() {
+		listening <- s.Listen()
+	}()
+
+	for i := 0; ; i++ {
+		if conn, err := dial(addr, "", nil); err == nil {
+			conn.Close()
+			break
+		} else if i == 100 {
+			t.Fatal(err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	closeTestServer(t, s)
+	<-listening
+
+	if conn, err := dial(addr, "", nil); err == nil {
+		conn.Close()
+		t.Fatal("close should stop accepting connections")
+	}
+}
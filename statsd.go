@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// StatsdPacketSize is the maximum size of a single statsd udp packet
+	StatsdPacketSize = 64 * 1024
+
+	// DefaultStatsdFlush is the default interval between statsd flushes
+	DefaultStatsdFlush = 10 * time.Second
+)
+
+var (
+	// ErrStatsdLine is returned when a statsd line cannot be parsed
+	ErrStatsdLine = errors.New("invalid statsd line")
+
+	// ErrStatsdType is returned when the statsd metric type is unknown
+	ErrStatsdType = errors.New("unknown statsd metric type")
+
+	// ErrStatsdMapping is returned when a metric doesn't match any mapping
+	ErrStatsdMapping = errors.New("no statsd mapping for metric")
+)
+
+// StatsdMapping maps statsd metrics with a name prefix to a database.
+// Each entry in Fields can be "name" (metric name without the prefix),
+// "tag:<key>" (value of a dogstatsd style tag) or any other literal value.
+type StatsdMapping struct {
+	Prefix   string   `json:"prefix"`
+	Database string   `json:"database"`
+	Fields   []string `json:"fields"`
+}
+
+type statsdMetric struct {
+	name  string
+	kind  string
+	value float64
+	rate  float64
+	delta bool
+	tags  map[string]string
+}
+
+type statsdPoint struct {
+	database string
+	fields   []string
+	value    float64
+	count    float64
+	dirty    bool
+}
+
+type statsd struct {
+	server   *server
+	mappings []*StatsdMapping
+	mutex    sync.Mutex
+	counters map[string]*statsdPoint
+	gauges   map[string]*statsdPoint
+	conn     *net.UDPConn
+	closed   bool
+}
+
+func newStatsd(s *server, mappings []*StatsdMapping) (sd *statsd) {
+	return &statsd{
+		server:   s,
+		mappings: mappings,
+		counters: make(map[string]*statsdPoint),
+		gauges:   make(map[string]*statsdPoint),
+	}
+}
+
+// listen reads statsd packets from the udp address until it fails or
+// until close is called
+func (sd *statsd) listen(addr string) (err error) {
+	uaddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	conn, err := net.ListenUDP("udp", uaddr)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	sd.mutex.Lock()
+	if sd.closed {
+		sd.mutex.Unlock()
+		conn.Close()
+		return nil
+	}
+
+	sd.conn = conn
+	sd.mutex.Unlock()
+
+	defer conn.Close()
+	buff := make([]byte, StatsdPacketSize)
+
+	for {
+		n, _, err := conn.ReadFrom(buff)
+		if err != nil {
+			if sd.isClosed() {
+				return nil
+			}
+
+			return goerr.Wrap(err, 0)
+		}
+
+		sd.handle(buff[:n])
+	}
+}
+
+// close stops listening for packets
+func (sd *statsd) close() (err error) {
+	sd.mutex.Lock()
+	defer sd.mutex.Unlock()
+
+	sd.closed = true
+	if sd.conn == nil {
+		return nil
+	}
+
+	if err := sd.conn.Close(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+func (sd *statsd) isClosed() (closed bool) {
+	sd.mutex.Lock()
+	defer sd.mutex.Unlock()
+	return sd.closed
+}
+
+// handle parses all lines in a statsd packet and records them
+func (sd *statsd) handle(packet []byte) {
+	lines := strings.Split(string(packet), "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		m, err := parseStatsdLine(line)
+		if err != nil {
+			Logger.Error(err, line)
+			continue
+		}
+
+		if err := sd.record(m); err != nil {
+			Logger.Error(err, line)
+		}
+	}
+}
+
+// record adds a metric to the aggregate of the series it maps to
+func (sd *statsd) record(m *statsdMetric) (err error) {
+	database, fields, ok := sd.resolve(m)
+	if !ok {
+		return goerr.Wrap(ErrStatsdMapping, 0)
+	}
+
+	key := database + "\x00" + strings.Join(fields, "\x00")
+
+	sd.mutex.Lock()
+	defer sd.mutex.Unlock()
+
+	if m.kind == "g" {
+		p, ok := sd.gauges[key]
+		if !ok {
+			p = &statsdPoint{database: database, fields: fields}
+			sd.gauges[key] = p
+		}
+
+		if m.delta {
+			p.value += m.value
+		} else {
+			p.value = m.value
+		}
+
+		p.count = 1
+		p.dirty = true
+		return nil
+	}
+
+	p, ok := sd.counters[key]
+	if !ok {
+		p = &statsdPoint{database: database, fields: fields}
+		sd.counters[key] = p
+	}
+
+	// correct for client side sampling
+	p.value += m.value / m.rate
+	p.count += 1 / m.rate
+
+	return nil
+}
+
+// resolve finds the database and fields for a metric using mappings
+func (sd *statsd) resolve(m *statsdMetric) (database string, fields []string, ok bool) {
+	for _, mp := range sd.mappings {
+		if !strings.HasPrefix(m.name, mp.Prefix) {
+			continue
+		}
+
+		fields = make([]string, len(mp.Fields))
+		for i, f := range mp.Fields {
+			switch {
+			case f == "name":
+				fields[i] = strings.TrimPrefix(m.name, mp.Prefix)
+			case strings.HasPrefix(f, "tag:"):
+				fields[i] = m.tags[strings.TrimPrefix(f, "tag:")]
+			default:
+				fields[i] = f
+			}
+		}
+
+		return mp.Database, fields, true
+	}
+
+	return "", nil, false
+}
+
+// flushEvery writes aggregated values to databases on every tick
+func (sd *statsd) flushEvery(d time.Duration) {
+	for now := range time.Tick(d) {
+		if sd.server.closing() {
+			return
+		}
+
+		sd.flush(now)
+	}
+}
+
+// flush writes counters and timers with inc and updated gauges with put.
+// Counters are reset after each flush while gauges keep their last value.
+func (sd *statsd) flush(now time.Time) {
+	defer Logger.Time(time.Now(), time.Second, "statsd.flush")
+	ts := uint32(now.Unix())
+
+	sd.mutex.Lock()
+	counters := sd.counters
+	sd.counters = make(map[string]*statsdPoint)
+
+	gauges := make([]*statsdPoint, 0, len(sd.gauges))
+	for _, p := range sd.gauges {
+		if p.dirty {
+			copied := *p
+			gauges = append(gauges, &copied)
+			p.dirty = false
+		}
+	}
+	sd.mutex.Unlock()
+
+	for _, p := range counters {
+		req := &IncReq{
+			Database:  p.database,
+			Fields:    p.fields,
+			Timestamp: ts,
+			Value:     p.value,
+			Count:     uint32(math.Floor(p.count + 0.5)),
+		}
+
+		if _, err := sd.server.inc(req); err != nil {
+			Logger.Error(err)
+		}
+	}
+
+	for _, p := range gauges {
+		req := &PutReq{
+			Database:  p.database,
+			Fields:    p.fields,
+			Timestamp: ts,
+			Value:     p.value,
+			Count:     1,
+		}
+
+		if _, err := sd.server.put(req); err != nil {
+			Logger.Error(err)
+		}
+	}
+}
+
+// parseStatsdLine parses a line in "name:value|type|@rate|#tag:val" format
+func parseStatsdLine(line string) (m *statsdMetric, err error) {
+	sep := strings.LastIndex(line, ":")
+	if i := strings.Index(line, "|"); i >= 0 {
+		sep = strings.LastIndex(line[:i], ":")
+	}
+
+	if sep <= 0 {
+		return nil, goerr.Wrap(ErrStatsdLine, 0)
+	}
+
+	parts := strings.Split(line[sep+1:], "|")
+	if len(parts) < 2 {
+		return nil, goerr.Wrap(ErrStatsdLine, 0)
+	}
+
+	m = &statsdMetric{
+		name: line[:sep],
+		kind: parts[1],
+		rate: 1,
+		tags: map[string]string{},
+	}
+
+	switch m.kind {
+	case "c", "g":
+	case "ms", "h":
+		m.kind = "ms"
+	default:
+		return nil, goerr.Wrap(ErrStatsdType, 0)
+	}
+
+	valstr := parts[0]
+	if m.kind == "g" && (strings.HasPrefix(valstr, "+") || strings.HasPrefix(valstr, "-")) {
+		m.delta = true
+	}
+
+	m.value, err = strconv.ParseFloat(valstr, 64)
+	if err != nil {
+		return nil, goerr.Wrap(ErrStatsdLine, 0)
+	}
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			m.rate, err = strconv.ParseFloat(part[1:], 64)
+			if err != nil || m.rate <= 0 || m.rate > 1 {
+				return nil, goerr.Wrap(ErrStatsdLine, 0)
+			}
+		case strings.HasPrefix(part, "#"):
+			for _, tag := range strings.Split(part[1:], ",") {
+				kv := strings.SplitN(tag, ":", 2)
+				if len(kv) == 2 {
+					m.tags[kv[0]] = kv[1]
+				} else {
+					m.tags[kv[0]] = ""
+				}
+			}
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseStatsdLine(t *testing.T) {
+	m, err := parseStatsdLine("app.hits:2|c|@0.5|#host:h1,env:prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.name != "app.hits" || m.kind != "c" || m.value != 2 || m.rate != 0.5 {
+		t.Fatal("wrong values", m)
+	}
+
+	if !reflect.DeepEqual(m.tags, map[string]string{"host": "h1", "env": "prod"}) {
+		t.Fatal("wrong tags", m.tags)
+	}
+
+	m, err = parseStatsdLine("app.mem:-5|g")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.delta || m.value != -5 {
+		t.Fatal("should be a gauge delta")
+	}
+
+	for _, line := range []string{"app.hits", "app.hits:x|c", "app.hits:1|x", "app.hits:1|c|@2"} {
+		if _, err := parseStatsdLine(line); err == nil {
+			t.Fatal("should fail", line)
+		}
+	}
+}
+
+func TestStatsdFlush(t *testing.T) {
+	dir := "/tmp/d-statsd"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	_, err = s.open(&OpenReq{
+		Database:    "statsd",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd := newStatsd(s, []*StatsdMapping{
+		{Prefix: "app.", Database: "statsd", Fields: []string{"name", "tag:host"}},
+	})
+
+	sd.handle([]byte("app.hits:1|c|@0.5|#host:h1\napp.hits:2|c|#host:h1\napp.time:30|ms|#host:h1"))
+	sd.handle([]byte("app.mem:10|g|#host:h1\napp.mem:+5|g|#host:h1\nother.hits:1|c"))
+
+	now := time.Now()
+	sd.flush(now)
+
+	ts := uint32(now.Unix())
+	expected := map[string]*ResPoint{
+		"hits": {Value: 4, Count: 3},
+		"time": {Value: 30, Count: 1},
+		"mem":  {Value: 15, Count: 1},
+	}
+
+	for name, point := range expected {
+		res, err := s.get(&GetReq{
+			Database:  "statsd",
+			Fields:    []string{name, "h1"},
+			GroupBy:   []bool{true, true},
+			StartTime: ts,
+			EndTime:   ts + 60,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Groups) != 1 || len(res.Groups[0].Points) != 1 {
+			t.Fatal("incorrect number of results", name)
+		}
+
+		if p := res.Groups[0].Points[0]; p.Value != point.Value || p.Count != point.Count {
+			t.Fatal("incorrect values for point", name, p)
+		}
+	}
+}
+
+func TestStatsdClose(t *testing.T) {
+	sd := newStatsd(nil, nil)
+	done := make(chan error)
+	go func() {
+		done <- sd.listen("127.0.0.1:18126")
+	}()
+
+	listening := func() bool {
+		sd.mutex.Lock()
+		defer sd.mutex.Unlock()
+		return sd.conn != nil
+	}
+
+	// wait for the listener
+	for i := 0; !listening(); i++ {
+		if i == 50 {
+			t.Fatal("statsd should listen")
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := sd.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listen should return after close")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// DefaultSubBuffer is the number of points buffered for a subscription
+	// if the client doesn't request a size. Oldest points are dropped when
+	// the buffer is full and the number of dropped points is reported.
+	DefaultSubBuffer = 1000
+
+	// MaxSubBuffer is the maximum buffer size a client can request
+	MaxSubBuffer = 100000
+
+	// MaxPollTimeout is the maximum time a poll request waits for points
+	MaxPollTimeout = 30 * time.Second
+
+	// SubExpiry is the time after which a subscription which is not polled
+	// is considered disconnected and removed.
+	SubExpiry = time.Minute
+
+	// WSPollTimeout is the time websocket subscriptions wait for points
+	// before checking whether the client has disconnected.
+	WSPollTimeout = time.Second
+)
+
+var (
+	// ErrSubscription is returned when the subscription is not found
+	ErrSubscription = errors.New("subscription not found")
+)
+
+type subscription struct {
+	id       uint64
+	database string
+	fields   []string
+	size     int
+
+	mutex    sync.Mutex
+	points   []*StreamPoint
+	dropped  uint32
+	lastSeen time.Time
+	notify   chan struct{}
+}
+
+// matches checks whether a point matches the database and field filter.
+// Empty strings in the filter match any value.
+func (sub *subscription) matches(p *StreamPoint) (ok bool) {
+	if p.Database != sub.database {
+		return false
+	}
+
+	if len(sub.fields) == 0 {
+		return true
+	}
+
+	return matchFields(sub.fields, p.Fields)
+}
+
+// push adds a point to the buffer dropping the oldest point if it's full
+func (sub *subscription) push(p *StreamPoint) {
+	sub.mutex.Lock()
+	if len(sub.points) >= sub.size {
+		sub.points = sub.points[1:]
+		sub.dropped++
+	}
+
+	sub.points = append(sub.points, p)
+	sub.mutex.Unlock()
+
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+// poll waits until points are available or the timeout is reached and
+// returns at most max buffered points (all points if max is zero).
+func (sub *subscription) poll(max int, timeout time.Duration) (points []*StreamPoint, dropped uint32) {
+	sub.touch()
+
+	if timeout > 0 && sub.empty() {
+		select {
+		case <-sub.notify:
+		case <-time.After(timeout):
+		}
+	}
+
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	n := len(sub.points)
+	if max > 0 && max < n {
+		n = max
+	}
+
+	points = sub.points[:n]
+	sub.points = sub.points[n:]
+	dropped = sub.dropped
+	sub.dropped = 0
+	sub.lastSeen = time.Now()
+
+	return points, dropped
+}
+
+func (sub *subscription) empty() (empty bool) {
+	sub.mutex.Lock()
+	empty = len(sub.points) == 0
+	sub.mutex.Unlock()
+	return empty
+}
+
+func (sub *subscription) touch() {
+	sub.mutex.Lock()
+	sub.lastSeen = time.Now()
+	sub.mutex.Unlock()
+}
+
+func (sub *subscription) expired(now time.Time) (expired bool) {
+	sub.mutex.Lock()
+	expired = now.Sub(sub.lastSeen) > SubExpiry
+	sub.mutex.Unlock()
+	return expired
+}
+
+// hub keeps subscriptions and delivers points written to databases
+type hub struct {
+	mutex  sync.RWMutex
+	nextID uint64
+	subs   map[uint64]*subscription
+}
+
+func newHub() (h *hub) {
+	return &hub{subs: make(map[uint64]*subscription)}
+}
+
+func (h *hub) subscribe(database string, fields []string, size int) (sub *subscription) {
+	if size <= 0 {
+		size = DefaultSubBuffer
+	} else if size > MaxSubBuffer {
+		size = MaxSubBuffer
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.nextID++
+	sub = &subscription{
+		id:       h.nextID,
+		database: database,
+		fields:   fields,
+		size:     size,
+		lastSeen: time.Now(),
+		notify:   make(chan struct{}, 1),
+	}
+
+	h.subs[sub.id] = sub
+	return sub
+}
+
+func (h *hub) get(id uint64) (sub *subscription, ok bool) {
+	h.mutex.RLock()
+	sub, ok = h.subs[id]
+	h.mutex.RUnlock()
+	return sub, ok
+}
+
+func (h *hub) unsubscribe(id uint64) (ok bool) {
+	h.mutex.Lock()
+	_, ok = h.subs[id]
+	delete(h.subs, id)
+	h.mutex.Unlock()
+	return ok
+}
+
+// publish sends a point to all matching subscriptions
+func (h *hub) publish(p *StreamPoint) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for _, sub := range h.subs {
+		if sub.matches(p) {
+			sub.push(p)
+		}
+	}
+}
+
+// expireEvery removes subscriptions which are not polled for SubExpiry
+func (h *hub) expireEvery(d time.Duration) {
+	for now := range time.Tick(d) {
+		h.mutex.Lock()
+		for id, sub := range h.subs {
+			if sub.expired(now) {
+				delete(h.subs, id)
+			}
+		}
+		h.mutex.Unlock()
+	}
+}
+
+func (s *server) subscribe(req *SubscribeReq) (res *SubscribeRes, err error) {
+	res = &SubscribeRes{}
+
+	if _, ok := s.database(req.Database); !ok {
+		return nil, goerr.Wrap(ErrDatabase, 0)
+	}
+
+	sub := s.hub.subscribe(req.Database, req.Fields, int(req.BufferSize))
+	res.Id = sub.id
+
+	return res, nil
+}
+
+func (s *server) poll(req *PollReq) (res *PollRes, err error) {
+	res = &PollRes{}
+
+	sub, ok := s.hub.get(req.Id)
+	if !ok {
+		return nil, goerr.Wrap(ErrSubscription, 0)
+	}
+
+	timeout := time.Duration(req.Timeout) * time.Millisecond
+	if timeout > MaxPollTimeout {
+		timeout = MaxPollTimeout
+	}
+
+	res.Points, res.Dropped = sub.poll(int(req.MaxPoints), timeout)
+	return res, nil
+}
+
+func (s *server) unsubscribe(req *UnsubscribeReq) (res *UnsubscribeRes, err error) {
+	res = &UnsubscribeRes{}
+
+	if !s.hub.unsubscribe(req.Id) {
+		return nil, goerr.Wrap(ErrSubscription, 0)
+	}
+
+	return res, nil
+}
+
+// serveSubscription streams points to a websocket client as json encoded
+// PollRes messages. Query parameters are "database", "fields" (comma
+// separated, empty values match anything) and "buffer" (buffer size).
+func (s *server) serveSubscription(ws *websocket.Conn) {
+	defer ws.Close()
+
+	query := ws.Request().URL.Query()
+	database := query.Get("database")
+	if err := s.acls.allow(httpToken(ws.Request()), database, OpRead); err != nil {
+		Logger.Error(err, database)
+		return
+	}
+
+	if _, ok := s.database(database); !ok {
+		Logger.Error(ErrDatabase, database)
+		return
+	}
+
+	var fields []string
+	if str := query.Get("fields"); str != "" {
+		fields = strings.Split(str, ",")
+	}
+
+	size, _ := strconv.Atoi(query.Get("buffer"))
+	sub := s.hub.subscribe(database, fields, size)
+	defer s.hub.unsubscribe(sub.id)
+
+	// clients are not expected to send anything, a failed read
+	// means that the client has disconnected or the socket is broken
+	closed := make(chan struct{})
+	go func() {
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		default:
+		}
+
+		points, dropped := sub.poll(0, WSPollTimeout)
+		if len(points) == 0 && dropped == 0 {
+			continue
+		}
+
+		res := &PollRes{Points: points, Dropped: dropped}
+		if err := websocket.JSON.Send(ws, res); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSubscribePoll(t *testing.T) {
+	dir := "/tmp/d-subscribe"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(&Options{Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	_, err = s.open(&OpenReq{
+		Database:    "sub",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.subscribe(&SubscribeReq{Database: "missing"}); err == nil {
+		t.Fatal("should fail for missing databases")
+	}
+
+	sres, err := s.subscribe(&SubscribeReq{
+		Database:   "sub",
+		Fields:     []string{"a", ""},
+		BufferSize: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for points in the background
+	done := make(chan *PollRes)
+	go func() {
+		res, err := s.poll(&PollReq{Id: sres.Id, Timeout: 1000})
+		if err != nil {
+			t.Error(err)
+		}
+
+		done <- res
+	}()
+
+	now := uint32(time.Now().Unix())
+	put := func(fields ...string) {
+		req := &PutReq{Database: "sub", Fields: fields, Timestamp: now, Value: 1, Count: 1}
+		if _, err := s.put(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	put("a", "b")
+
+	res := <-done
+	if len(res.Points) != 1 || !reflect.DeepEqual(res.Points[0].Fields, []string{"a", "b"}) {
+		t.Fatal("should receive the point", res.Points)
+	}
+
+	put("b", "b")
+	put("a", "c")
+	put("a", "d")
+	put("a", "e")
+
+	pres, err := s.poll(&PollReq{Id: sres.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pres.Points) != 2 || pres.Dropped != 1 || pres.Points[0].Fields[1] != "d" {
+		t.Fatal("should drop oldest points", pres)
+	}
+
+	if _, err := s.unsubscribe(&UnsubscribeReq{Id: sres.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.poll(&PollReq{Id: sres.Id}); err == nil {
+		t.Fatal("should fail after unsubscribe")
+	}
+}
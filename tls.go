@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+	"github.com/gogo/protobuf/proto"
+	"github.com/meteorhacks/simple-rpc-go/srpc"
+)
+
+const (
+	// TLSHandshakeTimeout is the time allowed for a TLS handshake
+	TLSHandshakeTimeout = 10 * time.Second
+
+	// TLSFrameTimeout is the time allowed for each read and write of a
+	// request or a response. Clients wait this long for responses.
+	TLSFrameTimeout = 2 * time.Minute
+
+	// TLSIdleTimeout is the time a server waits for the next request
+	// before it closes a TLS connection
+	TLSIdleTimeout = 5 * time.Minute
+)
+
+var (
+	// ErrCA is returned when a CA file has no certificates
+	ErrCA = errors.New("no certificates found in CA file")
+
+	// ErrMethod is returned for requests to unknown rpc methods
+	ErrMethod = errors.New("unknown rpc method")
+
+	// principalPrefix marks tokens created for client certificates. It
+	// has a random part so that clients cannot send these tokens.
+	principalPrefix = newPrincipalPrefix()
+)
+
+func newPrincipalPrefix() (prefix string) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return "principal:" + hex.EncodeToString(b) + ":"
+}
+
+// principalToken returns the token used to authorize a client certificate
+func principalToken(principal string) (token string) {
+	return principalPrefix + principal
+}
+
+// listenTLS serves rpc requests over TLS on the server address. Each
+// connection is served with srpc after the handshake.
+func (s *server) listenTLS() (err error) {
+	config, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	ln, err := tls.Listen("tcp", s.options.Address, config)
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	s.closeMutex.Lock()
+	if s.closed {
+		s.closeMutex.Unlock()
+		ln.Close()
+		return goerr.Wrap(ErrClosed, 0)
+	}
+
+	s.listener = ln
+	s.closeMutex.Unlock()
+
+	handlers := s.handlers()
+
+	log.Println("SRPCS:  listening on", s.options.Address, "with tls")
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		go s.serveTLS(conn.(*tls.Conn), handlers)
+	}
+}
+
+func (s *server) tlsConfig() (config *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(s.options.TLSCert, s.options.TLSKey)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	config = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if s.options.TLSClientCA != "" {
+		pool, err := loadCA(s.options.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// serveTLS handles requests of a connection. Requests from clients with
+// a certificate are authorized as the certificate principal.
+func (s *server) serveTLS(conn *tls.Conn, handlers map[string]func([]byte) ([]byte, error)) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(TLSHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		Logger.Error(err)
+		return
+	}
+
+	var token string
+	if certs := conn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		token = principalToken(certs[0].Subject.CommonName)
+	}
+
+	srv := srpc.NewServer(s.options.Address)
+	for method, handler := range handlers {
+		srv.SetHandler(method, callAs(method, handler, token))
+	}
+
+	srv.ServeConn(&deadlineConn{Conn: conn, read: TLSIdleTimeout, write: TLSFrameTimeout})
+}
+
+// callAs returns a handler which replaces the request token when it's set
+func callAs(method string, handler func([]byte) ([]byte, error), token string) func([]byte) ([]byte, error) {
+	if token == "" {
+		return handler
+	}
+
+	return func(reqData []byte) (resData []byte, err error) {
+		req := newRequest(method)
+		if req == nil {
+			return nil, goerr.Wrap(ErrMethod, 0)
+		}
+
+		if err := proto.Unmarshal(reqData, req); err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+
+		// batch items can have their own tokens
+		if batch, ok := req.(*ReqBatch); ok {
+			for _, item := range batch.Batch {
+				clearToken(item)
+			}
+		}
+
+		*messageToken(req) = token
+		if reqData, err = proto.Marshal(req); err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+
+		return handler(reqData)
+	}
+}
+
+// newRequest returns an empty request message of a method
+func newRequest(method string) (req proto.Message) {
+	switch method {
+	case "info":
+		return &InfoReq{}
+	case "open":
+		return &OpenReq{}
+	case "edit":
+		return &EditReq{}
+	case "put":
+		return &PutReq{}
+	case "inc":
+		return &IncReq{}
+	case "get":
+		return &GetReq{}
+	case "batch":
+		return &ReqBatch{}
+	case "metrics":
+		return &MetricsReq{}
+	case "subscribe":
+		return &SubscribeReq{}
+	case "poll":
+		return &PollReq{}
+	case "unsubscribe":
+		return &UnsubscribeReq{}
+	case "setAlert":
+		return &SetAlertReq{}
+	case "delAlert":
+		return &DelAlertReq{}
+	case "listAlerts":
+		return &ListAlertsReq{}
+	case "backup":
+		return &BackupReq{}
+	case "restore":
+		return &RestoreReq{}
+	case "drop":
+		return &DropReq{}
+	case "replicate":
+		return &ReplicateReq{}
+	case "reconcile":
+		return &ReconcileReq{}
+	case "retry":
+		return &RetryReq{}
+	}
+
+	return nil
+}
+
+// clearToken removes the token of a request inside a batch
+func clearToken(req *Request) {
+	switch {
+	case req.InfoReq != nil:
+		req.InfoReq.Token = ""
+	case req.OpenReq != nil:
+		req.OpenReq.Token = ""
+	case req.EditReq != nil:
+		req.EditReq.Token = ""
+	case req.PutReq != nil:
+		req.PutReq.Token = ""
+	case req.IncReq != nil:
+		req.IncReq.Token = ""
+	case req.GetReq != nil:
+		req.GetReq.Token = ""
+	}
+}
+
+// deadlineConn sets a deadline before each read and write so peers
+// which stop sending or reading do not hold a connection forever
+type deadlineConn struct {
+	net.Conn
+	read  time.Duration
+	write time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (n int, err error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.read)); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (n int, err error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.write)); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Write(b)
+}
+
+// dialTLS connects to a server listening with TLS and sends requests
+// with srpc over the connection
+func dialTLS(addr string, config *tls.Config) (c *srpc.Client, err error) {
+	dialer := &net.Dialer{Timeout: TLSHandshakeTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, config)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	return srpc.NewConnClient(&deadlineConn{Conn: conn, read: TLSFrameTimeout, write: TLSFrameTimeout}), nil
+}
+
+// clientTLSConfig verifies servers with certificates in the CA file. The
+// certificate and the key are sent to servers which verify clients.
+func clientTLSConfig(caFile, certFile, keyFile string) (config *tls.Config, err error) {
+	pool, err := loadCA(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, goerr.Wrap(err, 0)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// peerTLSConfig returns the config used to connect to other servers
+// (primary and cluster nodes). It's nil when PeerTLSCA is not set.
+func peerTLSConfig(options *Options) (config *tls.Config, err error) {
+	if options.PeerTLSCA == "" {
+		return nil, nil
+	}
+
+	return clientTLSConfig(options.PeerTLSCA, options.PeerTLSCert, options.PeerTLSKey)
+}
+
+func loadCA(file string) (pool *x509.CertPool, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, goerr.Wrap(ErrCA, 0)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert creates a certificate signed by parent (self signed if nil)
+// and writes the certificate and key as pem files
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(path.Join(dir, name+".crt"), certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func TestTLS(t *testing.T) {
+	dir := "/tmp/d-tls"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", ca, caKey)
+	writeCert(t, dir, "reporter", ca, caKey)
+
+	addr := "127.0.0.1:19331"
+	srv, err := NewServer(&Options{
+		Path:        path.Join(dir, "data"),
+		Address:     addr,
+		TLSCert:     path.Join(dir, "server.crt"),
+		TLSKey:      path.Join(dir, "server.key"),
+		TLSClientCA: path.Join(dir, "ca.crt"),
+		ACLs: []*ACL{
+			{Token: "admin", Rules: []*ACLRule{{Database: "*", Ops: []string{OpAdmin}}}},
+			{Principal: "reporter", Rules: []*ACLRule{{Database: "*", Ops: []string{OpRead}}}},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go srv.Listen()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	cert, err := tls.LoadX509KeyPair(path.Join(dir, "reporter.crt"), path.Join(dir, "reporter.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the listener
+	for i := 0; ; i++ {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}})
+		if err == nil {
+			conn.Close()
+			break
+		} else if i == 50 {
+			t.Fatal(err)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	config := &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}}
+
+	// the client sends the admin token but requests are authorized
+	// with the principal of the client certificate
+	conn, err := dial(addr, "admin", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+	call := conn.call
+
+	if err := call("info", &InfoReq{}, &InfoRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	open := &OpenReq{
+		Database:    "tls",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	}
+
+	err = call("open", open, &OpenRes{})
+	if err == nil || !strings.Contains(err.Error(), ErrForbidden.Error()) {
+		t.Fatal("principal should not be allowed to open databases", err)
+	}
+
+	batch := &ReqBatch{Batch: []*Request{{OpenReq: open}}}
+	open.Token = "admin"
+	err = call("batch", batch, &ResBatch{})
+	if err == nil || !strings.Contains(err.Error(), ErrForbidden.Error()) {
+		t.Fatal("batch item tokens should be ignored", err)
+	}
+
+	// routers and followers connect to nodes with peer tls options
+	peer, err := peerTLSConfig(&Options{
+		PeerTLSCA:   path.Join(dir, "ca.crt"),
+		PeerTLSCert: path.Join(dir, "reporter.crt"),
+		PeerTLSKey:  path.Join(dir, "reporter.key"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := newNode(addr, peer)
+	if err := n.call("info", &InfoReq{}, &InfoRes{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// clients without a certificate cannot connect
+	if conn, err := dial(addr, "", &tls.Config{RootCAs: pool}); err == nil {
+		defer conn.Close()
+		if err := conn.call("info", &InfoReq{}, &InfoRes{}); err == nil {
+			t.Fatal("clients without a certificate should be rejected")
+		}
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	goerr "github.com/go-errors/errors"
+)
+
+const (
+	// WALFile is the name of the write-ahead log file in the data path
+	WALFile = "wal.log"
+
+	// WALSyncAlways syncs the log to disk before acknowledging each write
+	WALSyncAlways = "always"
+
+	// WALSyncBatch syncs the log every WAL interval and writes wait for the
+	// sync which covers them before they are acknowledged.
+	WALSyncBatch = "batch"
+
+	// WALSyncInterval syncs the log every WAL interval without waiting.
+	// Writes acknowledged after the last sync can be lost on a crash.
+	WALSyncInterval = "interval"
+
+	// DefaultWALBatch is the default interval to sync batched writes
+	DefaultWALBatch = 10 * time.Millisecond
+
+	// DefaultWALInterval is the default interval for the interval policy
+	DefaultWALInterval = time.Second
+
+	// DefaultWALCheckpoint is the default interval to sync databases
+	// and truncate the write-ahead log.
+	DefaultWALCheckpoint = time.Minute
+
+	// WALHeaderSize is the size of the record header (length and crc32)
+	WALHeaderSize = 8
+
+	// WALMaxRecord is the maximum size of a record, larger lengths are
+	// only possible when the record header is corrupt.
+	WALMaxRecord = 16 * 1024 * 1024
+)
+
+var (
+	// ErrWALPolicy is returned when the wal sync policy is unknown
+	ErrWALPolicy = errors.New("invalid wal sync policy")
+
+	// ErrWALRecord is returned when a log record is corrupt or truncated
+	ErrWALRecord = errors.New("invalid wal record")
+)
+
+// wal is a write-ahead log of put requests. Increments are logged as put
+// requests with the resulting value so replaying the log is idempotent.
+type wal struct {
+	policy string
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	file   *os.File
+	closed bool
+
+	// sequence numbers of the last written and the last synced record
+	written uint64
+	synced  uint64
+}
+
+func openWAL(fpath, policy string) (w *wal, err error) {
+	switch policy {
+	case WALSyncAlways, WALSyncBatch, WALSyncInterval:
+	default:
+		return nil, goerr.Wrap(ErrWALPolicy, 0)
+	}
+
+	file, err := os.OpenFile(fpath, os.O_RDWR|os.O_CREATE, DataPerm)
+	if err != nil {
+		return nil, goerr.Wrap(err, 0)
+	}
+
+	w = &wal{policy: policy, file: file}
+	w.cond = sync.NewCond(&w.mutex)
+
+	return w, nil
+}
+
+// replay calls fn for each record in the log. It stops at the first
+// corrupt or partially written record and truncates the log there.
+func (w *wal) replay(fn func(req *PutReq) (err error)) (count int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.file.Seek(0, 0); err != nil {
+		return 0, goerr.Wrap(err, 0)
+	}
+
+	r := bufio.NewReader(w.file)
+	var offset int64
+
+	for {
+		req, size, err := readWALRecord(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			Logger.Error(err, "wal truncated at", offset)
+			break
+		}
+
+		if err := fn(req); err != nil {
+			Logger.Error(err)
+		}
+
+		offset += size
+		count++
+	}
+
+	if err := w.file.Truncate(offset); err != nil {
+		return count, goerr.Wrap(err, 0)
+	}
+
+	if _, err := w.file.Seek(offset, 0); err != nil {
+		return count, goerr.Wrap(err, 0)
+	}
+
+	return count, nil
+}
+
+// append writes a record and returns when it's durable under the policy
+func (w *wal) append(req *PutReq) (err error) {
+	data, err := req.Marshal()
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	buff := encodeRecord(data)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.file.Write(buff); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	w.written++
+
+	switch w.policy {
+	case WALSyncAlways:
+		if err := w.file.Sync(); err != nil {
+			return goerr.Wrap(err, 0)
+		}
+
+		w.synced = w.written
+	case WALSyncBatch:
+		seq := w.written
+		for w.synced < seq {
+			w.cond.Wait()
+		}
+	}
+
+	return nil
+}
+
+// syncEvery syncs records written since the last sync on every tick
+func (w *wal) syncEvery(d time.Duration) {
+	for _ = range time.Tick(d) {
+		w.mutex.Lock()
+		closed := w.closed
+		w.mutex.Unlock()
+
+		if closed {
+			return
+		}
+
+		if err := w.sync(); err != nil {
+			Logger.Error(err)
+		}
+	}
+}
+
+func (w *wal) sync() (err error) {
+	w.mutex.Lock()
+	target := w.written
+	w.mutex.Unlock()
+
+	if target == w.syncedSeq() {
+		return nil
+	}
+
+	err = w.file.Sync()
+
+	w.mutex.Lock()
+	if err == nil && target > w.synced {
+		w.synced = target
+	}
+	w.cond.Broadcast()
+	w.mutex.Unlock()
+
+	if err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+func (w *wal) syncedSeq() (seq uint64) {
+	w.mutex.Lock()
+	seq = w.synced
+	w.mutex.Unlock()
+	return seq
+}
+
+// truncate removes all records from the log. It must only be called
+// after all databases have been synced to disk.
+func (w *wal) truncate() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if _, err := w.file.Seek(0, 0); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+// close syncs and closes the log file
+func (w *wal) close() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.closed = true
+	if err := w.file.Sync(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	if err := w.file.Close(); err != nil {
+		return goerr.Wrap(err, 0)
+	}
+
+	return nil
+}
+
+// encodeRecord adds a header with the length and crc32 checksum of data.
+// Records with this format are also used by the replication log.
+func encodeRecord(data []byte) (buff []byte) {
+	buff = make([]byte, WALHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(buff[0:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buff[4:], crc32.ChecksumIEEE(data))
+	copy(buff[WALHeaderSize:], data)
+	return buff
+}
+
+// readRecord reads a record written with encodeRecord. It returns io.EOF
+// only when there are no more bytes to read.
+func readRecord(r io.Reader) (data []byte, err error) {
+	header := make([]byte, WALHeaderSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, io.EOF
+		}
+
+		return nil, goerr.Wrap(ErrWALRecord, 0)
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:])
+	checksum := binary.LittleEndian.Uint32(header[4:])
+	if length > WALMaxRecord {
+		return nil, goerr.Wrap(ErrWALRecord, 0)
+	}
+
+	data = make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, goerr.Wrap(ErrWALRecord, 0)
+	}
+
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, goerr.Wrap(ErrWALRecord, 0)
+	}
+
+	return data, nil
+}
+
+func readWALRecord(r io.Reader) (req *PutReq, size int64, err error) {
+	data, err := readRecord(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req = &PutReq{}
+	if err := req.Unmarshal(data); err != nil {
+		return nil, 0, goerr.Wrap(ErrWALRecord, 0)
+	}
+
+	return req, int64(WALHeaderSize + len(data)), nil
+}
+
+// logWrite appends a put request to the write-ahead log if it's enabled
+func (s *server) logWrite(req *PutReq) (err error) {
+	if s.wal == nil {
+		return nil
+	}
+
+	return s.wal.append(req)
+}
+
+// checkpoint syncs all databases and truncates the write-ahead log.
+// Writes are blocked while databases are synced.
+func (s *server) checkpoint() (err error) {
+	defer Logger.Time(time.Now(), time.Second, "server.checkpoint")
+
+	s.walMutex.Lock()
+	defer s.walMutex.Unlock()
+
+	s.dbsMutex.RLock()
+	defer s.dbsMutex.RUnlock()
+
+	for _, db := range s.databases {
+		if err := db.Sync(); err != nil {
+			return goerr.Wrap(err, 0)
+		}
+	}
+
+	if s.wal == nil {
+		return nil
+	}
+
+	return s.wal.truncate()
+}
+
+// checkpointEvery runs a checkpoint on every tick
+func (s *server) checkpointEvery(d time.Duration) {
+	for _ = range time.Tick(d) {
+		if s.closing() {
+			return
+		}
+
+		if err := s.checkpoint(); err != nil {
+			Logger.Error(err)
+		}
+	}
+}
+
+// replayWAL applies the write-ahead log to databases and starts logging.
+// It must be called before the server starts accepting requests.
+func (s *server) replayWAL() (err error) {
+	defer Logger.Time(time.Now(), 10*time.Second, "server.replayWAL")
+
+	w, err := openWAL(s.options.WALPath, s.options.WALPolicy)
+	if err != nil {
+		return err
+	}
+
+	count, err := w.replay(func(req *PutReq) error {
+		_, err := s.applyPut(req)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		Logger.Info("wal: replayed", count, "records")
+	}
+
+	s.wal = w
+	if err := s.checkpoint(); err != nil {
+		return err
+	}
+
+	interval := s.options.WALInterval
+	switch {
+	case interval > 0:
+	case s.options.WALPolicy == WALSyncBatch:
+		interval = DefaultWALBatch
+	default:
+		interval = DefaultWALInterval
+	}
+
+	if s.options.WALPolicy != WALSyncAlways {
+		go w.syncEvery(interval)
+	}
+
+	checkpoint := s.options.WALCheckpoint
+	if checkpoint <= 0 {
+		checkpoint = DefaultWALCheckpoint
+	}
+
+	go s.checkpointEvery(checkpoint)
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestWALReplay(t *testing.T) {
+	dir := "/tmp/d-wal"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	options := &Options{Path: dir, WALPolicy: WALSyncAlways}
+	srv, err := NewServer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.(*server)
+	_, err = s.open(&OpenReq{
+		Database:    "wal",
+		Resolution:  60,
+		Retention:   36000,
+		EpochTime:   3600,
+		MaxROEpochs: 2,
+		MaxRWEpochs: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := uint32(time.Now().Unix())
+	fields := []string{"a", "b"}
+
+	if _, err := s.put(&PutReq{Database: "wal", Fields: fields, Timestamp: now, Value: 5, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.inc(&IncReq{Database: "wal", Fields: fields, Timestamp: now, Value: 1, Count: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// simulate a partially written record after a crash
+	file, err := os.OpenFile(path.Join(dir, WALFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.Write([]byte{10, 0, 0, 0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// open the data directory again without closing the first server
+	srv2, err := NewServer(&Options{Path: dir, WALPolicy: WALSyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s2 := srv2.(*server)
+	res, err := s2.get(&GetReq{
+		Database:  "wal",
+		Fields:    fields,
+		GroupBy:   []bool{true, true},
+		StartTime: now,
+		EndTime:   now + 60,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Groups) != 1 {
+		t.Fatal("incorrect number of results")
+	}
+
+	point := res.Groups[0].Points[0]
+	if point.Value != 7 || point.Count != 3 {
+		t.Fatal("incorrect values for point", point)
+	}
+
+	finfo, err := os.Stat(path.Join(dir, WALFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if finfo.Size() != 0 {
+		t.Fatal("wal should be truncated after replay")
+	}
+}